@@ -0,0 +1,189 @@
+package chunker
+
+import (
+	"fmt"
+	"intualai/parser"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+// Strategy is how a project's documents are split into chunks
+type Strategy string
+
+const (
+	// Windows of Size tokens, ignoring the text's structure
+	FixedToken Strategy = "fixed_token"
+	// Whole sentences, packed up to Size tokens
+	Sentence Strategy = "sentence"
+	// Splits on paragraphs, then lines, sentences and words until every
+	// piece fits, then packs pieces up to Size tokens
+	Recursive Strategy = "recursive"
+	// Like Recursive, but chunks never cross a heading, so each chunk belongs
+	// to a single section
+	Heading Strategy = "heading"
+)
+
+var strategies = map[Strategy]splitter{
+	FixedToken: splitFixed,
+	Sentence:   splitSentences,
+	Recursive:  splitRecursive,
+	Heading:    splitHeadings,
+}
+
+// Config is a project's chunking settings
+type Config struct {
+	Strategy Strategy `json:"strategy"`
+	// Max chunk size in tokens (see CountTokens)
+	Size int `json:"size"`
+	// Number of tokens repeated from the end of the previous chunk
+	Overlap int `json:"overlap"`
+}
+
+func DefaultConfig() Config {
+	return Config{Strategy: Recursive, Size: 512, Overlap: 64}
+}
+
+func (c Config) Validate() error {
+	if _, ok := strategies[c.Strategy]; !ok {
+		return fmt.Errorf("chunking.strategy must be fixed_token, sentence, recursive or heading, got %q", c.Strategy)
+	}
+	if c.Size < 16 || c.Size > 8192 {
+		return fmt.Errorf("chunking.size must be between 16 and 8192 tokens, got %d", c.Size)
+	}
+	if c.Overlap < 0 || c.Overlap >= c.Size {
+		return fmt.Errorf("chunking.overlap must be at least 0 and less than chunking.size, got %d", c.Overlap)
+	}
+	return nil
+}
+
+// Chunk is a piece of a document that's embedded and retrieved on its own
+type Chunk struct {
+	// Derived from the source, position and text, so processing the same file
+	// again gives the same IDs
+	ID    string `json:"id"`
+	Index int    `json:"index"`
+	Text  string `json:"text"`
+	// Byte offsets into the parsed document's text
+	Start int `json:"start"`
+	End   int `json:"end"`
+	// 0 if the document has no pages
+	Page int `json:"page,omitempty"`
+	// Title of the heading the chunk falls under, if any
+	Section string `json:"section,omitempty"`
+}
+
+// Chunker splits a parsed document into chunks. source identifies the file
+// the document came from (its blob key) and goes into the chunk IDs.
+type Chunker interface {
+	Chunk(doc *parser.Document, source string) []Chunk
+}
+
+// New returns the chunker for config
+func New(config Config) (Chunker, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &chunker{
+		split:   strategies[config.Strategy],
+		size:    config.Size,
+		overlap: config.Overlap,
+	}, nil
+}
+
+// A splitter returns chunk boundaries, each at most size tokens
+type splitter func(doc *parser.Document, size int, overlap int) []span
+
+type span struct {
+	start   int
+	end     int
+	tokens  int
+	section string
+}
+
+type chunker struct {
+	split   splitter
+	size    int
+	overlap int
+}
+
+// Namespace for chunk IDs (UUIDv5), so they're valid point IDs in any vector
+// store
+var chunkNamespace = uuid.MustParse("5b0a3c59-7f0e-4b8e-9a43-2a0c64b7e1d4")
+
+func (c *chunker) Chunk(doc *parser.Document, source string) []Chunk {
+	var chunks []Chunk
+
+	for _, span := range c.split(doc, c.size, c.overlap) {
+		start, end := trimSpan(doc.Text, span.start, span.end)
+		if start >= end {
+			continue
+		}
+
+		text := doc.Text[start:end]
+		chunks = append(chunks, Chunk{
+			ID:      chunkID(source, start, end, text),
+			Index:   len(chunks),
+			Text:    text,
+			Start:   start,
+			End:     end,
+			Page:    doc.PageAt(start),
+			Section: span.section,
+		})
+	}
+
+	return chunks
+}
+
+func chunkID(source string, start int, end int, text string) string {
+	name := source + "\x00" + strconv.Itoa(start) + "\x00" + strconv.Itoa(end) + "\x00" + text
+	return uuid.NewSHA1(chunkNamespace, []byte(name)).String()
+}
+
+// trimSpan moves start and end in past surrounding whitespace
+func trimSpan(text string, start int, end int) (int, int) {
+	trimmed := strings.TrimLeftFunc(text[start:end], unicode.IsSpace)
+	start = end - len(trimmed)
+	trimmed = strings.TrimRightFunc(trimmed, unicode.IsSpace)
+	return start, start + len(trimmed)
+}
+
+// pack merges consecutive units into spans of at most size tokens. Each span
+// after the first starts with the last units of the previous one, up to
+// overlap tokens. Units bigger than size become a span of their own.
+func pack(units []span, size int, overlap int) []span {
+	var spans []span
+
+	for i := 0; i < len(units); {
+		j, tokens := i, 0
+		for j < len(units) && (j == i || tokens+units[j].tokens <= size) {
+			tokens += units[j].tokens
+			j++
+		}
+
+		spans = append(spans, span{
+			start:   units[i].start,
+			end:     units[j-1].end,
+			tokens:  tokens,
+			section: units[i].section,
+		})
+
+		if j >= len(units) {
+			break
+		}
+
+		// Step back over the units that fit in the overlap, but always move
+		// forward at least one unit
+		next, repeated := j, 0
+		for next > i+1 && repeated+units[next-1].tokens <= overlap {
+			next--
+			repeated += units[next].tokens
+		}
+		i = next
+	}
+
+	return spans
+}
@@ -0,0 +1,201 @@
+package chunker
+
+import (
+	"fmt"
+	"intualai/parser"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPack(t *testing.T) {
+	tests := []struct {
+		name    string
+		tokens  []int
+		size    int
+		overlap int
+		// Unit index ranges of the spans
+		want [][2]int
+	}{
+		{name: "empty", tokens: nil, size: 2, want: nil},
+		{name: "fits", tokens: []int{1, 1, 1}, size: 3, want: [][2]int{{0, 3}}},
+		{name: "no overlap", tokens: []int{1, 1, 1, 1, 1}, size: 2, want: [][2]int{{0, 2}, {2, 4}, {4, 5}}},
+		{name: "overlap", tokens: []int{1, 1, 1, 1, 1}, size: 2, overlap: 1, want: [][2]int{{0, 2}, {1, 3}, {2, 4}, {3, 5}}},
+		{name: "wide overlap", tokens: []int{1, 1, 1, 1, 1}, size: 3, overlap: 1, want: [][2]int{{0, 3}, {2, 5}}},
+		// Units that don't fit the overlap aren't repeated
+		{name: "overlap too small", tokens: []int{2, 2, 2}, size: 4, overlap: 1, want: [][2]int{{0, 2}, {2, 3}}},
+		// The overlap can't swallow the whole span, each span moves on
+		{name: "overlap whole span", tokens: []int{2, 2, 2}, size: 4, overlap: 4, want: [][2]int{{0, 2}, {1, 3}}},
+		{name: "oversized unit", tokens: []int{1, 5, 1}, size: 3, want: [][2]int{{0, 1}, {1, 2}, {2, 3}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			units := make([]span, len(test.tokens))
+			for i, tokens := range test.tokens {
+				units[i] = span{start: i, end: i + 1, tokens: tokens}
+			}
+
+			var got [][2]int
+			for _, span := range pack(units, test.size, test.overlap) {
+				got = append(got, [2]int{span.start, span.end})
+
+				tokens := 0
+				for _, unit := range units[span.start:span.end] {
+					tokens += unit.tokens
+				}
+				if span.tokens != tokens {
+					t.Errorf("span %d-%d has %d tokens, want %d", span.start, span.end, span.tokens, tokens)
+				}
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("pack = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+// testDocument has paragraphs of sentences of varying length, under two
+// headings
+func testDocument() *parser.Document {
+	var text strings.Builder
+	var headings []parser.Heading
+
+	for section := 1; section <= 2; section++ {
+		title := fmt.Sprintf("Section %d", section)
+		headings = append(headings, parser.Heading{Level: 1, Title: title, Start: text.Len()})
+		text.WriteString(title + "\n\n")
+
+		for paragraph := 0; paragraph < 4; paragraph++ {
+			for sentence := 0; sentence < 5; sentence++ {
+				words := strings.Repeat("word ", 3+(paragraph*5+sentence)%11)
+				fmt.Fprintf(&text, "Sentence %d has %s in it. ", sentence, strings.TrimSpace(words))
+			}
+			text.WriteString("\n\n")
+		}
+	}
+
+	return &parser.Document{Text: text.String(), Headings: headings}
+}
+
+func TestChunk(t *testing.T) {
+	doc := testDocument()
+
+	for strategy := range strategies {
+		for _, config := range []Config{
+			{Strategy: strategy, Size: 16},
+			{Strategy: strategy, Size: 32, Overlap: 8},
+			{Strategy: strategy, Size: 100, Overlap: 20},
+		} {
+			t.Run(fmt.Sprintf("%s/%d/%d", config.Strategy, config.Size, config.Overlap), func(t *testing.T) {
+				c, err := New(config)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				chunks := c.Chunk(doc, "project/file.txt")
+				if len(chunks) < 2 {
+					t.Fatalf("got %d chunks, want several", len(chunks))
+				}
+
+				if chunks[0].Start != 0 || chunks[len(chunks)-1].End != len(strings.TrimSpace(doc.Text)) {
+					t.Errorf("chunks cover %d-%d, want the whole text", chunks[0].Start, chunks[len(chunks)-1].End)
+				}
+
+				ids := map[string]bool{}
+				for i, chunk := range chunks {
+					if chunk.Index != i {
+						t.Errorf("chunk %d has index %d", i, chunk.Index)
+					}
+					if chunk.Text != doc.Text[chunk.Start:chunk.End] || chunk.Text != strings.TrimSpace(chunk.Text) {
+						t.Errorf("chunk %d text %q doesn't match its trimmed offsets", i, chunk.Text)
+					}
+					if tokens := CountTokens(chunk.Text); tokens > config.Size {
+						t.Errorf("chunk %d has %d tokens, more than %d", i, tokens, config.Size)
+					}
+					if ids[chunk.ID] {
+						t.Errorf("chunk %d has a duplicate ID", i)
+					}
+					ids[chunk.ID] = true
+
+					if i == 0 {
+						continue
+					}
+
+					previous := chunks[i-1]
+					if chunk.Start <= previous.Start {
+						t.Errorf("chunk %d starts at %d, not after chunk %d at %d", i, chunk.Start, i-1, previous.Start)
+					}
+					if chunk.Start > previous.End {
+						// Only whitespace may fall between chunks
+						if gap := doc.Text[previous.End:chunk.Start]; strings.TrimSpace(gap) != "" {
+							t.Errorf("text %q between chunks %d and %d is lost", gap, i-1, i)
+						}
+					} else if repeated := CountTokens(doc.Text[chunk.Start:previous.End]); repeated > config.Overlap {
+						t.Errorf("chunk %d repeats %d tokens, more than %d", i, repeated, config.Overlap)
+					}
+				}
+
+				// Chunking is deterministic
+				if again := c.Chunk(doc, "project/file.txt"); !reflect.DeepEqual(again, chunks) {
+					t.Error("chunking the same document again gave different chunks")
+				}
+			})
+		}
+	}
+}
+
+func TestChunkHeadings(t *testing.T) {
+	doc := testDocument()
+
+	c, err := New(Config{Strategy: Heading, Size: 100, Overlap: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, chunk := range c.Chunk(doc, "project/file.txt") {
+		// The heading the chunk starts under
+		var want parser.Heading
+		for _, heading := range doc.Headings {
+			if heading.Start <= chunk.Start {
+				want = heading
+			}
+		}
+
+		if chunk.Section != want.Title {
+			t.Errorf("chunk %d is in section %q, want %q", chunk.Index, chunk.Section, want.Title)
+		}
+		for _, heading := range doc.Headings {
+			if heading.Start > chunk.Start && heading.Start < chunk.End {
+				t.Errorf("chunk %d crosses heading %q", chunk.Index, heading.Title)
+			}
+		}
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		config Config
+		ok     bool
+	}{
+		{config: DefaultConfig(), ok: true},
+		{config: Config{Strategy: FixedToken, Size: 16}, ok: true},
+		{config: Config{Strategy: Sentence, Size: 8192, Overlap: 8191}, ok: true},
+		{config: Config{Strategy: "paragraph", Size: 512}},
+		{config: Config{Strategy: Recursive, Size: 15}},
+		{config: Config{Strategy: Recursive, Size: 8193}},
+		{config: Config{Strategy: Recursive, Size: 512, Overlap: -1}},
+		{config: Config{Strategy: Recursive, Size: 512, Overlap: 512}},
+	}
+
+	for _, test := range tests {
+		err := test.config.Validate()
+		if test.ok && err != nil {
+			t.Errorf("%+v: %v", test.config, err)
+		}
+		if !test.ok && err == nil {
+			t.Errorf("%+v is valid", test.config)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package chunker
+
+import (
+	"intualai/parser"
+	"regexp"
+	"strings"
+)
+
+func splitFixed(doc *parser.Document, size int, overlap int) []span {
+	return pack(tokenSpans(doc.Text, 0, len(doc.Text)), size, overlap)
+}
+
+// End of a sentence: terminal punctuation (plus closing quotes/brackets)
+// followed by whitespace, or a blank line
+var sentenceEnd = regexp.MustCompile(`[.!?…]+["'”’)\]]*\s+|\n\s*\n`)
+
+func splitSentences(doc *parser.Document, size int, overlap int) []span {
+	return pack(sentenceSpans(doc.Text, 0, len(doc.Text), size), size, overlap)
+}
+
+// sentenceSpans returns a unit per sentence in text[start:end]. Sentences
+// longer than size are broken into tokens.
+func sentenceSpans(text string, start int, end int, size int) []span {
+	var units []span
+
+	add := func(unitStart int, unitEnd int) {
+		tokens := CountTokens(text[unitStart:unitEnd])
+		if tokens == 0 {
+			return
+		}
+		if tokens > size {
+			units = append(units, tokenSpans(text, unitStart, unitEnd)...)
+			return
+		}
+		units = append(units, span{start: unitStart, end: unitEnd, tokens: tokens})
+	}
+
+	sentenceStart := start
+	for _, match := range sentenceEnd.FindAllStringIndex(text[start:end], -1) {
+		add(sentenceStart, start+match[1])
+		sentenceStart = start + match[1]
+	}
+	if sentenceStart < end {
+		add(sentenceStart, end)
+	}
+
+	return units
+}
+
+// From coarsest to finest, the last resort is splitting into tokens
+var separators = []string{"\n\n", "\n", ". ", " "}
+
+func splitRecursive(doc *parser.Document, size int, overlap int) []span {
+	return pack(recursiveSpans(doc.Text, 0, len(doc.Text), size, separators), size, overlap)
+}
+
+// recursiveSpans splits text[start:end] on the first separator, and splits
+// any piece that's still bigger than size on the next one
+func recursiveSpans(text string, start int, end int, size int, separators []string) []span {
+	tokens := CountTokens(text[start:end])
+	if tokens == 0 {
+		return nil
+	}
+	if tokens <= size {
+		return []span{{start: start, end: end, tokens: tokens}}
+	}
+	if len(separators) == 0 {
+		return tokenSpans(text, start, end)
+	}
+
+	separator := separators[0]
+
+	var units []span
+	pieceStart := start
+	for pieceStart < end {
+		// The separator stays at the end of its piece so pieces stay contiguous
+		pieceEnd := end
+		if index := strings.Index(text[pieceStart:end], separator); index >= 0 {
+			pieceEnd = pieceStart + index + len(separator)
+		}
+
+		units = append(units, recursiveSpans(text, pieceStart, pieceEnd, size, separators[1:])...)
+		pieceStart = pieceEnd
+	}
+
+	return units
+}
+
+// splitHeadings chunks each section (heading to the next heading) on its own.
+// Documents without headings are chunked like Recursive.
+func splitHeadings(doc *parser.Document, size int, overlap int) []span {
+	var spans []span
+
+	section := func(start int, end int, title string) {
+		units := recursiveSpans(doc.Text, start, end, size, separators)
+		for _, span := range pack(units, size, overlap) {
+			span.section = title
+			spans = append(spans, span)
+		}
+	}
+
+	start, title := 0, ""
+	for _, heading := range doc.Headings {
+		if heading.Start > start {
+			section(start, heading.Start, title)
+		}
+		start, title = max(start, heading.Start), heading.Title
+	}
+	section(start, len(doc.Text), title)
+
+	return spans
+}
@@ -0,0 +1,37 @@
+package chunker
+
+import (
+	"regexp"
+)
+
+// Words, numbers and individual punctuation marks. Close to (a little under)
+// what BPE tokenizers count for English, without shipping a vocabulary.
+var tokenPattern = regexp.MustCompile(`[\p{L}\p{M}]+|\p{N}+|[^\s\p{L}\p{M}\p{N}]`)
+
+// CountTokens approximates the number of model tokens in text
+func CountTokens(text string) int {
+	return len(tokenPattern.FindAllStringIndex(text, -1))
+}
+
+// tokenSpans returns a unit for every token in text[start:end]. Whitespace
+// after a token belongs to it, so the units cover the whole range.
+func tokenSpans(text string, start int, end int) []span {
+	matches := tokenPattern.FindAllStringIndex(text[start:end], -1)
+
+	units := make([]span, 0, len(matches))
+	for i, match := range matches {
+		unitEnd := end
+		if i+1 < len(matches) {
+			unitEnd = start + matches[i+1][0]
+		}
+
+		unitStart := start + match[0]
+		if i == 0 {
+			unitStart = start
+		}
+
+		units = append(units, span{start: unitStart, end: unitEnd, tokens: 1})
+	}
+
+	return units
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"intualai/conn"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/joho/godotenv"
+	"github.com/rs/zerolog"
+)
+
+// Processes uploaded files: takes jobs off JOB_QUEUE, reads the file from
+// BLOB_STORE and moves it through the processing states
+func main() {
+	// Setup zerolog for structured logging
+	logger := zerolog.New(os.Stdout)
+
+	// Load environment variables from .env.local
+	err := godotenv.Load(".env.local")
+	if err != nil {
+		logger.Error().Msg("Failed to load environment variables from .env.local")
+	}
+	logger.Info().Msg("Successfully loaded environment variables")
+
+	conn.InitDB()
+	logger.Info().Msg("Established connection to database")
+	defer conn.CloseDB()
+
+	conn.InitBlobStore()
+	logger.Info().Msg("Initialized blob store")
+
+	conn.InitJobQueue()
+	logger.Info().Msg("Initialized job queue")
+
+	conn.InitEmbedders()
+	logger.Info().Msg("Initialized embedders")
+
+	conn.InitVectorStore()
+	logger.Info().Msg("Initialized vector store")
+
+	// This is always a separate process from the API
+	conn.CheckSharedBackends(false)
+
+	w := conn.NewWorker()
+
+	// Stop taking jobs on SIGTERM (e.g. ECS stopping the task) and let the
+	// in-flight ones finish
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	w.Run(ctx)
+}
@@ -0,0 +1,108 @@
+package conn
+
+import (
+	"fmt"
+	"intualai/embedding"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+var Embedders *embedding.Registry
+
+// Dimensions of the hashing embedder used for tests and offline development
+const hashEmbeddingDimensions = 384
+
+// Vector sizes of the OpenAI models, anything else needs
+// OPENAI_EMBEDDING_DIMENSIONS
+var openAIEmbeddingDimensions = map[string]int{
+	"text-embedding-3-small": 1536,
+	"text-embedding-3-large": 3072,
+	"text-embedding-ada-002": 1536,
+}
+
+// InitEmbedders registers the embedding providers projects can use. Projects
+// use the model in their settings ("openai/text-embedding-3-large"), or the
+// default model of the provider named by the start of their model_type
+// ("openai-gpt-4o" -> "openai"):
+//
+//   - "openai": any OpenAI compatible API, enabled when OPENAI_API_KEY or
+//     OPENAI_BASE_URL is set. The default model is OPENAI_EMBEDDING_MODEL.
+//   - "hash": deterministic hashing embedder, no network needed. Models are
+//     "fnv-{dimensions}", the default is fnv-384.
+//
+// Model types without a configured provider use openai if it's enabled, hash
+// otherwise. EMBEDDING_PROVIDER forces one provider for every project.
+func InitEmbedders() {
+	fallback := embedding.ProviderHash
+
+	apiKey := os.Getenv("OPENAI_API_KEY")
+	baseUrl := os.Getenv("OPENAI_BASE_URL")
+	openAIEnabled := apiKey != "" || baseUrl != ""
+	if openAIEnabled {
+		fallback = embedding.ProviderOpenAI
+	}
+
+	Embedders = embedding.NewRegistry(fallback)
+	Embedders.Register(embedding.ProviderHash, func(model string) (embedding.Embedder, error) {
+		if model == "" {
+			return embedding.NewHash(hashEmbeddingDimensions), nil
+		}
+
+		dimensions, err := strconv.Atoi(strings.TrimPrefix(model, "fnv-"))
+		if !strings.HasPrefix(model, "fnv-") || err != nil || dimensions < 16 || dimensions > 4096 {
+			return nil, fmt.Errorf("unknown hash embedding model %q, must be fnv-{16 - 4096}", model)
+		}
+		return embedding.NewHash(dimensions), nil
+	})
+
+	if openAIEnabled {
+		if baseUrl == "" {
+			baseUrl = "https://api.openai.com/v1"
+		}
+
+		defaultModel := os.Getenv("OPENAI_EMBEDDING_MODEL")
+		if defaultModel == "" {
+			defaultModel = "text-embedding-3-small"
+		}
+
+		defaultDimensions := openAIEmbeddingDimensions[defaultModel]
+		if value := os.Getenv("OPENAI_EMBEDDING_DIMENSIONS"); value != "" {
+			var err error
+			defaultDimensions, err = strconv.Atoi(value)
+			if err != nil || defaultDimensions < 1 {
+				log.Fatal().Msgf("OPENAI_EMBEDDING_DIMENSIONS must be a positive integer, got %q", value)
+			}
+		}
+		if defaultDimensions == 0 {
+			log.Fatal().Msgf("OPENAI_EMBEDDING_DIMENSIONS must be set for embedding model %q", defaultModel)
+		}
+
+		Embedders.Register(embedding.ProviderOpenAI, func(model string) (embedding.Embedder, error) {
+			if model == "" || model == defaultModel {
+				return embedding.NewOpenAI(baseUrl, apiKey, defaultModel, defaultDimensions), nil
+			}
+
+			dimensions, ok := openAIEmbeddingDimensions[model]
+			if !ok {
+				return nil, fmt.Errorf("unknown OpenAI embedding model %q", model)
+			}
+			return embedding.NewOpenAI(baseUrl, apiKey, model, dimensions), nil
+		})
+	}
+
+	switch provider := os.Getenv("EMBEDDING_PROVIDER"); provider {
+	case "":
+	case embedding.ProviderHash:
+		Embedders.Override(provider)
+	case embedding.ProviderOpenAI:
+		if !openAIEnabled {
+			log.Fatal().Msg("EMBEDDING_PROVIDER=openai requires OPENAI_API_KEY or OPENAI_BASE_URL")
+		}
+		Embedders.Override(provider)
+	default:
+		log.Fatal().Msgf("unknown EMBEDDING_PROVIDER %q, must be openai or hash", provider)
+	}
+}
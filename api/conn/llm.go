@@ -0,0 +1,68 @@
+package conn
+
+import (
+	"intualai/llm"
+	"os"
+
+	"github.com/rs/zerolog/log"
+)
+
+var LLMs *llm.Registry
+
+// InitLLMs registers the LLM providers projects can use. A project uses the
+// provider and model named by its model_type ("openai-gpt-4o" -> gpt-4o from
+// openai):
+//
+//   - "openai": any OpenAI compatible API, enabled when OPENAI_API_KEY or
+//     OPENAI_BASE_URL is set. OPENAI_CHAT_MODEL is used when the model type
+//     doesn't name a model (defaults to gpt-4o-mini).
+//   - "echo": answers with the prompt it was given, no network needed
+//
+// Model types without a configured provider use openai if it's enabled, echo
+// otherwise. LLM_PROVIDER forces one provider for every project.
+func InitLLMs() {
+	fallback := llm.ProviderEcho
+
+	apiKey := os.Getenv("OPENAI_API_KEY")
+	baseUrl := os.Getenv("OPENAI_BASE_URL")
+	openAIEnabled := apiKey != "" || baseUrl != ""
+	if openAIEnabled {
+		fallback = llm.ProviderOpenAI
+	}
+
+	LLMs = llm.NewRegistry(fallback)
+	LLMs.Register(llm.ProviderEcho, func(model string) llm.LLMProvider {
+		return llm.NewEcho("")
+	})
+
+	if openAIEnabled {
+		if baseUrl == "" {
+			baseUrl = "https://api.openai.com/v1"
+		}
+
+		defaultModel := os.Getenv("OPENAI_CHAT_MODEL")
+		if defaultModel == "" {
+			defaultModel = "gpt-4o-mini"
+		}
+
+		LLMs.Register(llm.ProviderOpenAI, func(model string) llm.LLMProvider {
+			if model == "" {
+				model = defaultModel
+			}
+			return llm.NewOpenAI(baseUrl, apiKey, model)
+		})
+	}
+
+	switch provider := os.Getenv("LLM_PROVIDER"); provider {
+	case "":
+	case llm.ProviderEcho:
+		LLMs.Override(provider)
+	case llm.ProviderOpenAI:
+		if !openAIEnabled {
+			log.Fatal().Msg("LLM_PROVIDER=openai requires OPENAI_API_KEY or OPENAI_BASE_URL")
+		}
+		LLMs.Override(provider)
+	default:
+		log.Fatal().Msgf("unknown LLM_PROVIDER %q, must be openai or echo", provider)
+	}
+}
@@ -0,0 +1,56 @@
+package conn
+
+import (
+	"context"
+	"intualai/queue"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// How long a dequeued job stays hidden from other workers before it's retried,
+// unless the worker extends it
+const JobVisibilityTimeout = 5 * time.Minute
+
+var Jobs queue.JobQueue
+
+// How many times a FAILED file can be retried, from FILE_MAX_RETRIES
+var MaxFileRetries = 3
+
+// InitJobQueue picks the job queue backend from JOB_QUEUE:
+//
+//   - "sqs" (default): the QUEUE_URL queue
+//   - "postgres": the jobs table, requires InitDB first
+//   - "memory": in-process only, for tests and the API running the worker
+//     itself (see CheckSharedBackends)
+func InitJobQueue() {
+	var err error
+
+	switch backend := os.Getenv("JOB_QUEUE"); backend {
+	case "", "sqs":
+		queueUrl := os.Getenv("QUEUE_URL")
+		if queueUrl == "" {
+			log.Fatal().Msg("QUEUE_URL environment variable not set")
+		}
+		Jobs, err = queue.NewSQS(context.Background(), queueUrl, JobVisibilityTimeout)
+	case "postgres":
+		Jobs = queue.NewPostgres(Queries, JobVisibilityTimeout)
+	case "memory":
+		Jobs = queue.NewMemory(JobVisibilityTimeout)
+	default:
+		log.Fatal().Msgf("unknown JOB_QUEUE %q, must be sqs, postgres or memory", backend)
+	}
+
+	if err != nil {
+		log.Fatal().Msgf("failed to initialize job queue %v", err)
+	}
+
+	if maxRetries := os.Getenv("FILE_MAX_RETRIES"); maxRetries != "" {
+		MaxFileRetries, err = strconv.Atoi(maxRetries)
+		if err != nil || MaxFileRetries < 0 {
+			log.Fatal().Msgf("FILE_MAX_RETRIES must be a non-negative integer, got %q", maxRetries)
+		}
+	}
+}
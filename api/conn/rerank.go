@@ -0,0 +1,24 @@
+package conn
+
+import (
+	"intualai/rerank"
+	"intualai/retrieval"
+	"os"
+)
+
+var Rerankers map[string]retrieval.Reranker
+
+// InitRerankers sets up the rerankers projects can pick with
+// projects.reranker. lexical and mmr are always available, mmr uses the
+// project's embedder so InitEmbedders has to run first. cross_encoder is
+// enabled by RERANK_URL (RERANK_API_KEY and RERANK_MODEL are optional).
+func InitRerankers() {
+	Rerankers = map[string]retrieval.Reranker{
+		rerank.LexicalName: rerank.NewLexical(),
+		rerank.MMRName:     rerank.NewMMR(Embedders),
+	}
+
+	if rerankUrl := os.Getenv("RERANK_URL"); rerankUrl != "" {
+		Rerankers[rerank.CrossEncoderName] = rerank.NewCrossEncoder(rerankUrl, os.Getenv("RERANK_API_KEY"), os.Getenv("RERANK_MODEL"))
+	}
+}
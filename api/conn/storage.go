@@ -0,0 +1,80 @@
+package conn
+
+import (
+	"context"
+	"intualai/storage"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+var Blobs storage.BlobStore
+
+// Upload limits in bytes, from UPLOAD_MAX_FILE_SIZE and UPLOAD_MAX_REQUEST_SIZE
+var (
+	MaxUploadFileSize    int64 = 100 << 20
+	MaxUploadRequestSize int64 = 500 << 20
+)
+
+// Largest file that can be uploaded straight to the bucket, from
+// UPLOAD_MAX_DIRECT_SIZE
+var MaxDirectUploadSize int64 = 5 << 30
+
+// How long presigned upload URLs work, from UPLOAD_URL_EXPIRY. Pending uploads
+// are removed once their URLs expired and they weren't completed.
+var UploadURLExpiry = time.Hour
+
+// InitBlobStore picks the blob store backend from BLOB_STORE:
+//
+//   - "s3" (default): the UPLOADS_BUCKET_NAME bucket
+//   - "local": a directory on disk, BLOB_LOCAL_DIR (defaults to ./.blobs)
+func InitBlobStore() {
+	var err error
+
+	switch backend := os.Getenv("BLOB_STORE"); backend {
+	case "", "s3":
+		bucket := os.Getenv("UPLOADS_BUCKET_NAME")
+		if bucket == "" {
+			log.Fatal().Msg("UPLOADS_BUCKET_NAME environment variable not set")
+		}
+		Blobs, err = storage.NewS3(context.Background(), bucket)
+	case "local":
+		dir := os.Getenv("BLOB_LOCAL_DIR")
+		if dir == "" {
+			dir = ".blobs"
+		}
+		Blobs, err = storage.NewLocal(dir)
+	default:
+		log.Fatal().Msgf("unknown BLOB_STORE %q, must be s3 or local", backend)
+	}
+
+	if err != nil {
+		log.Fatal().Msgf("failed to initialize blob store %v", err)
+	}
+
+	MaxUploadFileSize = sizeFromEnv("UPLOAD_MAX_FILE_SIZE", MaxUploadFileSize)
+	MaxUploadRequestSize = sizeFromEnv("UPLOAD_MAX_REQUEST_SIZE", MaxUploadRequestSize)
+	MaxDirectUploadSize = sizeFromEnv("UPLOAD_MAX_DIRECT_SIZE", MaxDirectUploadSize)
+
+	if expiry := os.Getenv("UPLOAD_URL_EXPIRY"); expiry != "" {
+		UploadURLExpiry, err = time.ParseDuration(expiry)
+		if err != nil || UploadURLExpiry <= 0 || UploadURLExpiry > 7*24*time.Hour {
+			log.Fatal().Msgf("UPLOAD_URL_EXPIRY must be a duration up to 7 days, got %q", expiry)
+		}
+	}
+}
+
+func sizeFromEnv(name string, fallback int64) int64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size <= 0 {
+		log.Fatal().Msgf("%s must be a positive number of bytes, got %q", name, value)
+	}
+	return size
+}
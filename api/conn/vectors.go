@@ -0,0 +1,31 @@
+package conn
+
+import (
+	"intualai/vectorstore"
+	"os"
+
+	"github.com/rs/zerolog/log"
+)
+
+var Vectors vectorstore.VectorStore
+
+// InitVectorStore picks where chunk embeddings are searched from VECTOR_STORE:
+//
+//   - "qdrant" (default): the Qdrant server at QDRANT_URL (defaults to
+//     http://localhost:6333), QDRANT_API_KEY if it's secured
+//   - "memory": in-process only, for tests and the API running the worker
+//     itself (see CheckSharedBackends)
+func InitVectorStore() {
+	switch backend := os.Getenv("VECTOR_STORE"); backend {
+	case "", "qdrant":
+		qdrantUrl := os.Getenv("QDRANT_URL")
+		if qdrantUrl == "" {
+			qdrantUrl = "http://localhost:6333"
+		}
+		Vectors = vectorstore.NewQdrant(qdrantUrl, os.Getenv("QDRANT_API_KEY"))
+	case "memory":
+		Vectors = vectorstore.NewMemory()
+	default:
+		log.Fatal().Msgf("unknown VECTOR_STORE %q, must be qdrant or memory", backend)
+	}
+}
@@ -0,0 +1,55 @@
+package conn
+
+import (
+	"intualai/parser"
+	"intualai/queue"
+	"intualai/vectorstore"
+	"intualai/worker"
+	"os"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+)
+
+// NewWorker builds the file processing worker from the other connections,
+// WORKER_CONCURRENCY sets how many files it processes at once. Needs InitDB,
+// InitBlobStore, InitJobQueue, InitEmbedders and InitVectorStore first.
+func NewWorker() *worker.Worker {
+	pipeline := worker.NewPipeline(DBPool, Queries, Embedders, Vectors)
+	// Compressed streams of files can't expand to more than a few times
+	// what an upload may be
+	pipeline.Parsers.Register(parser.PDF, parser.NewPDFParser(4*MaxUploadFileSize))
+
+	w := worker.New(DBPool, Queries, Jobs, Blobs, pipeline)
+	w.Visibility = JobVisibilityTimeout
+	// The first delivery doesn't count as a retry
+	w.MaxAttempts = MaxFileRetries + 1
+
+	if concurrency := os.Getenv("WORKER_CONCURRENCY"); concurrency != "" {
+		var err error
+		w.Concurrency, err = strconv.Atoi(concurrency)
+		if err != nil || w.Concurrency < 1 {
+			log.Fatal().Msgf("WORKER_CONCURRENCY must be a positive integer, got %q", concurrency)
+		}
+	}
+
+	return w
+}
+
+// CheckSharedBackends refuses to start if the API and worker would end up
+// with their own, separate job queue or vector store. The memory backends
+// only exist inside one process, they only work with inProcess, when the API
+// runs the worker itself (RUN_WORKER=true). Otherwise jobs are never picked
+// up and search never sees the worker's vectors.
+func CheckSharedBackends(inProcess bool) {
+	if inProcess {
+		return
+	}
+
+	if _, ok := Jobs.(*queue.MemoryQueue); ok {
+		log.Fatal().Msg("JOB_QUEUE=memory only works with RUN_WORKER=true, use postgres or sqs with a separate worker")
+	}
+	if _, ok := Vectors.(*vectorstore.Memory); ok {
+		log.Fatal().Msg("VECTOR_STORE=memory only works with RUN_WORKER=true, use qdrant with a separate worker")
+	}
+}
@@ -0,0 +1,133 @@
+package embedding
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Embedder turns text into vectors
+type Embedder interface {
+	// Embed returns one vector per text, in order. len(texts) must not be more
+	// than MaxBatchSize, use EmbedAll for arbitrary amounts.
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+	// Length of every vector this embedder returns
+	Dimensions() int
+	// Identifies the provider and model, e.g. "openai/text-embedding-3-small".
+	// Stored with every vector, vectors from different models can't be compared.
+	Model() string
+	MaxBatchSize() int
+}
+
+// EmbedAll embeds texts in batches of e.MaxBatchSize()
+func EmbedAll(ctx context.Context, e Embedder, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(texts))
+
+	for start := 0; start < len(texts); start += e.MaxBatchSize() {
+		end := min(start+e.MaxBatchSize(), len(texts))
+
+		batch, err := e.Embed(ctx, texts[start:end])
+		if err != nil {
+			return nil, err
+		}
+		if len(batch) != end-start {
+			return nil, fmt.Errorf("%s returned %d vectors for %d texts", e.Model(), len(batch), end-start)
+		}
+
+		vectors = append(vectors, batch...)
+	}
+
+	return vectors, nil
+}
+
+// Provider names, the part of a project's model_type before the first "-"
+// (e.g. "openai-gpt-4o" uses "openai")
+const (
+	ProviderOpenAI = "openai"
+	ProviderHash   = "hash"
+)
+
+// Factory returns the provider's embedder for model (the part of the model ID
+// after "/"), or its default model if it's empty
+type Factory func(model string) (Embedder, error)
+
+// Registry picks the embedder for a project, from its embedding model setting
+// or its model_type
+type Registry struct {
+	factories map[string]Factory
+	// Used for model types without a registered provider (including empty)
+	fallback string
+	// If set, every project uses this provider's default model
+	override string
+
+	mu        sync.Mutex
+	embedders map[string]Embedder
+}
+
+// NewRegistry returns an empty registry. fallback is the provider used for
+// model types that don't match any registered provider.
+func NewRegistry(fallback string) *Registry {
+	return &Registry{factories: map[string]Factory{}, fallback: fallback, embedders: map[string]Embedder{}}
+}
+
+func (r *Registry) Register(provider string, factory Factory) {
+	r.factories[provider] = factory
+}
+
+// Override makes every project use provider, e.g. the hashing embedder when
+// developing offline
+func (r *Registry) Override(provider string) {
+	r.override = provider
+}
+
+// ForModelType returns the default embedder of the provider named by a
+// project's model_type
+func (r *Registry) ForModelType(modelType string) (Embedder, error) {
+	provider, _, _ := strings.Cut(modelType, "-")
+	if _, ok := r.factories[provider]; !ok {
+		provider = r.fallback
+	}
+
+	return r.get(provider, "")
+}
+
+// Resolve returns the embedder for a model ID (e.g.
+// "openai/text-embedding-3-large"), or the model_type's default if model is
+// empty
+func (r *Registry) Resolve(model string, modelType string) (Embedder, error) {
+	if model == "" {
+		return r.ForModelType(modelType)
+	}
+
+	provider, name, _ := strings.Cut(model, "/")
+	return r.get(provider, name)
+}
+
+// get returns (and caches) provider's embedder for model
+func (r *Registry) get(provider string, model string) (Embedder, error) {
+	if r.override != "" && r.override != provider {
+		provider, model = r.override, ""
+	}
+
+	factory, ok := r.factories[provider]
+	if !ok {
+		return nil, fmt.Errorf("no embedding provider %q configured", provider)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := provider + "/" + model
+	if embedder, ok := r.embedders[key]; ok {
+		return embedder, nil
+	}
+
+	embedder, err := factory(model)
+	if err != nil {
+		return nil, err
+	}
+
+	r.embedders[key] = embedder
+	return embedder, nil
+}
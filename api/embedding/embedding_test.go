@@ -0,0 +1,153 @@
+package embedding
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func dot(a []float32, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
+
+func TestHashEmbedder(t *testing.T) {
+	e := NewHash(256)
+	ctx := context.Background()
+
+	texts := []string{
+		"The invoice is due at the end of the month",
+		"the INVOICE is due at the end of the month!",
+		"The invoice is due at the end of the year",
+		"Penguins swim in cold water",
+		"",
+	}
+	vectors, err := e.Embed(ctx, texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, vector := range vectors {
+		if len(vector) != 256 {
+			t.Fatalf("vector %d has %d dimensions, want 256", i, len(vector))
+		}
+		norm := math.Sqrt(dot(vector, vector))
+		if texts[i] != "" && math.Abs(norm-1) > 1e-5 {
+			t.Errorf("vector %d has norm %f, want 1", i, norm)
+		}
+	}
+
+	// Case and punctuation don't matter
+	if !reflect.DeepEqual(vectors[0], vectors[1]) {
+		t.Error("same words embedded differently")
+	}
+	if similar, unrelated := dot(vectors[0], vectors[2]), dot(vectors[0], vectors[3]); similar <= unrelated {
+		t.Errorf("shared words scored %f, not above unrelated text at %f", similar, unrelated)
+	}
+	if norm := dot(vectors[4], vectors[4]); norm != 0 {
+		t.Errorf("empty text has norm %f, want 0", norm)
+	}
+
+	// Deterministic across calls and instances
+	again, err := NewHash(256).Embed(ctx, texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again, vectors) {
+		t.Error("embedding the same texts again gave different vectors")
+	}
+}
+
+// batchEmbedder records the batch sizes it's called with
+type batchEmbedder struct {
+	*HashEmbedder
+	batches []int
+}
+
+func (e *batchEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	e.batches = append(e.batches, len(texts))
+	return e.HashEmbedder.Embed(ctx, texts)
+}
+
+func (e *batchEmbedder) MaxBatchSize() int {
+	return 2
+}
+
+func TestEmbedAll(t *testing.T) {
+	e := &batchEmbedder{HashEmbedder: NewHash(16)}
+
+	vectors, err := EmbedAll(context.Background(), e, []string{"a", "b", "c", "d", "e"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vectors) != 5 {
+		t.Fatalf("got %d vectors, want 5", len(vectors))
+	}
+	if !reflect.DeepEqual(e.batches, []int{2, 2, 1}) {
+		t.Errorf("batches = %v, want [2 2 1]", e.batches)
+	}
+}
+
+func TestRegistryResolve(t *testing.T) {
+	newRegistry := func() *Registry {
+		r := NewRegistry(ProviderHash)
+		r.Register(ProviderHash, func(model string) (Embedder, error) {
+			if model == "" {
+				return NewHash(64), nil
+			}
+			return NewHash(32), nil
+		})
+		r.Register(ProviderOpenAI, func(model string) (Embedder, error) {
+			return NewHash(1536), nil
+		})
+		return r
+	}
+
+	tests := []struct {
+		name       string
+		model      string
+		modelType  string
+		override   string
+		dimensions int
+		err        bool
+	}{
+		{name: "model type", modelType: "openai-gpt-4o", dimensions: 1536},
+		{name: "unknown model type falls back", modelType: "anthropic-claude", dimensions: 64},
+		{name: "empty model type falls back", dimensions: 64},
+		{name: "model wins over model type", model: "hash/fnv-32", modelType: "openai-gpt-4o", dimensions: 32},
+		{name: "unknown provider", model: "cohere/embed", err: true},
+		{name: "override", model: "openai/text-embedding-3-small", override: ProviderHash, dimensions: 64},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := newRegistry()
+			if test.override != "" {
+				r.Override(test.override)
+			}
+
+			embedder, err := r.Resolve(test.model, test.modelType)
+			if test.err {
+				if err == nil {
+					t.Fatalf("resolved %s, want an error", embedder.Model())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if embedder.Dimensions() != test.dimensions {
+				t.Errorf("resolved %d dimensions, want %d", embedder.Dimensions(), test.dimensions)
+			}
+
+			// Embedders are cached
+			if again, _ := r.Resolve(test.model, test.modelType); again != embedder {
+				t.Error("resolving again made a new embedder")
+			}
+		})
+	}
+}
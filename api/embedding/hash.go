@@ -0,0 +1,83 @@
+package embedding
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"regexp"
+	"strings"
+)
+
+var hashTokenPattern = regexp.MustCompile(`[\p{L}\p{M}\p{N}]+`)
+
+// HashEmbedder is a deterministic embedder that needs no model or network:
+// words and word pairs are hashed into a fixed number of dimensions. Texts that
+// share words end up close together, which is enough for tests and offline
+// development, but it knows nothing about meaning.
+type HashEmbedder struct {
+	dimensions int
+}
+
+func NewHash(dimensions int) *HashEmbedder {
+	return &HashEmbedder{dimensions: dimensions}
+}
+
+func (e *HashEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = e.embed(text)
+	}
+	return vectors, nil
+}
+
+func (e *HashEmbedder) embed(text string) []float32 {
+	vector := make([]float32, e.dimensions)
+
+	words := hashTokenPattern.FindAllString(strings.ToLower(text), -1)
+	for i, word := range words {
+		e.add(vector, word, 1)
+		if i > 0 {
+			e.add(vector, words[i-1]+" "+word, 0.5)
+		}
+	}
+
+	var norm float64
+	for _, value := range vector {
+		norm += float64(value) * float64(value)
+	}
+	if norm == 0 {
+		return vector
+	}
+
+	norm = math.Sqrt(norm)
+	for i := range vector {
+		vector[i] = float32(float64(vector[i]) / norm)
+	}
+	return vector
+}
+
+// add hashes feature into a dimension, the hash also picks the sign so
+// collisions cancel out instead of piling up
+func (e *HashEmbedder) add(vector []float32, feature string, weight float32) {
+	h := fnv.New64a()
+	h.Write([]byte(feature))
+	sum := h.Sum64()
+
+	if sum>>63 == 1 {
+		weight = -weight
+	}
+	vector[sum%uint64(e.dimensions)] += weight
+}
+
+func (e *HashEmbedder) Dimensions() int {
+	return e.dimensions
+}
+
+func (e *HashEmbedder) Model() string {
+	return fmt.Sprintf("%s/fnv-%d", ProviderHash, e.dimensions)
+}
+
+func (e *HashEmbedder) MaxBatchSize() int {
+	return 1024
+}
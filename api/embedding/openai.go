@@ -0,0 +1,139 @@
+package embedding
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OpenAIEmbedder calls an OpenAI compatible /embeddings endpoint. Anything that
+// speaks the same API works by changing the base URL (Azure, Ollama, vLLM,
+// LocalAI, a local stub...)
+type OpenAIEmbedder struct {
+	baseUrl    string
+	apiKey     string
+	model      string
+	dimensions int
+	client     *http.Client
+}
+
+// NewOpenAI returns an embedder for model. dimensions must match what the
+// model returns, it's also sent to the API for models that can shorten their
+// vectors (text-embedding-3-*).
+func NewOpenAI(baseUrl string, apiKey string, model string, dimensions int) *OpenAIEmbedder {
+	return &OpenAIEmbedder{
+		baseUrl:    strings.TrimSuffix(baseUrl, "/"),
+		apiKey:     apiKey,
+		model:      model,
+		dimensions: dimensions,
+		client:     &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+type openAIEmbeddingRequest struct {
+	Model      string   `json:"model"`
+	Input      []string `json:"input"`
+	Dimensions int      `json:"dimensions,omitempty"`
+}
+
+type openAIEmbeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+// Number of attempts for rate limited or failed requests
+const openAIAttempts = 3
+
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	request := openAIEmbeddingRequest{Model: e.model, Input: texts}
+	if strings.HasPrefix(e.model, "text-embedding-3") {
+		request.Dimensions = e.dimensions
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	var response openAIEmbeddingResponse
+	for attempt := 1; ; attempt++ {
+		retry, err := e.post(ctx, body, &response)
+		if err == nil {
+			break
+		}
+		if !retry || attempt == openAIAttempts {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Duration(attempt) * 2 * time.Second):
+		}
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, item := range response.Data {
+		if item.Index < 0 || item.Index >= len(texts) {
+			return nil, fmt.Errorf("embedding response has out of range index %d", item.Index)
+		}
+		if len(item.Embedding) != e.dimensions {
+			return nil, fmt.Errorf("%s returned %d dimensions, expected %d", e.Model(), len(item.Embedding), e.dimensions)
+		}
+		vectors[item.Index] = item.Embedding
+	}
+
+	for i, vector := range vectors {
+		if vector == nil {
+			return nil, fmt.Errorf("embedding response is missing text %d", i)
+		}
+	}
+
+	return vectors, nil
+}
+
+// post sends one request, reporting whether a failure is worth retrying
+func (e *OpenAIEmbedder) post(ctx context.Context, body []byte, response *openAIEmbeddingResponse) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.baseUrl+"/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.apiKey)
+	}
+
+	res, err := e.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		retry := res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500
+		return retry, fmt.Errorf("embedding request failed with %s: %s", res.Status, message)
+	}
+
+	return false, json.NewDecoder(res.Body).Decode(response)
+}
+
+func (e *OpenAIEmbedder) Dimensions() int {
+	return e.dimensions
+}
+
+func (e *OpenAIEmbedder) Model() string {
+	return ProviderOpenAI + "/" + e.model
+}
+
+// OpenAI accepts up to 2048 inputs, stay well under the token limit per request
+func (e *OpenAIEmbedder) MaxBatchSize() int {
+	return 128
+}
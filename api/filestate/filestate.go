@@ -0,0 +1,200 @@
+package filestate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"intualai/gen"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// State is a file's files.process_state
+type State string
+
+const (
+	// Created with an upload URL, the content isn't in the bucket yet
+	PendingUpload State = "PENDING_UPLOAD"
+	Uploaded      State = "UPLOADED"
+	Queued        State = "QUEUED"
+	Processing    State = "PROCESSING"
+	Failed        State = "FAILED"
+	Succeeded     State = "SUCCEEDED"
+	Cancelled     State = "CANCELLED"
+)
+
+// Actor for transitions made by the processing worker. Transitions made
+// through the API use the caller instead (user:{id} or api_key:{id}).
+const ActorWorker = "worker"
+
+// Legal transitions, anything not listed here is rejected. SUCCEEDED is final,
+// only Reprocess takes a file out of it.
+var transitions = map[State][]State{
+	PendingUpload: {Uploaded},
+	Uploaded:      {Queued},
+	Queued:        {Processing, Cancelled},
+	Processing:    {Succeeded, Failed, Cancelled},
+	Failed:        {Queued},
+	Cancelled:     {Queued},
+}
+
+// ErrIllegalTransition is returned for transitions the state machine doesn't allow
+var ErrIllegalTransition = errors.New("illegal file state transition")
+
+// ErrConflict is returned when the file left the expected state before the
+// transition could be applied, i.e. someone else changed it first
+var ErrConflict = errors.New("file state changed concurrently")
+
+// Valid reports whether s is one of the states above
+func (s State) Valid() bool {
+	switch s {
+	case PendingUpload, Uploaded, Queued, Processing, Failed, Succeeded, Cancelled:
+		return true
+	}
+	return false
+}
+
+// CanTransitionTo reports whether a file in s may move to to
+func (s State) CanTransitionTo(to State) bool {
+	for _, next := range transitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Transition is a single state change and why it happened
+type Transition struct {
+	ProjectID pgtype.UUID
+	FileName  string
+	From      State
+	To        State
+	Actor     string
+	Reason    string
+	// If set, the file also has to still belong to this job (files.job_id).
+	// The worker sets it, so a job that was replaced while it ran can't move
+	// the file the newer job is working on.
+	JobID pgtype.Text
+}
+
+// Apply moves a file from t.From to t.To and records it in file_events.
+// The update is compare-and-set, if the file isn't in t.From anymore (or
+// doesn't belong to t.JobID) nothing changes and ErrConflict is returned.
+//
+// queries should be bound to a transaction (Queries.WithTx) so the state
+// change and its event are committed together.
+func Apply(ctx context.Context, queries *gen.Queries, t Transition) (gen.File, error) {
+	if !t.From.CanTransitionTo(t.To) {
+		return gen.File{}, fmt.Errorf("%w: %s to %s", ErrIllegalTransition, t.From, t.To)
+	}
+
+	return apply(ctx, queries, t)
+}
+
+// Reprocess queues a SUCCEEDED file again, e.g. after the project's chunking
+// or embedding settings changed. It isn't one of the transitions above, so
+// processing or retrying a file can't do it by accident. Like Apply it's
+// compare-and-set and recorded in file_events.
+func Reprocess(ctx context.Context, queries *gen.Queries, projectId pgtype.UUID, fileName string, actor string, reason string) (gen.File, error) {
+	return apply(ctx, queries, Transition{
+		ProjectID: projectId,
+		FileName:  fileName,
+		From:      Succeeded,
+		To:        Queued,
+		Actor:     actor,
+		Reason:    reason,
+	})
+}
+
+// apply makes the change without checking it against transitions
+func apply(ctx context.Context, queries *gen.Queries, t Transition) (gen.File, error) {
+	file, err := queries.UpdateFileState(ctx, gen.UpdateFileStateParams{
+		ToState:   string(t.To),
+		ProjectID: t.ProjectID,
+		FileName:  t.FileName,
+		FromState: string(t.From),
+		JobID:     t.JobID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return gen.File{}, ErrConflict
+	}
+	if err != nil {
+		return gen.File{}, err
+	}
+
+	err = queries.CreateFileEvent(ctx, gen.CreateFileEventParams{
+		ProjectID: t.ProjectID,
+		FileName:  t.FileName,
+		FromState: pgtype.Text{String: string(t.From), Valid: true},
+		ToState:   string(t.To),
+		Actor:     t.Actor,
+		Reason:    t.Reason,
+	})
+	if err != nil {
+		return gen.File{}, err
+	}
+
+	return file, nil
+}
+
+// Move applies a transition from whatever state the file is in right now.
+// If the transition isn't legal, the file is returned as-is along with
+// ErrIllegalTransition so callers can tell the caller why.
+//
+// Returns pgx.ErrNoRows if the file doesn't exist.
+func Move(ctx context.Context, queries *gen.Queries, projectId pgtype.UUID, fileName string, to State, actor string, reason string) (gen.File, error) {
+	file, err := queries.GetFile(ctx, gen.GetFileParams{
+		ProjectID: projectId,
+		FileName:  fileName,
+	})
+	if err != nil {
+		return gen.File{}, err
+	}
+
+	from := State(file.ProcessState)
+	if !from.CanTransitionTo(to) {
+		return file, fmt.Errorf("%w: %s to %s", ErrIllegalTransition, from, to)
+	}
+
+	return Apply(ctx, queries, Transition{
+		ProjectID: projectId,
+		FileName:  fileName,
+		From:      from,
+		To:        to,
+		Actor:     actor,
+		Reason:    reason,
+	})
+}
+
+// Created records the first event of a newly created file, UPLOADED or
+// PENDING_UPLOAD
+func Created(ctx context.Context, queries *gen.Queries, file gen.File, actor string) error {
+	reason := "Uploaded"
+	if State(file.ProcessState) == PendingUpload {
+		reason = "Upload URL created"
+	}
+
+	return queries.CreateFileEvent(ctx, gen.CreateFileEventParams{
+		ProjectID: file.ProjectID,
+		FileName:  file.FileName,
+		ToState:   file.ProcessState,
+		Actor:     actor,
+		Reason:    reason,
+	})
+}
+
+// Versioned records that a file's content was replaced by a new version,
+// which starts over as UPLOADED. It isn't a transition, the file can be in
+// any state that isn't busy with the old content (see routes.newVersion).
+func Versioned(ctx context.Context, queries *gen.Queries, from State, file gen.File, actor string, reason string) error {
+	return queries.CreateFileEvent(ctx, gen.CreateFileEventParams{
+		ProjectID: file.ProjectID,
+		FileName:  file.FileName,
+		FromState: pgtype.Text{String: string(from), Valid: true},
+		ToState:   file.ProcessState,
+		Actor:     actor,
+		Reason:    reason,
+	})
+}
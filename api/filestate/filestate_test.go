@@ -0,0 +1,50 @@
+package filestate
+
+import "testing"
+
+var states = []State{PendingUpload, Uploaded, Queued, Processing, Failed, Succeeded, Cancelled}
+
+func TestCanTransitionTo(t *testing.T) {
+	allowed := map[[2]State]bool{
+		{PendingUpload, Uploaded}: true,
+		{Uploaded, Queued}:        true,
+		{Queued, Processing}:      true,
+		{Queued, Cancelled}:       true,
+		{Processing, Succeeded}:   true,
+		{Processing, Failed}:      true,
+		{Processing, Cancelled}:   true,
+		{Failed, Queued}:          true,
+		{Cancelled, Queued}:       true,
+	}
+
+	// Every pair, so adding a transition without updating the table fails
+	for _, from := range states {
+		for _, to := range states {
+			want := allowed[[2]State{from, to}]
+			if got := from.CanTransitionTo(to); got != want {
+				t.Errorf("%s -> %s allowed = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+}
+
+func TestUnknownStates(t *testing.T) {
+	tests := []State{"", "DONE", "queued"}
+
+	for _, state := range tests {
+		if state.Valid() {
+			t.Errorf("%q is valid", state)
+		}
+		for _, other := range states {
+			if state.CanTransitionTo(other) || other.CanTransitionTo(state) {
+				t.Errorf("%q can transition to or from %s", state, other)
+			}
+		}
+	}
+
+	for _, state := range states {
+		if !state.Valid() {
+			t.Errorf("%s isn't valid", state)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package llm
+
+import (
+	"context"
+	"strings"
+)
+
+// EchoProvider answers without a model, for tests and offline development.
+// It returns Answer if set, otherwise the last user message, so callers can
+// see exactly what was sent.
+type EchoProvider struct {
+	Answer string
+}
+
+func NewEcho(answer string) *EchoProvider {
+	return &EchoProvider{Answer: answer}
+}
+
+func (p *EchoProvider) Complete(ctx context.Context, request Request) (Response, error) {
+	content := p.Answer
+	if content == "" {
+		for _, message := range request.Messages {
+			if message.Role == RoleUser {
+				content = message.Content
+			}
+		}
+	}
+
+	// Word counts stand in for tokens
+	prompt := 0
+	for _, message := range request.Messages {
+		prompt += len(strings.Fields(message.Content))
+	}
+	completion := len(strings.Fields(content))
+
+	return Response{
+		Content: content,
+		Usage: Usage{
+			PromptTokens:     prompt,
+			CompletionTokens: completion,
+			TotalTokens:      prompt + completion,
+		},
+	}, nil
+}
+
+// Stream sends the answer a word at a time
+func (p *EchoProvider) Stream(ctx context.Context, request Request, onDelta func(delta string) error) (Response, error) {
+	response, err := p.Complete(ctx, request)
+	if err != nil {
+		return Response{}, err
+	}
+
+	for _, delta := range strings.SplitAfter(response.Content, " ") {
+		if err := ctx.Err(); err != nil {
+			return Response{}, err
+		}
+		if delta == "" {
+			continue
+		}
+		if err := onDelta(delta); err != nil {
+			return Response{}, err
+		}
+	}
+
+	return response, nil
+}
+
+func (p *EchoProvider) Model() string {
+	return ProviderEcho + "/echo"
+}
@@ -0,0 +1,117 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Message roles
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type Request struct {
+	Messages    []Message
+	Temperature float64
+	// 0 leaves it up to the provider
+	MaxTokens int
+}
+
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type Response struct {
+	Content string
+	Usage   Usage
+}
+
+// LLMProvider generates answers from a chat model
+type LLMProvider interface {
+	Complete(ctx context.Context, request Request) (Response, error)
+	// Stream is Complete, but calls onDelta with each piece of the answer as
+	// it's generated. An error from onDelta stops the stream and is returned.
+	// Cancelling ctx cancels the upstream request.
+	Stream(ctx context.Context, request Request, onDelta func(delta string) error) (Response, error)
+	// Identifies the provider and model, e.g. "openai/gpt-4o-mini"
+	Model() string
+}
+
+// Provider names, the part of a project's model_type before the first "-".
+// The rest is the model, e.g. "openai-gpt-4o" is gpt-4o from openai.
+const (
+	ProviderOpenAI = "openai"
+	ProviderEcho   = "echo"
+)
+
+// Factory returns a provider for model. model is empty when the model type
+// didn't name one, the factory should pick its default.
+type Factory func(model string) LLMProvider
+
+// Registry picks the LLM for a project from its model_type
+type Registry struct {
+	factories map[string]Factory
+	// Used for model types without a registered provider (including empty)
+	fallback string
+	// If set, every project uses this provider regardless of model_type
+	override string
+}
+
+// NewRegistry returns an empty registry. fallback is the provider used for
+// model types that don't match any registered provider.
+func NewRegistry(fallback string) *Registry {
+	return &Registry{factories: map[string]Factory{}, fallback: fallback}
+}
+
+func (r *Registry) Register(provider string, factory Factory) {
+	r.factories[provider] = factory
+}
+
+// Override makes every project use provider's default model
+func (r *Registry) Override(provider string) {
+	r.override = provider
+}
+
+// ForModelType returns the LLM for a project's model_type
+func (r *Registry) ForModelType(modelType string) (LLMProvider, error) {
+	provider, model, _ := strings.Cut(modelType, "-")
+	if _, ok := r.factories[provider]; !ok {
+		provider, model = r.fallback, ""
+	}
+
+	return r.get(provider, model)
+}
+
+// Resolve returns the LLM for a model ID (e.g. "openai/gpt-4o"), or the
+// model_type's if model is empty
+func (r *Registry) Resolve(model string, modelType string) (LLMProvider, error) {
+	if model == "" {
+		return r.ForModelType(modelType)
+	}
+
+	provider, name, _ := strings.Cut(model, "/")
+	return r.get(provider, name)
+}
+
+func (r *Registry) get(provider string, model string) (LLMProvider, error) {
+	if r.override != "" && r.override != provider {
+		provider, model = r.override, ""
+	}
+
+	factory, ok := r.factories[provider]
+	if !ok {
+		return nil, fmt.Errorf("no LLM provider %q configured", provider)
+	}
+
+	return factory(model), nil
+}
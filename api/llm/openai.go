@@ -0,0 +1,178 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OpenAIProvider calls an OpenAI compatible /chat/completions endpoint
+// (OpenAI, Azure, Ollama, vLLM, a local stub...)
+type OpenAIProvider struct {
+	baseUrl string
+	apiKey  string
+	model   string
+	client  *http.Client
+}
+
+func NewOpenAI(baseUrl string, apiKey string, model string) *OpenAIProvider {
+	return &OpenAIProvider{
+		baseUrl: strings.TrimSuffix(baseUrl, "/"),
+		apiKey:  apiKey,
+		model:   model,
+		// Answers can take a while, callers cancel through the context
+		client: &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+type openAIChatRequest struct {
+	Model         string               `json:"model"`
+	Messages      []Message            `json:"messages"`
+	Temperature   float64              `json:"temperature"`
+	MaxTokens     int                  `json:"max_tokens,omitempty"`
+	Stream        bool                 `json:"stream,omitempty"`
+	StreamOptions *openAIStreamOptions `json:"stream_options,omitempty"`
+}
+
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type openAIChatResponse struct {
+	Choices []struct {
+		Message Message `json:"message"`
+	} `json:"choices"`
+	Usage Usage `json:"usage"`
+}
+
+// One server-sent event of a streamed completion. The last one has no
+// choices, only usage.
+type openAIChatChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+	} `json:"choices"`
+	Usage *Usage `json:"usage"`
+}
+
+func (p *OpenAIProvider) Complete(ctx context.Context, request Request) (Response, error) {
+	res, err := p.post(ctx, openAIChatRequest{
+		Model:       p.model,
+		Messages:    request.Messages,
+		Temperature: request.Temperature,
+		MaxTokens:   request.MaxTokens,
+	})
+	if err != nil {
+		return Response{}, err
+	}
+	defer res.Body.Close()
+
+	var body openAIChatResponse
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return Response{}, err
+	}
+	if len(body.Choices) == 0 {
+		return Response{}, errors.New("chat completion returned no choices")
+	}
+
+	return Response{Content: body.Choices[0].Message.Content, Usage: body.Usage}, nil
+}
+
+func (p *OpenAIProvider) Stream(ctx context.Context, request Request, onDelta func(delta string) error) (Response, error) {
+	res, err := p.post(ctx, openAIChatRequest{
+		Model:         p.model,
+		Messages:      request.Messages,
+		Temperature:   request.Temperature,
+		MaxTokens:     request.MaxTokens,
+		Stream:        true,
+		StreamOptions: &openAIStreamOptions{IncludeUsage: true},
+	})
+	if err != nil {
+		return Response{}, err
+	}
+	defer res.Body.Close()
+
+	var response Response
+	var content strings.Builder
+
+	scanner := bufio.NewScanner(res.Body)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk openAIChatChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return Response{}, err
+		}
+
+		if chunk.Usage != nil {
+			response.Usage = *chunk.Usage
+		}
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+
+		delta := chunk.Choices[0].Delta.Content
+		content.WriteString(delta)
+		if err := onDelta(delta); err != nil {
+			return Response{}, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Response{}, err
+	}
+
+	response.Content = content.String()
+	return response, nil
+}
+
+// post sends a chat completion request, returning the response if it was
+// successful. Callers must close the body.
+func (p *OpenAIProvider) post(ctx context.Context, request any) (*http.Response, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseUrl+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return nil, fmt.Errorf("chat completion failed with %s: %s", res.Status, message)
+	}
+
+	return res, nil
+}
+
+func (p *OpenAIProvider) Model() string {
+	return ProviderOpenAI + "/" + p.model
+}
@@ -2,11 +2,20 @@ package main
 
 import (
 	"context"
+	"errors"
 	"intualai/conn"
 	"intualai/gen"
+	"intualai/outbox"
+	"intualai/roles"
 	"intualai/routes"
+	"intualai/uploads"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/clerkinc/clerk-sdk-go/clerk"
 	"github.com/joho/godotenv"
@@ -32,6 +41,67 @@ func main() {
 	logger.Info().Msg("Established connection to database")
 	defer conn.CloseDB()
 
+	// Connect to wherever uploaded files are stored (S3 or a local directory)
+	conn.InitBlobStore()
+	logger.Info().Msg("Initialized blob store")
+
+	// Connect to the queue that file processing jobs are sent through
+	conn.InitJobQueue()
+	logger.Info().Msg("Initialized job queue")
+
+	// Connect to the vector store, deleting a project deletes its vectors
+	conn.InitVectorStore()
+	logger.Info().Msg("Initialized vector store")
+
+	// Search queries are embedded with the same models as the chunks
+	conn.InitEmbedders()
+	logger.Info().Msg("Initialized embedders")
+
+	// Optional second stage of search, picked per project
+	conn.InitRerankers()
+	logger.Info().Msg("Initialized rerankers")
+
+	// Chat models that answer queries
+	conn.InitLLMs()
+	logger.Info().Msg("Initialized LLM providers")
+
+	// Process files in the API itself, next to or instead of cmd/worker. The
+	// memory job queue and vector store need it.
+	runWorker := os.Getenv("RUN_WORKER") == "true"
+	conn.CheckSharedBackends(runWorker)
+
+	// Stop on SIGTERM (e.g. ECS stopping the task): requests in flight and the
+	// background loops' current batch get to finish
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var background sync.WaitGroup
+
+	// Publish jobs written to the outbox table (e.g. by ProcessFile) to the queue
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		outbox.NewRelay(conn.DBPool, conn.Queries, conn.Jobs).Run(ctx)
+	}()
+	logger.Info().Msg("Started outbox relay")
+
+	// Remove direct uploads that were never completed
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		uploads.NewExpirer(conn.Queries, conn.Blobs).Run(ctx)
+	}()
+	logger.Info().Msg("Started upload expirer")
+
+	if runWorker {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			conn.NewWorker().Run(ctx)
+		}()
+		logger.Info().Msg("Started worker")
+	}
+
 	// Initialize Echo web framework
 	e := echo.New()
 
@@ -66,6 +136,11 @@ func main() {
 		KeyLookup:  "header:" + echo.HeaderAuthorization,
 		AuthScheme: "Bearer",
 		Validator: func(key string, c echo.Context) (bool, error) {
+			// Project API keys are checked against our own database, not Clerk
+			if strings.HasPrefix(key, routes.ApiKeyPrefix) {
+				return routes.ValidateApiKey(key, c)
+			}
+
 			// Check if it's a test key for development
 			if key == "test-key" {
 				c.Set("userId", "user_2jRfvOhhMBfHM5C85C1q3Ze1Ron")
@@ -155,31 +230,83 @@ func main() {
 		})
 	})
 
-	// Group for project-related routes
-	projectsGroup := e.Group("/projects")
+	// Group for project-related routes. ProjectPermission resolves the caller's
+	// role on :project_id, and every project route declares what the role needs
+	// to be able to do (see roles.Role)
+	projectsGroup := e.Group("/projects", routes.ProjectPermission)
+	canView := routes.Require(roles.Role.CanView)
+	canEdit := routes.Require(roles.Role.CanEdit)
+
 	projectsGroup.GET("/", routes.GetAllProjects)
 	projectsGroup.POST("/", routes.CreateProject)
-	projectsGroup.DELETE("/:project_id", routes.DeleteProject)
-	projectsGroup.GET("/:project_id", routes.GetProjectByID)
-	projectsGroup.PATCH("/:project_id", routes.UpdateProjectDetails)
-	projectsGroup.POST("/:project_id/invite", routes.InviteUserToProject)
-	projectsGroup.GET("/:project_id/permissions", routes.CheckUserPermission)
-	projectsGroup.GET("/:project_id/members", routes.GetProjectMembers)
-	projectsGroup.DELETE("/:project_id/members/:member_id", routes.DeleteUserFromProject)
-	projectsGroup.PATCH("/:project_id/members/:member_id/permission", routes.ChangeUserPermission)
-
-	projectsGroup.GET("/:project_id/files", routes.GetAllFiles)
-	projectsGroup.POST("/:project_id/files", routes.UploadFile)
-	projectsGroup.POST("/:project_id/files/:file_name/process", routes.ProcessFile)
-
-	projectsGroup.GET("/:project_id/files", routes.GetAllFiles)
-	projectsGroup.POST("/:project_id/files", routes.UploadFile)
-	projectsGroup.POST("/:project_id/files/:file_name/process", routes.ProcessFile)
+	projectsGroup.DELETE("/:project_id", routes.DeleteProject, routes.RequireUser, routes.Require(roles.Role.CanDelete))
+	projectsGroup.GET("/:project_id", routes.GetProjectByID, canView)
+	projectsGroup.PATCH("/:project_id", routes.UpdateProjectDetails, canEdit)
+	projectsGroup.GET("/:project_id/settings", routes.GetProjectSettings, canView)
+	projectsGroup.PUT("/:project_id/settings", routes.PutProjectSettings, canEdit)
+	projectsGroup.GET("/:project_id/settings/versions", routes.GetProjectSettingsVersions, canView)
+	projectsGroup.POST("/:project_id/invite", routes.InviteUserToProject, routes.RequireUser, routes.Require(roles.Role.CanInvite))
+	projectsGroup.GET("/:project_id/permissions", routes.CheckUserPermission, routes.RequireUser, canView)
+	projectsGroup.GET("/:project_id/members", routes.GetProjectMembers, routes.RequireUser, canEdit)
+	projectsGroup.DELETE("/:project_id/members/:member_id", routes.DeleteUserFromProject, routes.RequireUser, routes.Require(roles.Role.CanRemoveMembers))
+	projectsGroup.PATCH("/:project_id/members/:member_id/permission", routes.ChangeUserPermission, routes.RequireUser, canEdit)
+
+	projectsGroup.GET("/:project_id/api-keys", routes.GetAllApiKeys, routes.RequireUser, canEdit)
+	projectsGroup.POST("/:project_id/api-keys", routes.CreateApiKey, routes.RequireUser, canEdit)
+	projectsGroup.DELETE("/:project_id/api-keys/:key_id", routes.DeleteApiKey, routes.RequireUser, canEdit)
+
+	projectsGroup.GET("/:project_id/files", routes.GetAllFiles, canView)
+	projectsGroup.POST("/:project_id/files", routes.UploadFile, canEdit)
+	projectsGroup.POST("/:project_id/files/upload-url", routes.CreateUploadURL, canEdit)
+	projectsGroup.POST("/:project_id/files/:file_name/complete", routes.CompleteUpload, canEdit)
+	projectsGroup.GET("/:project_id/files/:file_name", routes.GetFile, canView)
+	projectsGroup.GET("/:project_id/files/:file_name/content", routes.DownloadFile, canView)
+	projectsGroup.PATCH("/:project_id/files/:file_name", routes.RenameFile, canEdit)
+	projectsGroup.DELETE("/:project_id/files/:file_name", routes.DeleteFile, canEdit)
+	projectsGroup.POST("/:project_id/files/:file_name/process", routes.ProcessFile, canEdit)
+	projectsGroup.POST("/:project_id/files/:file_name/cancel", routes.CancelFile, canEdit)
+	projectsGroup.POST("/:project_id/files/:file_name/retry", routes.RetryFile, canEdit)
+	projectsGroup.POST("/:project_id/files/:file_name/reprocess", routes.ReprocessFile, canEdit)
+	projectsGroup.GET("/:project_id/files/:file_name/events", routes.GetFileEvents, canView)
+	projectsGroup.GET("/:project_id/files/:file_name/versions", routes.GetFileVersions, canView)
+	projectsGroup.POST("/:project_id/files/:file_name/versions/:version/restore", routes.RestoreFileVersion, canEdit)
+
+	projectsGroup.POST("/:project_id/search", routes.Search, canView)
+	projectsGroup.POST("/:project_id/query", routes.Query, canView)
+	projectsGroup.POST("/:project_id/query/stream", routes.QueryStream, canView)
+
+	// Chat sessions are only visible to the user or API key that created them
+	projectsGroup.GET("/:project_id/sessions", routes.GetChatSessions, canView)
+	projectsGroup.POST("/:project_id/sessions", routes.CreateChatSession, canView)
+	projectsGroup.GET("/:project_id/sessions/:session_id", routes.GetChatSession, canView)
+	projectsGroup.PATCH("/:project_id/sessions/:session_id", routes.RenameChatSession, canView)
+	projectsGroup.DELETE("/:project_id/sessions/:session_id", routes.DeleteChatSession, canView)
+	projectsGroup.POST("/:project_id/sessions/:session_id/messages", routes.SendChatMessage, canView)
 
 	// Group for user-related routes
 	usersGroup := e.Group("/users")
 	usersGroup.POST("/", routes.CreateUser)
 
 	// Start the Echo web server on port 8080
-	e.Logger.Fatal(e.Start(":8080"))
+	go func() {
+		if err := e.Start(":8080"); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			e.Logger.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	logger.Info().Msg("Shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		logger.Err(err).Msg("Failed to shut down server gracefully")
+	}
+	background.Wait()
+
+	logger.Info().Msg("Stopped")
 }
+
+// How long requests in flight get to finish on shutdown
+const shutdownTimeout = 30 * time.Second
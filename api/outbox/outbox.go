@@ -0,0 +1,149 @@
+package outbox
+
+import (
+	"context"
+	"intualai/gen"
+	"intualai/queue"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+// Write adds a message to the outbox. queries must be bound to the same
+// transaction as the state change the message belongs to (Queries.WithTx), so
+// either both are committed or neither is.
+//
+// Returns false if an unpublished message with the same dedupeKey is already
+// waiting, in which case nothing is written.
+func Write(ctx context.Context, queries *gen.Queries, dedupeKey string, payload []byte) (bool, error) {
+	written, err := queries.InsertOutboxMessage(ctx, gen.InsertOutboxMessageParams{
+		DedupeKey: dedupeKey,
+		Payload:   payload,
+	})
+	return written > 0, err
+}
+
+// Pending returns the payload of the unpublished message with dedupeKey, e.g.
+// the one that made Write return false. Returns pgx.ErrNoRows if there isn't
+// one (anymore).
+func Pending(ctx context.Context, queries *gen.Queries, dedupeKey string) ([]byte, error) {
+	return queries.GetPendingOutboxMessage(ctx, dedupeKey)
+}
+
+// Discard deletes the unpublished message with dedupeKey, if there is one.
+// Returns false if there wasn't, e.g. because it was already published.
+func Discard(ctx context.Context, queries *gen.Queries, dedupeKey string) (bool, error) {
+	deleted, err := queries.DeletePendingOutboxMessage(ctx, dedupeKey)
+	return deleted > 0, err
+}
+
+// Relay publishes outbox messages to the job queue. Messages are only marked
+// as published after the queue accepted them, so a crash in between means
+// they're sent again (at-least-once). Several API instances can run a relay at
+// once, rows are claimed with SELECT ... FOR UPDATE SKIP LOCKED.
+type Relay struct {
+	pool    *pgxpool.Pool
+	queries *gen.Queries
+	jobs    queue.JobQueue
+
+	pollInterval time.Duration
+	batchSize    int32
+	// Published messages are kept around this long for debugging
+	retention time.Duration
+}
+
+func NewRelay(pool *pgxpool.Pool, queries *gen.Queries, jobs queue.JobQueue) *Relay {
+	return &Relay{
+		pool:         pool,
+		queries:      queries,
+		jobs:         jobs,
+		pollInterval: time.Second,
+		batchSize:    50,
+		retention:    24 * time.Hour,
+	}
+}
+
+// Run relays messages until ctx is cancelled. A batch that's being published
+// when it is gets to finish, so no message is cut off half way.
+func (r *Relay) Run(ctx context.Context) {
+	lastCleanup := time.Time{}
+	batchCtx := context.WithoutCancel(ctx)
+
+	for ctx.Err() == nil {
+		published, err := r.relayBatch(batchCtx)
+		if err != nil && ctx.Err() == nil {
+			log.Err(err).Msg("Failed to relay outbox messages")
+		}
+
+		if time.Since(lastCleanup) > time.Hour {
+			r.cleanup(batchCtx)
+			lastCleanup = time.Now()
+		}
+
+		// A full batch probably means there's more waiting, keep going
+		if err == nil && published == int(r.batchSize) {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.pollInterval):
+		}
+	}
+}
+
+func (r *Relay) relayBatch(ctx context.Context) (int, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := r.queries.WithTx(tx)
+
+	messages, err := qtx.ClaimOutboxMessages(ctx, r.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	published := 0
+	for _, message := range messages {
+		if publishErr := r.jobs.Enqueue(ctx, message.Payload); publishErr != nil {
+			log.Err(publishErr).Int64("id", message.ID).Msg("Failed to publish outbox message")
+
+			err := qtx.MarkOutboxFailed(ctx, gen.MarkOutboxFailedParams{
+				ID:        message.ID,
+				LastError: pgtype.Text{String: publishErr.Error(), Valid: true},
+			})
+			if err != nil {
+				return published, err
+			}
+			continue
+		}
+
+		if err := qtx.MarkOutboxPublished(ctx, message.ID); err != nil {
+			return published, err
+		}
+		published++
+	}
+
+	return published, tx.Commit(ctx)
+}
+
+func (r *Relay) cleanup(ctx context.Context) {
+	deleted, err := r.queries.DeletePublishedOutboxMessages(ctx, pgtype.Timestamp{
+		Time:  time.Now().UTC().Add(-r.retention),
+		Valid: true,
+	})
+	if err != nil {
+		log.Err(err).Msg("Failed to clean up published outbox messages")
+		return
+	}
+
+	if deleted > 0 {
+		log.Info().Int64("deleted", deleted).Msg("Cleaned up published outbox messages")
+	}
+}
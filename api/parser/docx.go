@@ -0,0 +1,169 @@
+package parser
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const wordNamespace = "http://schemas.openxmlformats.org/wordprocessingml/2006/main"
+
+// docxParser reads word/document.xml. Paragraph styles give us headings
+// (Title, Heading1-9), w:tbl gives us tables.
+type docxParser struct{}
+
+func (docxParser) Parse(data []byte) (*Document, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	var documentXml *zip.File
+	for _, file := range archive.File {
+		if file.Name == "word/document.xml" {
+			documentXml = file
+			break
+		}
+	}
+	if documentXml == nil {
+		return nil, errors.New("word/document.xml not found")
+	}
+
+	reader, err := documentXml.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	doc := &Document{}
+	var t textBuilder
+
+	var (
+		paragraph  strings.Builder
+		style      string
+		inText     bool
+		tableDepth int
+		rows       [][]string
+		row        []string
+		cell       []string
+	)
+
+	decoder := xml.NewDecoder(reader)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			if token.Name.Space != wordNamespace {
+				continue
+			}
+
+			switch token.Name.Local {
+			case "p":
+				paragraph.Reset()
+				style = ""
+			case "pStyle":
+				style = wordAttr(token, "val")
+			case "t":
+				inText = true
+			case "tab":
+				paragraph.WriteByte(' ')
+			case "br", "cr":
+				paragraph.WriteByte('\n')
+			case "tbl":
+				tableDepth++
+				if tableDepth == 1 {
+					rows = nil
+				}
+			case "tr":
+				if tableDepth == 1 {
+					row = nil
+				}
+			case "tc":
+				if tableDepth == 1 {
+					cell = nil
+				}
+			}
+
+		case xml.CharData:
+			if inText {
+				paragraph.Write(token)
+			}
+
+		case xml.EndElement:
+			if token.Name.Space != wordNamespace {
+				continue
+			}
+
+			switch token.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				text := paragraph.String()
+				if tableDepth > 0 {
+					cell = append(cell, text)
+				} else if level := wordHeadingLevel(style); level > 0 {
+					t.writeHeading(doc, level, text)
+				} else {
+					t.Paragraph()
+					t.WriteText(text)
+					t.Paragraph()
+				}
+			case "tc":
+				if tableDepth == 1 {
+					row = append(row, strings.Join(strings.Fields(strings.Join(cell, " ")), " "))
+				}
+			case "tr":
+				if tableDepth == 1 && len(row) > 0 {
+					rows = append(rows, row)
+				}
+			case "tbl":
+				tableDepth--
+				if tableDepth == 0 {
+					t.writeTable(doc, rows)
+				}
+			}
+		}
+	}
+
+	return t.Document(doc), nil
+}
+
+func wordAttr(element xml.StartElement, name string) string {
+	for _, attr := range element.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// wordHeadingLevel returns the heading level for a paragraph style ID, or 0
+// if it isn't a heading. Style IDs are "Title", "Heading1", "Heading2" etc.
+// in English Word, some generators use "heading 1".
+func wordHeadingLevel(style string) int {
+	style = strings.ToLower(strings.ReplaceAll(style, " ", ""))
+
+	if style == "title" {
+		return 1
+	}
+
+	if level, ok := strings.CutPrefix(style, "heading"); ok {
+		n, err := strconv.Atoi(level)
+		if err == nil && n >= 1 {
+			return min(n, 6)
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,164 @@
+package parser
+
+import (
+	"bytes"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Elements whose content is never text the user wrote
+var skippedElements = map[atom.Atom]bool{
+	atom.Head:     true,
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Noscript: true,
+	atom.Template: true,
+	atom.Svg:      true,
+	atom.Iframe:   true,
+	atom.Button:   true,
+	atom.Select:   true,
+}
+
+// Elements that start a new block of text
+var blockElements = map[atom.Atom]bool{
+	atom.P:          true,
+	atom.Div:        true,
+	atom.Section:    true,
+	atom.Article:    true,
+	atom.Main:       true,
+	atom.Header:     true,
+	atom.Footer:     true,
+	atom.Aside:      true,
+	atom.Nav:        true,
+	atom.Blockquote: true,
+	atom.Pre:        true,
+	atom.Ul:         true,
+	atom.Ol:         true,
+	atom.Li:         true,
+	atom.Dl:         true,
+	atom.Dt:         true,
+	atom.Dd:         true,
+	atom.Figure:     true,
+	atom.Figcaption: true,
+	atom.Address:    true,
+	atom.Form:       true,
+	atom.Hr:         true,
+}
+
+var headingLevels = map[atom.Atom]int{
+	atom.H1: 1,
+	atom.H2: 2,
+	atom.H3: 3,
+	atom.H4: 4,
+	atom.H5: 5,
+	atom.H6: 6,
+}
+
+type htmlParser struct{}
+
+func (htmlParser) Parse(data []byte) (*Document, error) {
+	root, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &Document{}
+	var t textBuilder
+	walkHTML(root, doc, &t)
+
+	return t.Document(doc), nil
+}
+
+func walkHTML(n *html.Node, doc *Document, t *textBuilder) {
+	switch n.Type {
+	case html.TextNode:
+		t.WriteText(n.Data)
+		return
+	case html.ElementNode:
+		if skippedElements[n.DataAtom] {
+			return
+		}
+
+		if level, ok := headingLevels[n.DataAtom]; ok {
+			t.writeHeading(doc, level, htmlText(n))
+			return
+		}
+
+		switch n.DataAtom {
+		case atom.Table:
+			t.writeTable(doc, htmlTableRows(n))
+			return
+		case atom.Br:
+			t.Line()
+			return
+		case atom.Td, atom.Th:
+			t.Space()
+		}
+
+		if blockElements[n.DataAtom] {
+			t.Paragraph()
+			defer t.Paragraph()
+		}
+	}
+
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		walkHTML(child, doc, t)
+	}
+}
+
+// htmlText is the text inside n, with whitespace collapsed
+func htmlText(n *html.Node) string {
+	var b strings.Builder
+
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && skippedElements[n.DataAtom] {
+			return
+		}
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+			b.WriteByte(' ')
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// htmlTableRows returns the table's rows, nested tables end up flattened into
+// the cell that contains them
+func htmlTableRows(table *html.Node) [][]string {
+	var rows [][]string
+
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != html.ElementNode {
+				continue
+			}
+
+			switch child.DataAtom {
+			case atom.Thead, atom.Tbody, atom.Tfoot:
+				walk(child)
+			case atom.Tr:
+				var row []string
+				for cell := child.FirstChild; cell != nil; cell = cell.NextSibling {
+					if cell.DataAtom == atom.Td || cell.DataAtom == atom.Th {
+						row = append(row, htmlText(cell))
+					}
+				}
+				if len(row) > 0 {
+					rows = append(rows, row)
+				}
+			}
+		}
+	}
+	walk(table)
+
+	return rows
+}
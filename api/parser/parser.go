@@ -0,0 +1,195 @@
+package parser
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// Supported MIME types
+const (
+	PDF      = "application/pdf"
+	DOCX     = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	HTML     = "text/html"
+	Markdown = "text/markdown"
+	CSV      = "text/csv"
+	Text     = "text/plain"
+)
+
+// Document is a parsed file: its text, normalized to plain UTF-8 with \n line
+// endings and blank lines between blocks, plus the structure we could find.
+// All offsets are byte offsets into Text.
+type Document struct {
+	MIMEType string    `json:"mime_type"`
+	Text     string    `json:"text"`
+	Pages    []Page    `json:"pages,omitempty"`
+	Headings []Heading `json:"headings,omitempty"`
+	Tables   []Table   `json:"tables,omitempty"`
+}
+
+// Page is the part of Document.Text that came from one page (PDF only)
+type Page struct {
+	Number int `json:"number"`
+	Start  int `json:"start"`
+	End    int `json:"end"`
+}
+
+type Heading struct {
+	// 1 for a title / h1, up to 6
+	Level int    `json:"level"`
+	Title string `json:"title"`
+	Start int    `json:"start"`
+}
+
+// Table is rendered into Document.Text between Start and End, one row per
+// line with cells separated by " | "
+type Table struct {
+	Start int        `json:"start"`
+	End   int        `json:"end"`
+	Rows  [][]string `json:"rows"`
+}
+
+// PageAt returns the page number offset falls on, or 0 if the document has no
+// pages
+func (d *Document) PageAt(offset int) int {
+	for _, page := range d.Pages {
+		if offset < page.End {
+			return page.Number
+		}
+	}
+	if len(d.Pages) > 0 {
+		return d.Pages[len(d.Pages)-1].Number
+	}
+	return 0
+}
+
+// Parser turns the raw contents of one kind of file into a Document
+type Parser interface {
+	Parse(data []byte) (*Document, error)
+}
+
+// UnsupportedError is returned for files none of the registered parsers handle
+type UnsupportedError struct {
+	FileName string
+	MIMEType string
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("unsupported file type %s (%s), supported types are PDF, DOCX, HTML, Markdown, CSV and plain text", e.MIMEType, e.FileName)
+}
+
+// ErrNoText is returned when a file was parsed but didn't contain any text,
+// e.g. a scanned PDF
+var ErrNoText = errors.New("file contains no extractable text")
+
+// Registry picks a parser for each file based on its detected MIME type
+type Registry struct {
+	parsers map[string]Parser
+}
+
+// NewRegistry returns a registry with a parser for every supported type
+func NewRegistry() *Registry {
+	r := &Registry{parsers: map[string]Parser{}}
+	r.Register(PDF, pdfParser{})
+	r.Register(DOCX, docxParser{})
+	r.Register(HTML, htmlParser{})
+	r.Register(Markdown, markdownParser{})
+	r.Register(CSV, csvParser{})
+	r.Register(Text, textParser{})
+	return r
+}
+
+// Register adds or replaces the parser for mimeType
+func (r *Registry) Register(mimeType string, parser Parser) {
+	r.parsers[mimeType] = parser
+}
+
+// Parse detects the file's type and parses it with the matching parser
+func (r *Registry) Parse(fileName string, data []byte) (doc *Document, err error) {
+	mimeType := Detect(fileName, data)
+
+	parser, ok := r.parsers[mimeType]
+	if !ok {
+		return nil, &UnsupportedError{FileName: fileName, MIMEType: mimeType}
+	}
+
+	// Parsers deal with untrusted input, don't let a malformed file take the
+	// worker down with it
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			doc = nil
+			err = fmt.Errorf("failed to parse %s as %s: %v", fileName, mimeType, recovered)
+		}
+	}()
+
+	doc, err = parser.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s as %s: %w", fileName, mimeType, err)
+	}
+
+	if strings.TrimSpace(doc.Text) == "" {
+		return nil, fmt.Errorf("%s: %w", fileName, ErrNoText)
+	}
+
+	doc.MIMEType = mimeType
+	return doc, nil
+}
+
+// Detect returns the MIME type of a file. Magic bytes win, the file extension
+// is only used to tell apart text formats that look the same (Markdown, CSV).
+func Detect(fileName string, data []byte) string {
+	head := data
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+
+	if bytes.Contains(head, []byte("%PDF-")) {
+		return PDF
+	}
+
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		if isDocx(data) {
+			return DOCX
+		}
+		return "application/zip"
+	}
+
+	mimeType, _, err := mime.ParseMediaType(http.DetectContentType(data))
+	if err != nil {
+		return "application/octet-stream"
+	}
+
+	if mimeType != Text {
+		return mimeType
+	}
+
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".md", ".markdown":
+		return Markdown
+	case ".csv":
+		return CSV
+	case ".html", ".htm":
+		return HTML
+	}
+
+	return Text
+}
+
+func isDocx(data []byte) bool {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return false
+	}
+
+	for _, file := range archive.File {
+		if file.Name == "word/document.xml" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,292 @@
+package parser
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func fixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// zipped builds a zip archive holding files
+func zipped(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileName string
+		data     []byte
+		want     string
+	}{
+		{name: "pdf", fileName: "report.pdf", data: fixture(t, "sample.pdf"), want: PDF},
+		{name: "pdf without extension", fileName: "report", data: fixture(t, "sample.pdf"), want: PDF},
+		// Some writers put junk before the header, readers look at the first 1024 bytes
+		{name: "pdf after junk", fileName: "report", data: append(bytes.Repeat([]byte{' '}, 512), "%PDF-1.7\n"...), want: PDF},
+		{name: "pdf header too late", fileName: "report.txt", data: append(bytes.Repeat([]byte{' '}, 1024), "%PDF-1.7\n"...), want: Text},
+		{name: "docx", fileName: "report.docx", data: fixture(t, "sample.docx"), want: DOCX},
+		{name: "docx without extension", fileName: "report", data: fixture(t, "sample.docx"), want: DOCX},
+		{name: "other zip", fileName: "report.docx", data: zipped(t, map[string]string{"word/other.xml": "<x/>"}), want: "application/zip"},
+		{name: "html", fileName: "index.html", data: fixture(t, "sample.html"), want: HTML},
+		{name: "html by content", fileName: "index.txt", data: fixture(t, "sample.html"), want: HTML},
+		{name: "html by extension", fileName: "index.htm", data: []byte("Just text"), want: HTML},
+		{name: "markdown", fileName: "README.md", data: fixture(t, "sample.md"), want: Markdown},
+		{name: "markdown long extension", fileName: "README.Markdown", data: fixture(t, "sample.md"), want: Markdown},
+		{name: "csv", fileName: "growth.csv", data: fixture(t, "sample.csv"), want: CSV},
+		{name: "text", fileName: "notes.txt", data: fixture(t, "sample.txt"), want: Text},
+		{name: "text without extension", fileName: "notes", data: fixture(t, "sample.txt"), want: Text},
+		// Magic bytes win over the extension
+		{name: "text named pdf", fileName: "report.pdf", data: []byte("Not a PDF"), want: Text},
+		{name: "png named csv", fileName: "growth.csv", data: []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), want: "image/png"},
+		{name: "binary", fileName: "notes.txt", data: []byte{0x00, 0x01, 0x02, 0xff}, want: "application/octet-stream"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Detect(test.fileName, test.data); got != test.want {
+				t.Errorf("Detect(%q) = %s, want %s", test.fileName, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	table := []Table{{Start: 49, End: 75, Rows: [][]string{{"Region", "Growth"}, {"EMEA", "12%"}}}}
+	heading := []Heading{{Level: 1, Title: "Quarterly report"}}
+
+	tests := []struct {
+		fileName string
+		mimeType string
+		text     string
+		pages    []Page
+		headings []Heading
+		tables   []Table
+	}{
+		{
+			fileName: "sample.pdf",
+			mimeType: PDF,
+			text:     "Quarterly report\nRevenue grew in every region.",
+			pages:    []Page{{Number: 1, Start: 0, End: 46}},
+		},
+		{
+			fileName: "sample.docx",
+			mimeType: DOCX,
+			text:     "Quarterly report\n\nRevenue grew in every region.\n\nRegion | Growth\nEMEA | 12%",
+			headings: heading,
+			tables:   table,
+		},
+		{
+			// <head>, <style> and <script> aren't text
+			fileName: "sample.html",
+			mimeType: HTML,
+			text:     "Quarterly report\n\nRevenue grew in every region.\n\nRegion | Growth\nEMEA | 12%",
+			headings: heading,
+			tables:   table,
+		},
+		{
+			// Markdown is kept as written, the structure is found on top
+			fileName: "sample.md",
+			mimeType: Markdown,
+			text:     "# Quarterly report\n\nRevenue grew in every region.\n\n| Region | Growth |\n| ------ | ------ |\n| EMEA   | 12%    |",
+			headings: heading,
+			tables:   []Table{{Start: 51, End: 110, Rows: [][]string{{"Region", "Growth"}, {"EMEA", "12%"}}}},
+		},
+		{
+			// Rows are written out with their header so each one makes sense on its own
+			fileName: "sample.csv",
+			mimeType: CSV,
+			text:     "Region: EMEA; Growth: 12%\nRegion: Americas, North; Growth: 9%",
+			tables:   []Table{{Start: 0, End: 61, Rows: [][]string{{"Region", "Growth"}, {"EMEA", "12%"}, {"Americas, North", "9%"}}}},
+		},
+		{
+			fileName: "sample.txt",
+			mimeType: Text,
+			text:     "Quarterly report\n\nRevenue grew in every region.",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.fileName, func(t *testing.T) {
+			doc, err := NewRegistry().Parse(test.fileName, fixture(t, test.fileName))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if doc.MIMEType != test.mimeType {
+				t.Errorf("MIME type = %s, want %s", doc.MIMEType, test.mimeType)
+			}
+			if doc.Text != test.text {
+				t.Errorf("text = %q, want %q", doc.Text, test.text)
+			}
+			if !reflect.DeepEqual(doc.Pages, test.pages) {
+				t.Errorf("pages = %+v, want %+v", doc.Pages, test.pages)
+			}
+			if !reflect.DeepEqual(doc.Headings, test.headings) {
+				t.Errorf("headings = %+v, want %+v", doc.Headings, test.headings)
+			}
+			if !reflect.DeepEqual(doc.Tables, test.tables) {
+				t.Errorf("tables = %+v, want %+v", doc.Tables, test.tables)
+			}
+		})
+	}
+}
+
+func TestParseUnsupported(t *testing.T) {
+	tests := []struct {
+		fileName string
+		data     []byte
+	}{
+		{fileName: "image.png", data: []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")},
+		{fileName: "archive.zip", data: zipped(t, map[string]string{"notes.txt": "hello"})},
+		{fileName: "blob.bin", data: []byte{0x00, 0x01, 0x02, 0xff}},
+	}
+
+	for _, test := range tests {
+		_, err := NewRegistry().Parse(test.fileName, test.data)
+		var unsupported *UnsupportedError
+		if !errors.As(err, &unsupported) {
+			t.Errorf("Parse(%q) error = %v, want an UnsupportedError", test.fileName, err)
+		}
+	}
+}
+
+func TestParseNoText(t *testing.T) {
+	// Streams that don't decode are skipped, like a page that's only an image
+	pdf := fixture(t, "sample.pdf")
+	streamStart := bytes.Index(pdf, []byte("stream\n")) + len("stream\n")
+	garbled := bytes.Clone(pdf)
+	copy(garbled[streamStart:], "garbage!")
+
+	tests := []struct {
+		fileName string
+		data     []byte
+	}{
+		{fileName: "empty.txt", data: []byte("  \n\n\t")},
+		{fileName: "garbled.pdf", data: garbled},
+		{fileName: "empty.html", data: []byte("<html><head><title>Title only</title></head><body><script>x()</script></body></html>")},
+		{fileName: "empty.docx", data: zipped(t, map[string]string{"word/document.xml": `<w:document xmlns:w="` + wordNamespace + `"><w:body/></w:document>`})},
+	}
+
+	for _, test := range tests {
+		if _, err := NewRegistry().Parse(test.fileName, test.data); !errors.Is(err, ErrNoText) {
+			t.Errorf("Parse(%q) error = %v, want ErrNoText", test.fileName, err)
+		}
+	}
+}
+
+// Uploads are untrusted, broken files have to fail cleanly. The parsers are
+// called directly so a panic isn't hidden by Registry.Parse recovering it.
+func TestParseCorrupt(t *testing.T) {
+	pdf := fixture(t, "sample.pdf")
+	docx := fixture(t, "sample.docx")
+
+	tests := []struct {
+		name   string
+		parser Parser
+		data   []byte
+	}{
+		{name: "empty pdf", parser: pdfParser{}, data: nil},
+		{name: "pdf header only", parser: pdfParser{}, data: []byte("%PDF-1.4\n")},
+		{name: "pdf cut in the page tree", parser: pdfParser{}, data: pdf[:bytes.Index(pdf, []byte("3 0 obj"))]},
+		{name: "pdf with unclosed dictionaries", parser: pdfParser{}, data: []byte("%PDF-1.4\n1 0 obj\n<< /Type /Catalog /Pages << /Kids [ <<\n")},
+		{name: "pdf with reference loop", parser: pdfParser{}, data: []byte("%PDF-1.4\n1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n2 0 obj\n<< /Type /Pages /Kids [2 0 R] >>\nendobj\ntrailer\n<< /Root 1 0 R >>\n")},
+		{name: "encrypted pdf", parser: pdfParser{}, data: append(bytes.Clone(pdf), "trailer\n<< /Root 1 0 R /Encrypt << /Filter /Standard >> >>\n"...)},
+		{name: "empty docx", parser: docxParser{}, data: nil},
+		{name: "docx cut in half", parser: docxParser{}, data: docx[:len(docx)/2]},
+		{name: "docx without document.xml", parser: docxParser{}, data: zipped(t, map[string]string{"word/styles.xml": "<x/>"})},
+		{name: "docx with broken xml", parser: docxParser{}, data: zipped(t, map[string]string{"word/document.xml": `<w:document xmlns:w="` + wordNamespace + `"><w:body><w:p>`})},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doc, err := test.parser.Parse(test.data)
+			if err == nil {
+				t.Errorf("parsed into %q, want an error", doc.Text)
+			}
+		})
+	}
+}
+
+// Every prefix of the fixtures, none of them may panic
+func TestParseTruncated(t *testing.T) {
+	tests := []struct {
+		fileName string
+		parser   Parser
+	}{
+		{fileName: "sample.pdf", parser: pdfParser{}},
+		{fileName: "sample.docx", parser: docxParser{}},
+		{fileName: "sample.html", parser: htmlParser{}},
+		{fileName: "sample.md", parser: markdownParser{}},
+		{fileName: "sample.csv", parser: csvParser{}},
+		{fileName: "sample.txt", parser: textParser{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.fileName, func(t *testing.T) {
+			data := fixture(t, test.fileName)
+			for n := range data {
+				func() {
+					defer func() {
+						if recovered := recover(); recovered != nil {
+							t.Fatalf("panicked on the first %d bytes: %v", n, recovered)
+						}
+					}()
+					test.parser.Parse(data[:n])
+				}()
+			}
+		})
+	}
+}
+
+func TestPageAt(t *testing.T) {
+	doc := Document{Pages: []Page{{Number: 1, Start: 0, End: 10}, {Number: 2, Start: 12, End: 20}}}
+
+	tests := []struct {
+		offset int
+		want   int
+	}{
+		{offset: 0, want: 1},
+		{offset: 9, want: 1},
+		{offset: 10, want: 2},
+		{offset: 19, want: 2},
+		// Past the end is still on the last page
+		{offset: 25, want: 2},
+	}
+
+	for _, test := range tests {
+		if got := doc.PageAt(test.offset); got != test.want {
+			t.Errorf("PageAt(%d) = %d, want %d", test.offset, got, test.want)
+		}
+	}
+
+	if got := (&Document{}).PageAt(5); got != 0 {
+		t.Errorf("PageAt without pages = %d, want 0", got)
+	}
+}
@@ -0,0 +1,1184 @@
+package parser
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// pdfParser extracts text from the page content streams. It handles the common
+// cases (Flate compressed streams, object streams, ToUnicode CMaps, form
+// XObjects) but not encrypted files or OCR of scanned pages.
+type pdfParser struct {
+	// How much all of a file's compressed streams may inflate to together,
+	// 0 means DefaultMaxDecompressedSize
+	maxDecompressedSize int64
+}
+
+// DefaultMaxDecompressedSize is the decompression budget of the PDF parser
+// NewRegistry registers
+const DefaultMaxDecompressedSize int64 = 4 * 100 << 20
+
+// ErrTooLarge is returned for files whose content decompresses to more than
+// the parser's budget
+var ErrTooLarge = errors.New("decompressed content is too large")
+
+// NewPDFParser returns a PDF parser whose compressed streams may inflate to
+// maxDecompressedSize bytes in total. A small crafted file can decompress into
+// gigabytes, going over fails the file with ErrTooLarge instead.
+func NewPDFParser(maxDecompressedSize int64) Parser {
+	return pdfParser{maxDecompressedSize: maxDecompressedSize}
+}
+
+func (p pdfParser) Parse(data []byte) (*Document, error) {
+	budget := p.maxDecompressedSize
+	if budget <= 0 {
+		budget = DefaultMaxDecompressedSize
+	}
+
+	file := loadPDF(data, budget)
+	if file.err != nil {
+		return nil, file.err
+	}
+	if file.encrypted() {
+		return nil, errors.New("encrypted PDFs aren't supported")
+	}
+
+	pages := file.pages()
+	if len(pages) == 0 {
+		return nil, errors.New("no pages found")
+	}
+
+	doc := &Document{}
+	var t textBuilder
+
+	for i, page := range pages {
+		t.Paragraph()
+		start := t.Len()
+
+		text := file.text(file.contents(page.dict), page.resources, 0)
+		for _, line := range strings.Split(text, "\n") {
+			t.WriteText(line)
+			t.Line()
+		}
+
+		doc.Pages = append(doc.Pages, Page{Number: i + 1, Start: start, End: t.Len()})
+	}
+
+	// Streams that fail to decode are skipped, except for this one
+	if file.err != nil {
+		return nil, file.err
+	}
+
+	return t.Document(doc), nil
+}
+
+// PDF object model. Numbers are float64, strings are the raw bytes.
+type (
+	pdfName    string
+	pdfKeyword string
+	pdfString  string
+	pdfArray   []any
+	pdfDict    map[pdfName]any
+	pdfRef     struct{ num int }
+)
+
+type pdfObject struct {
+	value any
+	// Raw (still encoded) stream data, nil if the object isn't a stream
+	stream []byte
+}
+
+type pdfFile struct {
+	objects  map[int]pdfObject
+	trailers []pdfDict
+	fonts    map[int]*pdfFont
+	// How many more bytes streams may inflate to, out of maxBudget
+	budget    int64
+	maxBudget int64
+	// Set once the budget ran out, everything decoded after fails with it
+	err error
+}
+
+type pdfPage struct {
+	dict      pdfDict
+	resources pdfDict
+}
+
+var pdfObjectHeader = regexp.MustCompile(`(\d+)\s+\d+\s+obj\b`)
+
+// loadPDF finds every object by scanning for "n 0 obj" instead of trusting the
+// xref table, which is often broken. Later definitions win, like incremental
+// updates intend. Streams may inflate to budget bytes in total.
+func loadPDF(data []byte, budget int64) *pdfFile {
+	file := &pdfFile{objects: map[int]pdfObject{}, fonts: map[int]*pdfFont{}, budget: budget, maxBudget: budget}
+
+	skipUntil := 0
+	for _, match := range pdfObjectHeader.FindAllSubmatchIndex(data, -1) {
+		// Don't pick up things that look like objects inside stream data
+		if match[0] < skipUntil {
+			continue
+		}
+
+		num, err := strconv.Atoi(string(data[match[2]:match[3]]))
+		if err != nil {
+			continue
+		}
+
+		l := &pdfLexer{data: data, pos: match[1], refs: true}
+		value, err := l.object()
+		if err != nil {
+			continue
+		}
+
+		object := pdfObject{value: value}
+		if dict, ok := value.(pdfDict); ok {
+			if stream, end, ok := readStream(data, l.pos, dict); ok {
+				object.stream = stream
+				skipUntil = end
+			}
+		}
+		file.objects[num] = object
+	}
+
+	for pos := 0; ; {
+		index := bytes.Index(data[pos:], []byte("trailer"))
+		if index < 0 {
+			break
+		}
+		pos += index + len("trailer")
+
+		l := &pdfLexer{data: data, pos: pos, refs: true}
+		if dict, err := l.object(); err == nil {
+			if dict, ok := dict.(pdfDict); ok {
+				file.trailers = append(file.trailers, dict)
+			}
+		}
+	}
+
+	file.expandObjectStreams()
+	return file
+}
+
+// readStream returns the stream data following a stream dictionary at pos
+func readStream(data []byte, pos int, dict pdfDict) ([]byte, int, bool) {
+	l := &pdfLexer{data: data, pos: pos}
+	l.skipSpace()
+	if !bytes.HasPrefix(data[l.pos:], []byte("stream")) {
+		return nil, 0, false
+	}
+
+	start := l.pos + len("stream")
+	if bytes.HasPrefix(data[start:], []byte("\r\n")) {
+		start += 2
+	} else if start < len(data) && (data[start] == '\n' || data[start] == '\r') {
+		start++
+	}
+
+	// Trust /Length if it's direct and lands right before endstream
+	if length, ok := dict["Length"].(float64); ok {
+		end := start + int(length)
+		if end >= start && end <= len(data) {
+			rest := bytes.TrimLeft(data[end:min(end+16, len(data))], "\r\n \t")
+			if bytes.HasPrefix(rest, []byte("endstream")) {
+				return data[start:end], end, true
+			}
+		}
+	}
+
+	index := bytes.Index(data[start:], []byte("endstream"))
+	if index < 0 {
+		return data[start:], len(data), true
+	}
+	end := start + index
+	return bytes.TrimRight(data[start:end], "\r\n"), end, true
+}
+
+// expandObjectStreams loads objects stored inside /Type /ObjStm streams
+// (PDF 1.5+). Objects defined directly in the file take precedence.
+func (f *pdfFile) expandObjectStreams() {
+	var streams []pdfObject
+	for _, object := range f.objects {
+		if dict, ok := object.value.(pdfDict); ok && dict["Type"] == pdfName("ObjStm") {
+			streams = append(streams, object)
+		}
+	}
+
+	for _, object := range streams {
+		dict := object.value.(pdfDict)
+		data, err := f.decode(object)
+		if err != nil {
+			continue
+		}
+
+		count, _ := f.resolve(dict["N"]).(float64)
+		first, _ := f.resolve(dict["First"]).(float64)
+		if int(first) > len(data) {
+			continue
+		}
+
+		header := &pdfLexer{data: data[:int(first)]}
+		for i := 0; i < int(count); i++ {
+			num, err1 := header.token()
+			offset, err2 := header.token()
+			if err1 != nil || err2 != nil {
+				break
+			}
+
+			num2, ok1 := num.(float64)
+			offset2, ok2 := offset.(float64)
+			if !ok1 || !ok2 {
+				break
+			}
+
+			if _, exists := f.objects[int(num2)]; exists {
+				continue
+			}
+
+			pos := int(first) + int(offset2)
+			if pos >= len(data) {
+				continue
+			}
+
+			l := &pdfLexer{data: data, pos: pos, refs: true}
+			if value, err := l.object(); err == nil {
+				f.objects[int(num2)] = pdfObject{value: value}
+			}
+		}
+	}
+}
+
+func (f *pdfFile) encrypted() bool {
+	for _, trailer := range f.trailers {
+		if _, ok := trailer["Encrypt"]; ok {
+			return true
+		}
+	}
+	for _, object := range f.objects {
+		if dict, ok := object.value.(pdfDict); ok && dict["Type"] == pdfName("XRef") {
+			if _, ok := dict["Encrypt"]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resolve follows indirect references
+func (f *pdfFile) resolve(value any) any {
+	for i := 0; i < 16; i++ {
+		ref, ok := value.(pdfRef)
+		if !ok {
+			return value
+		}
+		value = f.objects[ref.num].value
+	}
+	return nil
+}
+
+func (f *pdfFile) dict(value any) pdfDict {
+	dict, _ := f.resolve(value).(pdfDict)
+	return dict
+}
+
+// pages walks the page tree from the catalog, falling back to every
+// /Type /Page object in the file if there's no usable catalog
+func (f *pdfFile) pages() []pdfPage {
+	var pages []pdfPage
+	visited := map[int]bool{}
+
+	var walk func(node any, resources pdfDict, depth int)
+	walk = func(node any, resources pdfDict, depth int) {
+		if ref, ok := node.(pdfRef); ok {
+			if visited[ref.num] {
+				return
+			}
+			visited[ref.num] = true
+		}
+
+		dict := f.dict(node)
+		if dict == nil || depth > 64 {
+			return
+		}
+
+		if own := f.dict(dict["Resources"]); own != nil {
+			resources = own
+		}
+
+		if kids, ok := f.resolve(dict["Kids"]).(pdfArray); ok {
+			for _, kid := range kids {
+				walk(kid, resources, depth+1)
+			}
+			return
+		}
+
+		if dict["Type"] == pdfName("Page") {
+			pages = append(pages, pdfPage{dict: dict, resources: resources})
+		}
+	}
+
+	if catalog := f.catalog(); catalog != nil {
+		walk(catalog["Pages"], nil, 0)
+	}
+
+	if len(pages) > 0 {
+		return pages
+	}
+
+	var nums []int
+	for num, object := range f.objects {
+		if dict, ok := object.value.(pdfDict); ok && dict["Type"] == pdfName("Page") {
+			nums = append(nums, num)
+		}
+	}
+	sort.Ints(nums)
+
+	for _, num := range nums {
+		dict := f.objects[num].value.(pdfDict)
+		pages = append(pages, pdfPage{dict: dict, resources: f.dict(dict["Resources"])})
+	}
+	return pages
+}
+
+func (f *pdfFile) catalog() pdfDict {
+	for i := len(f.trailers) - 1; i >= 0; i-- {
+		if root := f.dict(f.trailers[i]["Root"]); root != nil {
+			return root
+		}
+	}
+
+	for _, object := range f.objects {
+		if dict, ok := object.value.(pdfDict); ok {
+			if dict["Type"] == pdfName("XRef") {
+				if root := f.dict(dict["Root"]); root != nil {
+					return root
+				}
+			}
+		}
+	}
+
+	for _, object := range f.objects {
+		if dict, ok := object.value.(pdfDict); ok && dict["Type"] == pdfName("Catalog") {
+			return dict
+		}
+	}
+	return nil
+}
+
+// contents returns the page's decoded content stream(s)
+func (f *pdfFile) contents(page pdfDict) []byte {
+	var refs []any
+	switch contents := page["Contents"].(type) {
+	case pdfRef:
+		if array, ok := f.resolve(contents).(pdfArray); ok {
+			refs = array
+		} else {
+			refs = []any{contents}
+		}
+	case pdfArray:
+		refs = contents
+	}
+
+	var out []byte
+	for _, ref := range refs {
+		ref, ok := ref.(pdfRef)
+		if !ok {
+			continue
+		}
+		data, err := f.decode(f.objects[ref.num])
+		if err != nil {
+			continue
+		}
+		out = append(out, data...)
+		out = append(out, '\n')
+	}
+	return out
+}
+
+// decode applies the stream's filters
+func (f *pdfFile) decode(object pdfObject) ([]byte, error) {
+	dict, _ := object.value.(pdfDict)
+	if object.stream == nil || dict == nil {
+		return nil, errors.New("not a stream")
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	var filters []any
+	switch filter := f.resolve(dict["Filter"]).(type) {
+	case pdfName:
+		filters = []any{filter}
+	case pdfArray:
+		filters = filter
+	}
+
+	var params []any
+	switch param := f.resolve(dict["DecodeParms"]).(type) {
+	case pdfDict:
+		params = []any{param}
+	case pdfArray:
+		params = param
+	}
+
+	data := object.stream
+	for i, filter := range filters {
+		var param pdfDict
+		if i < len(params) {
+			param = f.dict(params[i])
+		}
+
+		var err error
+		switch f.resolve(filter) {
+		case pdfName("FlateDecode"), pdfName("Fl"):
+			data, err = f.inflate(data)
+			if err == nil {
+				data, err = unpredict(data, param)
+			}
+		case pdfName("ASCIIHexDecode"), pdfName("AHx"):
+			data, err = asciiHexDecode(data)
+		case pdfName("ASCII85Decode"), pdfName("A85"):
+			data, err = ascii85Decode(data)
+		default:
+			err = fmt.Errorf("unsupported filter %v", filter)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
+// inflate decompresses a Flate stream, taking its size out of f.budget
+func (f *pdfFile) inflate(data []byte) ([]byte, error) {
+	var reader io.Reader
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		// Some writers leave out the zlib header
+		reader = flate.NewReader(bytes.NewReader(data))
+	}
+
+	out, err := io.ReadAll(io.LimitReader(reader, f.budget+1))
+	if int64(len(out)) > f.budget {
+		f.err = fmt.Errorf("%w, over %d bytes", ErrTooLarge, f.maxBudget)
+		return nil, f.err
+	}
+	f.budget -= int64(len(out))
+
+	// Truncated streams are common, keep whatever we got
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+	return out, nil
+}
+
+// unpredict undoes PNG predictors (/Predictor 10-15)
+func unpredict(data []byte, params pdfDict) ([]byte, error) {
+	predictor, _ := params["Predictor"].(float64)
+	if predictor < 10 {
+		return data, nil
+	}
+
+	columns := 1
+	if value, ok := params["Columns"].(float64); ok {
+		columns = int(value)
+	}
+	colors := 1
+	if value, ok := params["Colors"].(float64); ok {
+		colors = int(value)
+	}
+	bits := 8
+	if value, ok := params["BitsPerComponent"].(float64); ok {
+		bits = int(value)
+	}
+
+	bytesPerPixel := max(1, colors*bits/8)
+	rowLength := (columns*colors*bits + 7) / 8
+	if rowLength <= 0 {
+		return nil, errors.New("invalid predictor parameters")
+	}
+
+	var out []byte
+	previous := make([]byte, rowLength)
+	for pos := 0; pos+rowLength+1 <= len(data); pos += rowLength + 1 {
+		kind := data[pos]
+		row := append([]byte(nil), data[pos+1:pos+1+rowLength]...)
+
+		for i := range row {
+			var left, up, upLeft byte
+			if i >= bytesPerPixel {
+				left = row[i-bytesPerPixel]
+				upLeft = previous[i-bytesPerPixel]
+			}
+			up = previous[i]
+
+			switch kind {
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			}
+		}
+
+		out = append(out, row...)
+		previous = row
+	}
+
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func asciiHexDecode(data []byte) ([]byte, error) {
+	if end := bytes.IndexByte(data, '>'); end >= 0 {
+		data = data[:end]
+	}
+
+	digits := bytes.Map(func(r rune) rune {
+		if strings.ContainsRune(" \t\r\n\f\x00", r) {
+			return -1
+		}
+		return r
+	}, data)
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+
+	out := make([]byte, hex.DecodedLen(len(digits)))
+	_, err := hex.Decode(out, digits)
+	return out, err
+}
+
+func ascii85Decode(data []byte) ([]byte, error) {
+	data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("<~"))
+	if end := bytes.Index(data, []byte("~>")); end >= 0 {
+		data = data[:end]
+	}
+
+	out := make([]byte, 4*len(data))
+	n, _, err := ascii85.Decode(out, data, true)
+	return out[:n], err
+}
+
+// pdfFont maps the bytes in a text string to Unicode
+type pdfFont struct {
+	// From the ToUnicode CMap, nil if there isn't one
+	toUnicode map[uint32]string
+	// Bytes per character code
+	codeLength int
+}
+
+// font loads the font called name in resources
+func (f *pdfFile) font(resources pdfDict, name pdfName) *pdfFont {
+	ref, _ := f.dict(resources["Font"])[name].(pdfRef)
+	if cached, ok := f.fonts[ref.num]; ok && ref.num != 0 {
+		return cached
+	}
+
+	font := &pdfFont{codeLength: 1}
+	dict := f.dict(f.dict(resources["Font"])[name])
+
+	// Composite fonts use 2 byte codes unless the CMap says otherwise
+	if dict["Subtype"] == pdfName("Type0") {
+		font.codeLength = 2
+	}
+
+	if cmapRef, ok := dict["ToUnicode"].(pdfRef); ok {
+		if data, err := f.decode(f.objects[cmapRef.num]); err == nil {
+			font.toUnicode, font.codeLength = parseCMap(data, font.codeLength)
+		}
+	}
+
+	if ref.num != 0 {
+		f.fonts[ref.num] = font
+	}
+	return font
+}
+
+// parseCMap reads the bfchar and bfrange mappings of a ToUnicode CMap
+func parseCMap(data []byte, codeLength int) (map[uint32]string, int) {
+	mapping := map[uint32]string{}
+	l := &pdfLexer{data: data}
+
+	for {
+		token, err := l.object()
+		if err != nil {
+			break
+		}
+
+		switch token {
+		case pdfKeyword("begincodespacerange"):
+			if low, err := l.object(); err == nil {
+				if low, ok := low.(pdfString); ok && len(low) > 0 {
+					codeLength = len(low)
+				}
+				l.object()
+			}
+
+		case pdfKeyword("beginbfchar"):
+			for {
+				src, err := l.object()
+				if err != nil || src == pdfKeyword("endbfchar") {
+					break
+				}
+				dst, err := l.object()
+				if err != nil {
+					break
+				}
+
+				src2, ok1 := src.(pdfString)
+				dst2, ok2 := dst.(pdfString)
+				if ok1 && ok2 {
+					mapping[cmapCode(src2)] = utf16String(dst2)
+				}
+			}
+
+		case pdfKeyword("beginbfrange"):
+			for {
+				low, err := l.object()
+				if err != nil || low == pdfKeyword("endbfrange") {
+					break
+				}
+				high, err1 := l.object()
+				dst, err2 := l.object()
+				if err1 != nil || err2 != nil {
+					break
+				}
+
+				low2, ok1 := low.(pdfString)
+				high2, ok2 := high.(pdfString)
+				if !ok1 || !ok2 {
+					continue
+				}
+
+				start, end := cmapCode(low2), cmapCode(high2)
+				if end < start || end-start > 0xffff {
+					continue
+				}
+
+				switch dst := dst.(type) {
+				case pdfString:
+					// Each code in the range maps to dst with the last byte incremented
+					base := []byte(dst)
+					for code := start; code <= end; code++ {
+						value := append([]byte(nil), base...)
+						if len(value) > 0 {
+							value[len(value)-1] += byte(code - start)
+						}
+						mapping[code] = utf16String(pdfString(value))
+					}
+				case pdfArray:
+					for i, value := range dst {
+						if value, ok := value.(pdfString); ok && start+uint32(i) <= end {
+							mapping[start+uint32(i)] = utf16String(value)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return mapping, codeLength
+}
+
+func cmapCode(s pdfString) uint32 {
+	var code uint32
+	for i := 0; i < len(s); i++ {
+		code = code<<8 | uint32(s[i])
+	}
+	return code
+}
+
+// utf16String decodes a UTF-16BE CMap destination
+func utf16String(s pdfString) string {
+	if len(s)%2 == 1 {
+		s += "\x00"
+	}
+
+	units := make([]uint16, len(s)/2)
+	for i := range units {
+		units[i] = uint16(s[2*i])<<8 | uint16(s[2*i+1])
+	}
+	return string(utf16.Decode(units))
+}
+
+// Windows-1252 characters that differ from Latin-1, simple fonts without a
+// ToUnicode CMap almost always use WinAnsiEncoding
+var winAnsi = map[byte]rune{
+	0x80: '€', 0x82: '‚', 0x83: 'ƒ', 0x84: '„', 0x85: '…', 0x86: '†', 0x87: '‡',
+	0x88: 'ˆ', 0x89: '‰', 0x8a: 'Š', 0x8b: '‹', 0x8c: 'Œ', 0x8e: 'Ž', 0x91: '‘',
+	0x92: '’', 0x93: '“', 0x94: '”', 0x95: '•', 0x96: '–', 0x97: '—', 0x98: '˜',
+	0x99: '™', 0x9a: 'š', 0x9b: '›', 0x9c: 'œ', 0x9e: 'ž', 0x9f: 'Ÿ',
+}
+
+func (font *pdfFont) decode(s pdfString) string {
+	var b strings.Builder
+
+	if font.toUnicode != nil {
+		for i := 0; i+font.codeLength <= len(s); i += font.codeLength {
+			code := cmapCode(s[i : i+font.codeLength])
+			if text, ok := font.toUnicode[code]; ok {
+				b.WriteString(text)
+			} else if font.codeLength == 1 {
+				b.WriteRune(rune(code))
+			}
+		}
+		return b.String()
+	}
+
+	// Without a CMap 2 byte codes are glyph IDs, there's no way to get text
+	if font.codeLength != 1 {
+		return ""
+	}
+
+	for i := 0; i < len(s); i++ {
+		if r, ok := winAnsi[s[i]]; ok {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune(rune(s[i]))
+		}
+	}
+	return b.String()
+}
+
+// text runs a content stream and returns the text it shows, with a newline
+// wherever the text position moves to another line
+func (f *pdfFile) text(content []byte, resources pdfDict, depth int) string {
+	var out strings.Builder
+	font := &pdfFont{codeLength: 1}
+	var operands []any
+	var lastY float64
+	haveY := false
+
+	newline := func() {
+		out.WriteByte('\n')
+	}
+	show := func(value any) {
+		if s, ok := value.(pdfString); ok {
+			out.WriteString(font.decode(s))
+		}
+	}
+
+	l := &pdfLexer{data: content}
+	for {
+		value, err := l.object()
+		if err != nil {
+			break
+		}
+
+		operator, ok := value.(pdfKeyword)
+		if !ok {
+			operands = append(operands, value)
+			continue
+		}
+
+		number := func(i int) float64 {
+			if i < len(operands) {
+				n, _ := operands[i].(float64)
+				return n
+			}
+			return 0
+		}
+		last := func() any {
+			if len(operands) == 0 {
+				return nil
+			}
+			return operands[len(operands)-1]
+		}
+
+		switch operator {
+		case "Tf":
+			if len(operands) >= 2 {
+				if name, ok := operands[len(operands)-2].(pdfName); ok {
+					font = f.font(resources, name)
+				}
+			}
+		case "Tj":
+			show(last())
+		case "'", "\"":
+			newline()
+			show(last())
+		case "TJ":
+			if array, ok := last().(pdfArray); ok {
+				for _, item := range array {
+					switch item := item.(type) {
+					case pdfString:
+						show(item)
+					case float64:
+						// Big negative kerning is how many PDFs write spaces
+						if item < -200 {
+							out.WriteByte(' ')
+						}
+					}
+				}
+			}
+		case "Td", "TD":
+			if number(1) != 0 {
+				newline()
+			} else {
+				out.WriteByte(' ')
+			}
+		case "T*":
+			newline()
+		case "Tm":
+			y := number(5)
+			if haveY && y != lastY {
+				newline()
+			} else {
+				out.WriteByte(' ')
+			}
+			lastY, haveY = y, true
+		case "ET":
+			out.WriteByte(' ')
+		case "BI":
+			l.skipInlineImage()
+		case "Do":
+			// Form XObjects are content streams of their own
+			if name, ok := last().(pdfName); ok && depth < 8 {
+				ref, _ := f.dict(resources["XObject"])[name].(pdfRef)
+				object := f.objects[ref.num]
+				if dict, ok := object.value.(pdfDict); ok && dict["Subtype"] == pdfName("Form") {
+					if data, err := f.decode(object); err == nil {
+						formResources := f.dict(dict["Resources"])
+						if formResources == nil {
+							formResources = resources
+						}
+						out.WriteString(f.text(data, formResources, depth+1))
+						newline()
+					}
+				}
+			}
+		}
+
+		operands = operands[:0]
+	}
+
+	return out.String()
+}
+
+// pdfLexer reads PDF objects out of a file or content stream
+type pdfLexer struct {
+	data []byte
+	pos  int
+	// Whether "n g R" is read as a reference, off for content streams
+	refs bool
+}
+
+var errUnexpected = errors.New("unexpected token")
+
+func isPDFSpace(c byte) bool {
+	return c == 0 || c == '\t' || c == '\n' || c == '\f' || c == '\r' || c == ' '
+}
+
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if isPDFSpace(c) {
+			l.pos++
+		} else if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		} else {
+			return
+		}
+	}
+}
+
+// object reads a complete object: arrays and dictionaries are read
+// recursively, operators come back as pdfKeyword
+func (l *pdfLexer) object() (any, error) {
+	token, err := l.token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token := token.(type) {
+	case pdfKeyword:
+		switch token {
+		case "[":
+			array := pdfArray{}
+			for {
+				l.skipSpace()
+				if l.pos >= len(l.data) {
+					return array, nil
+				}
+				if l.data[l.pos] == ']' {
+					l.pos++
+					return array, nil
+				}
+				value, err := l.object()
+				if err != nil {
+					return nil, err
+				}
+				array = append(array, value)
+			}
+		case "<<":
+			dict := pdfDict{}
+			for {
+				l.skipSpace()
+				if l.pos >= len(l.data) {
+					return dict, nil
+				}
+				if bytes.HasPrefix(l.data[l.pos:], []byte(">>")) {
+					l.pos += 2
+					return dict, nil
+				}
+				key, err := l.object()
+				if err != nil {
+					return nil, err
+				}
+				name, ok := key.(pdfName)
+				if !ok {
+					return nil, errUnexpected
+				}
+				value, err := l.object()
+				if err != nil {
+					return nil, err
+				}
+				dict[name] = value
+			}
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return token, nil
+
+	case float64:
+		if !l.refs || token != float64(int(token)) {
+			return token, nil
+		}
+
+		// "12 0 R" is a reference, otherwise put the lookahead back
+		save := l.pos
+		generation, err1 := l.token()
+		keyword, err2 := l.token()
+		if err1 == nil && err2 == nil {
+			if _, ok := generation.(float64); ok && keyword == pdfKeyword("R") {
+				return pdfRef{num: int(token)}, nil
+			}
+		}
+		l.pos = save
+		return token, nil
+	}
+
+	return token, nil
+}
+
+// token reads a single token. Delimiters come back as pdfKeyword.
+func (l *pdfLexer) token() (any, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, io.EOF
+	}
+
+	c := l.data[l.pos]
+	switch {
+	case c == '/':
+		l.pos++
+		start := l.pos
+		for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+			l.pos++
+		}
+		return pdfName(decodeName(l.data[start:l.pos])), nil
+
+	case c == '(':
+		return l.literalString(), nil
+
+	case c == '<':
+		if bytes.HasPrefix(l.data[l.pos:], []byte("<<")) {
+			l.pos += 2
+			return pdfKeyword("<<"), nil
+		}
+		l.pos++
+		end := bytes.IndexByte(l.data[l.pos:], '>')
+		if end < 0 {
+			end = len(l.data) - l.pos
+		}
+		decoded, _ := asciiHexDecode(l.data[l.pos : l.pos+end])
+		l.pos = min(l.pos+end+1, len(l.data))
+		return pdfString(decoded), nil
+
+	case c == '>':
+		if bytes.HasPrefix(l.data[l.pos:], []byte(">>")) {
+			l.pos += 2
+			return pdfKeyword(">>"), nil
+		}
+		l.pos++
+		return pdfKeyword(">"), nil
+
+	case c == '[' || c == ']' || c == '{' || c == '}' || c == ')':
+		l.pos++
+		return pdfKeyword(string(c)), nil
+
+	case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		start := l.pos
+		for l.pos < len(l.data) && strings.IndexByte("+-.0123456789", l.data[l.pos]) >= 0 {
+			l.pos++
+		}
+		n, err := strconv.ParseFloat(string(l.data[start:l.pos]), 64)
+		if err != nil {
+			return pdfKeyword(l.data[start:l.pos]), nil
+		}
+		return n, nil
+	}
+
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	if l.pos == start {
+		// Stray delimiter, skip it
+		l.pos++
+	}
+	return pdfKeyword(l.data[start:l.pos]), nil
+}
+
+// decodeName handles #xx escapes in names
+func decodeName(name []byte) string {
+	if bytes.IndexByte(name, '#') < 0 {
+		return string(name)
+	}
+
+	var out []byte
+	for i := 0; i < len(name); i++ {
+		if name[i] == '#' && i+2 < len(name) {
+			if b, err := strconv.ParseUint(string(name[i+1:i+3]), 16, 8); err == nil {
+				out = append(out, byte(b))
+				i += 2
+				continue
+			}
+		}
+		out = append(out, name[i])
+	}
+	return string(out)
+}
+
+func (l *pdfLexer) literalString() pdfString {
+	// Skip the opening (
+	l.pos++
+
+	var out []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return pdfString(out)
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return pdfString(out)
+			}
+			escaped := l.data[l.pos]
+			l.pos++
+
+			switch escaped {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				// Line continuation
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if escaped >= '0' && escaped <= '7' {
+					value := int(escaped - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						value = value*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(value)
+				} else {
+					c = escaped
+				}
+			}
+		}
+
+		out = append(out, c)
+	}
+
+	return pdfString(out)
+}
+
+// skipInlineImage skips BI ... ID <binary data> EI
+func (l *pdfLexer) skipInlineImage() {
+	id := bytes.Index(l.data[l.pos:], []byte("ID"))
+	if id < 0 {
+		l.pos = len(l.data)
+		return
+	}
+	l.pos += id + 2
+
+	for l.pos < len(l.data) {
+		index := bytes.Index(l.data[l.pos:], []byte("EI"))
+		if index < 0 {
+			l.pos = len(l.data)
+			return
+		}
+		end := l.pos + index
+		l.pos = end + 2
+
+		before := end == 0 || isPDFSpace(l.data[end-1])
+		after := l.pos >= len(l.data) || isPDFSpace(l.data[l.pos])
+		if before && after {
+			return
+		}
+	}
+}
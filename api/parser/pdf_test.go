@@ -0,0 +1,97 @@
+package parser
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// buildPDF returns a PDF with one page per content stream, each stream Flate
+// compressed. There's no xref table, loadPDF doesn't need one.
+func buildPDF(t *testing.T, contents ...string) []byte {
+	t.Helper()
+
+	var kids []string
+	for i := range contents {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 4+2*i))
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	fmt.Fprintf(&buf, "1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+	fmt.Fprintf(&buf, "2 0 obj\n<< /Type /Pages /Kids [%s] /Count %d >>\nendobj\n", strings.Join(kids, " "), len(contents))
+	fmt.Fprintf(&buf, "3 0 obj\n<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>\nendobj\n")
+
+	for i, content := range contents {
+		var compressed bytes.Buffer
+		w := zlib.NewWriter(&compressed)
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		page, stream := 4+2*i, 5+2*i
+		fmt.Fprintf(&buf, "%d 0 obj\n<< /Type /Page /Parent 2 0 R /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>\nendobj\n", page, stream)
+		fmt.Fprintf(&buf, "%d 0 obj\n<< /Length %d /Filter /FlateDecode >>\nstream\n", stream, compressed.Len())
+		buf.Write(compressed.Bytes())
+		buf.WriteString("\nendstream\nendobj\n")
+	}
+
+	buf.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return buf.Bytes()
+}
+
+// page is a content stream showing text, padded with a comment so it
+// decompresses to at least size bytes
+func page(text string, size int) string {
+	content := "BT /F1 12 Tf 72 720 Td (" + text + ") Tj ET\n"
+	if pad := size - len(content) - 2; pad > 0 {
+		content += "%" + strings.Repeat("x", pad) + "\n"
+	}
+	return content
+}
+
+func TestPDFDecompressedSize(t *testing.T) {
+	parsers := NewRegistry()
+	parsers.Register(PDF, NewPDFParser(64<<10))
+
+	tests := []struct {
+		name     string
+		contents []string
+		tooLarge bool
+	}{
+		{name: "small", contents: []string{page("First", 0), page("Second", 0)}},
+		{name: "at the limit", contents: []string{page("First", 32<<10), page("Second", 32<<10)}},
+		{name: "one stream over", contents: []string{page("First", 1<<20)}, tooLarge: true},
+		// The budget is for the whole file, not each stream
+		{name: "streams over together", contents: []string{page("First", 40<<10), page("Second", 40<<10)}, tooLarge: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doc, err := parsers.Parse("file.pdf", buildPDF(t, test.contents...))
+			if test.tooLarge {
+				if !errors.Is(err, ErrTooLarge) {
+					t.Fatalf("error = %v, want ErrTooLarge", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(doc.Pages) != len(test.contents) {
+				t.Errorf("got %d pages, want %d", len(doc.Pages), len(test.contents))
+			}
+		})
+	}
+
+	// Other registries keep the default budget
+	if _, err := NewRegistry().Parse("file.pdf", buildPDF(t, page("First", 1<<20))); err != nil {
+		t.Errorf("default registry: %v", err)
+	}
+}
@@ -0,0 +1,291 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/csv"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// textBuilder builds normalized document text: runs of whitespace inside a
+// line become a single space, and blocks are separated by exactly one blank
+// line. Len can be used to record offsets while building.
+type textBuilder struct {
+	b            strings.Builder
+	pendingSpace bool
+	// Number of newlines at the end of b
+	newlines int
+}
+
+// WriteText appends s, collapsing whitespace (including newlines) into spaces
+func (t *textBuilder) WriteText(s string) {
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			t.pendingSpace = true
+			continue
+		}
+		if r == unicode.ReplacementChar || unicode.IsControl(r) {
+			continue
+		}
+
+		if t.pendingSpace && t.b.Len() > 0 && t.newlines == 0 {
+			t.b.WriteByte(' ')
+		}
+		t.pendingSpace = false
+		t.newlines = 0
+		t.b.WriteRune(r)
+	}
+}
+
+// Space separates the next text from the previous text
+func (t *textBuilder) Space() {
+	t.pendingSpace = true
+}
+
+// Line starts a new line
+func (t *textBuilder) Line() {
+	t.breakTo(1)
+}
+
+// Paragraph starts a new block, after a blank line
+func (t *textBuilder) Paragraph() {
+	t.breakTo(2)
+}
+
+func (t *textBuilder) breakTo(newlines int) {
+	t.pendingSpace = false
+	if t.b.Len() == 0 {
+		return
+	}
+	for t.newlines < newlines {
+		t.b.WriteByte('\n')
+		t.newlines++
+	}
+}
+
+// Len is the offset the next text will be written at, once any pending line
+// breaks are written
+func (t *textBuilder) Len() int {
+	return t.b.Len()
+}
+
+// Document returns the finished text, clamping doc's offsets to it
+func (t *textBuilder) Document(doc *Document) *Document {
+	doc.Text = strings.TrimRight(t.b.String(), "\n")
+	clamp := func(offset int) int {
+		return min(offset, len(doc.Text))
+	}
+
+	for i := range doc.Pages {
+		doc.Pages[i].Start = clamp(doc.Pages[i].Start)
+		doc.Pages[i].End = clamp(doc.Pages[i].End)
+	}
+	for i := range doc.Headings {
+		doc.Headings[i].Start = clamp(doc.Headings[i].Start)
+	}
+	for i := range doc.Tables {
+		doc.Tables[i].Start = clamp(doc.Tables[i].Start)
+		doc.Tables[i].End = clamp(doc.Tables[i].End)
+	}
+
+	return doc
+}
+
+// writeTable renders rows into t and records the table
+func (t *textBuilder) writeTable(doc *Document, rows [][]string) {
+	if len(rows) == 0 {
+		return
+	}
+
+	t.Paragraph()
+	start := t.Len()
+	for _, row := range rows {
+		t.WriteText(strings.Join(row, " | "))
+		t.Line()
+	}
+	doc.Tables = append(doc.Tables, Table{Start: start, End: t.Len(), Rows: rows})
+	t.Paragraph()
+}
+
+// writeHeading writes title as its own block and records it
+func (t *textBuilder) writeHeading(doc *Document, level int, title string) {
+	title = strings.Join(strings.Fields(title), " ")
+	if title == "" {
+		return
+	}
+
+	t.Paragraph()
+	doc.Headings = append(doc.Headings, Heading{Level: level, Title: title, Start: t.Len()})
+	t.WriteText(title)
+	t.Paragraph()
+}
+
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// normalize cleans up text that's kept line for line (plain text, Markdown):
+// valid UTF-8, \n line endings, no trailing spaces, at most one blank line
+// in a row
+func normalize(data []byte) string {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	text := strings.ToValidUTF8(string(data), "")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	text = strings.ReplaceAll(text, "\x00", "")
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRightFunc(line, unicode.IsSpace)
+	}
+
+	text = strings.Join(lines, "\n")
+	text = blankLines.ReplaceAllString(text, "\n\n")
+	return strings.Trim(text, "\n")
+}
+
+type textParser struct{}
+
+func (textParser) Parse(data []byte) (*Document, error) {
+	return &Document{Text: normalize(data)}, nil
+}
+
+var (
+	atxHeading     = regexp.MustCompile(`^ {0,3}(#{1,6})\s+(.*?)(?:\s+#+)?\s*$`)
+	setextHeading  = regexp.MustCompile(`^ {0,3}(=+|-+)\s*$`)
+	tableSeparator = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+	codeFence      = regexp.MustCompile("^ {0,3}(```|~~~)")
+)
+
+// markdownParser keeps the Markdown source as the text (it reads fine as is),
+// and picks out headings and pipe tables
+type markdownParser struct{}
+
+func (markdownParser) Parse(data []byte) (*Document, error) {
+	doc := &Document{Text: normalize(data)}
+
+	lines := strings.Split(doc.Text, "\n")
+	offsets := make([]int, len(lines)+1)
+	for i, line := range lines {
+		offsets[i+1] = offsets[i] + len(line) + 1
+	}
+
+	inCode := false
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		if codeFence.MatchString(line) {
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			continue
+		}
+
+		if match := atxHeading.FindStringSubmatch(line); match != nil {
+			doc.Headings = append(doc.Headings, Heading{
+				Level: len(match[1]),
+				Title: match[2],
+				Start: offsets[i],
+			})
+			continue
+		}
+
+		// Title
+		// =====
+		if i+1 < len(lines) && strings.TrimSpace(line) != "" && !strings.HasPrefix(strings.TrimSpace(line), "|") {
+			if match := setextHeading.FindStringSubmatch(lines[i+1]); match != nil {
+				level := 1
+				if match[1][0] == '-' {
+					level = 2
+				}
+				doc.Headings = append(doc.Headings, Heading{
+					Level: level,
+					Title: strings.TrimSpace(line),
+					Start: offsets[i],
+				})
+				i++
+				continue
+			}
+		}
+
+		// | a | b |
+		// |---|---|
+		if strings.Contains(line, "|") && i+1 < len(lines) && strings.Contains(lines[i+1], "-") && tableSeparator.MatchString(lines[i+1]) {
+			rows := [][]string{splitTableRow(line)}
+			end := i + 2
+			for end < len(lines) && strings.Contains(lines[end], "|") {
+				rows = append(rows, splitTableRow(lines[end]))
+				end++
+			}
+
+			doc.Tables = append(doc.Tables, Table{
+				Start: offsets[i],
+				End:   offsets[end] - 1,
+				Rows:  rows,
+			})
+			i = end - 1
+		}
+	}
+
+	return doc, nil
+}
+
+func splitTableRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	line = strings.TrimSuffix(line, "|")
+
+	cells := strings.Split(line, "|")
+	for i, cell := range cells {
+		cells[i] = strings.TrimSpace(cell)
+	}
+	return cells
+}
+
+// csvParser renders each row as "header: value; header: value" so a row still
+// makes sense once it's chunked away from the header
+type csvParser struct{}
+
+func (csvParser) Parse(data []byte) (*Document, error) {
+	reader := csv.NewReader(strings.NewReader(normalize(data)))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &Document{}
+	if len(rows) == 0 {
+		return doc, nil
+	}
+
+	var t textBuilder
+	header := rows[0]
+
+	if len(rows) == 1 {
+		t.WriteText(strings.Join(header, " | "))
+	}
+
+	for _, row := range rows[1:] {
+		var fields []string
+		for i, value := range row {
+			value = strings.TrimSpace(value)
+			if value == "" {
+				continue
+			}
+			if i < len(header) && strings.TrimSpace(header[i]) != "" {
+				value = strings.TrimSpace(header[i]) + ": " + value
+			}
+			fields = append(fields, value)
+		}
+
+		t.WriteText(strings.Join(fields, "; "))
+		t.Line()
+	}
+
+	doc.Tables = []Table{{Start: 0, End: t.Len(), Rows: rows}}
+	return t.Document(doc), nil
+}
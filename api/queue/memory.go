@@ -0,0 +1,142 @@
+package queue
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type memoryJob struct {
+	job       Job
+	visibleAt time.Time
+}
+
+// MemoryQueue is an in-process queue for tests and for the API running the
+// worker itself (RUN_WORKER=true). Jobs are lost when the process exits.
+type MemoryQueue struct {
+	mu         sync.Mutex
+	jobs       []*memoryJob
+	nextId     int
+	visibility time.Duration
+	wait       time.Duration
+	// Closed and replaced every time a job is enqueued or becomes visible,
+	// to wake up waiting consumers
+	notify chan struct{}
+}
+
+func NewMemory(visibility time.Duration) *MemoryQueue {
+	return &MemoryQueue{
+		visibility: visibility,
+		wait:       time.Second,
+		notify:     make(chan struct{}),
+	}
+}
+
+func (q *MemoryQueue) Enqueue(ctx context.Context, body []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.nextId++
+	q.jobs = append(q.jobs, &memoryJob{
+		job: Job{
+			ID:   strconv.Itoa(q.nextId),
+			Body: append([]byte(nil), body...),
+		},
+		visibleAt: time.Now(),
+	})
+	q.wake()
+
+	return nil
+}
+
+func (q *MemoryQueue) Dequeue(ctx context.Context, max int) ([]Job, error) {
+	jobs, notify := q.claim(max)
+	if len(jobs) > 0 {
+		return jobs, nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-notify:
+	case <-time.After(q.wait):
+	}
+
+	jobs, _ = q.claim(max)
+	return jobs, nil
+}
+
+func (q *MemoryQueue) claim(max int) ([]Job, chan struct{}) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	var jobs []Job
+	for _, item := range q.jobs {
+		if len(jobs) >= max {
+			break
+		}
+		if item.visibleAt.After(now) {
+			continue
+		}
+
+		item.job.Attempts++
+		item.job.Receipt = uuid.NewString()
+		item.visibleAt = now.Add(q.visibility)
+		jobs = append(jobs, item.job)
+	}
+
+	return jobs, q.notify
+}
+
+func (q *MemoryQueue) Ack(ctx context.Context, job Job) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, item := range q.jobs {
+		if item.job.ID == job.ID && item.job.Receipt == job.Receipt {
+			q.jobs = append(q.jobs[:i], q.jobs[i+1:]...)
+			return nil
+		}
+	}
+	return ErrLeaseLost
+}
+
+func (q *MemoryQueue) Nack(ctx context.Context, job Job, delay time.Duration) error {
+	if err := q.setVisibleAt(job, time.Now().Add(delay)); err != nil {
+		return err
+	}
+
+	if delay <= 0 {
+		q.mu.Lock()
+		q.wake()
+		q.mu.Unlock()
+	}
+	return nil
+}
+
+func (q *MemoryQueue) ExtendVisibility(ctx context.Context, job Job, d time.Duration) error {
+	return q.setVisibleAt(job, time.Now().Add(d))
+}
+
+func (q *MemoryQueue) setVisibleAt(job Job, visibleAt time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, item := range q.jobs {
+		if item.job.ID == job.ID && item.job.Receipt == job.Receipt {
+			item.visibleAt = visibleAt
+			return nil
+		}
+	}
+	return ErrLeaseLost
+}
+
+// wake must be called with q.mu held
+func (q *MemoryQueue) wake() {
+	close(q.notify)
+	q.notify = make(chan struct{})
+}
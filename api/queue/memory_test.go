@@ -0,0 +1,170 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestMemory(visibility time.Duration) *MemoryQueue {
+	q := NewMemory(visibility)
+	q.wait = 10 * time.Millisecond
+	return q
+}
+
+// dequeueOne fails unless exactly one job is available
+func dequeueOne(t *testing.T, q *MemoryQueue) Job {
+	t.Helper()
+
+	jobs, err := q.Dequeue(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 {
+		t.Fatalf("got %d jobs, want 1", len(jobs))
+	}
+	return jobs[0]
+}
+
+func dequeueNone(t *testing.T, q *MemoryQueue) {
+	t.Helper()
+
+	jobs, err := q.Dequeue(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 0 {
+		t.Fatalf("got %d jobs, want none", len(jobs))
+	}
+}
+
+func TestMemoryQueueVisibility(t *testing.T) {
+	q := newTestMemory(50 * time.Millisecond)
+	ctx := context.Background()
+
+	if err := q.Enqueue(ctx, []byte("job")); err != nil {
+		t.Fatal(err)
+	}
+
+	first := dequeueOne(t, q)
+	if string(first.Body) != "job" || first.Attempts != 1 {
+		t.Fatalf("got %q attempt %d, want %q attempt 1", first.Body, first.Attempts, "job")
+	}
+
+	// Hidden while leased
+	dequeueNone(t, q)
+
+	// Redelivered once the lease runs out, with a new receipt
+	time.Sleep(60 * time.Millisecond)
+	second := dequeueOne(t, q)
+	if second.ID != first.ID || second.Attempts != 2 || second.Receipt == first.Receipt {
+		t.Fatalf("redelivery = %+v, want job %s attempt 2 with a new receipt", second, first.ID)
+	}
+
+	// The first delivery lost its lease
+	if err := q.Ack(ctx, first); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Ack with an old receipt: %v, want ErrLeaseLost", err)
+	}
+
+	if err := q.Ack(ctx, second); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	dequeueNone(t, q)
+}
+
+func TestMemoryQueueLease(t *testing.T) {
+	tests := []struct {
+		name string
+		// Called with the leased job after it was dequeued
+		lease func(q *MemoryQueue, job Job) error
+		// Whether the job is delivered again 60ms after lease
+		redelivered bool
+	}{
+		{
+			name:  "ack",
+			lease: func(q *MemoryQueue, job Job) error { return q.Ack(context.Background(), job) },
+		},
+		{
+			name:        "nack",
+			lease:       func(q *MemoryQueue, job Job) error { return q.Nack(context.Background(), job, 0) },
+			redelivered: true,
+		},
+		{
+			name:  "nack with delay",
+			lease: func(q *MemoryQueue, job Job) error { return q.Nack(context.Background(), job, time.Hour) },
+		},
+		{
+			name:  "extend",
+			lease: func(q *MemoryQueue, job Job) error { return q.ExtendVisibility(context.Background(), job, time.Hour) },
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q := newTestMemory(50 * time.Millisecond)
+			if err := q.Enqueue(context.Background(), []byte("job")); err != nil {
+				t.Fatal(err)
+			}
+
+			job := dequeueOne(t, q)
+			if err := test.lease(q, job); err != nil {
+				t.Fatal(err)
+			}
+
+			time.Sleep(60 * time.Millisecond)
+			if test.redelivered {
+				dequeueOne(t, q)
+			} else {
+				dequeueNone(t, q)
+			}
+		})
+	}
+}
+
+func TestMemoryQueueDequeueMax(t *testing.T) {
+	q := newTestMemory(time.Minute)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if err := q.Enqueue(ctx, []byte("job")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	jobs, err := q.Dequeue(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2 {
+		t.Fatalf("got %d jobs, want 2", len(jobs))
+	}
+	dequeueOne(t, q)
+}
+
+func TestMemoryQueueWakesConsumer(t *testing.T) {
+	q := NewMemory(time.Minute)
+	q.wait = time.Minute
+
+	done := make(chan []Job)
+	go func() {
+		jobs, _ := q.Dequeue(context.Background(), 1)
+		done <- jobs
+	}()
+
+	// Give the consumer time to start waiting
+	time.Sleep(10 * time.Millisecond)
+	if err := q.Enqueue(context.Background(), []byte("job")); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case jobs := <-done:
+		if len(jobs) != 1 {
+			t.Fatalf("got %d jobs, want 1", len(jobs))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("consumer wasn't woken up by Enqueue")
+	}
+}
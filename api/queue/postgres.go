@@ -0,0 +1,134 @@
+package queue
+
+import (
+	"context"
+	"intualai/gen"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// PostgresQueue stores jobs in the jobs table. Workers claim them with
+// SELECT ... FOR UPDATE SKIP LOCKED, so small deployments don't need SQS.
+type PostgresQueue struct {
+	queries      *gen.Queries
+	visibility   time.Duration
+	pollInterval time.Duration
+}
+
+func NewPostgres(queries *gen.Queries, visibility time.Duration) *PostgresQueue {
+	return &PostgresQueue{
+		queries:      queries,
+		visibility:   visibility,
+		pollInterval: time.Second,
+	}
+}
+
+func (q *PostgresQueue) Enqueue(ctx context.Context, body []byte) error {
+	_, err := q.queries.EnqueueJob(ctx, body)
+	return err
+}
+
+func (q *PostgresQueue) Dequeue(ctx context.Context, max int) ([]Job, error) {
+	rows, err := q.queries.DequeueJobs(ctx, gen.DequeueJobsParams{
+		VisibilitySeconds: q.visibility.Seconds(),
+		MaxJobs:           int32(max),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Nothing to do, wait a bit so idle workers don't hammer the database
+	if len(rows) == 0 {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(q.pollInterval):
+			return nil, nil
+		}
+	}
+
+	jobs := make([]Job, 0, len(rows))
+	for _, row := range rows {
+		jobs = append(jobs, Job{
+			ID:       strconv.FormatInt(row.ID, 10),
+			Receipt:  uuid.UUID(row.LeaseID.Bytes).String(),
+			Body:     row.Body,
+			Attempts: int(row.Attempts),
+		})
+	}
+
+	return jobs, nil
+}
+
+func (q *PostgresQueue) Ack(ctx context.Context, job Job) error {
+	id, lease, err := parseReceipt(job)
+	if err != nil {
+		return err
+	}
+
+	acked, err := q.queries.AckJob(ctx, gen.AckJobParams{ID: id, LeaseID: lease})
+	if err != nil {
+		return err
+	}
+	if acked == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func (q *PostgresQueue) Nack(ctx context.Context, job Job, delay time.Duration) error {
+	id, lease, err := parseReceipt(job)
+	if err != nil {
+		return err
+	}
+
+	nacked, err := q.queries.NackJob(ctx, gen.NackJobParams{
+		DelaySeconds: delay.Seconds(),
+		ID:           id,
+		LeaseID:      lease,
+	})
+	if err != nil {
+		return err
+	}
+	if nacked == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func (q *PostgresQueue) ExtendVisibility(ctx context.Context, job Job, d time.Duration) error {
+	id, lease, err := parseReceipt(job)
+	if err != nil {
+		return err
+	}
+
+	extended, err := q.queries.ExtendJobVisibility(ctx, gen.ExtendJobVisibilityParams{
+		VisibilitySeconds: d.Seconds(),
+		ID:                id,
+		LeaseID:           lease,
+	})
+	if err != nil {
+		return err
+	}
+	if extended == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func parseReceipt(job Job) (int64, pgtype.UUID, error) {
+	id, err := strconv.ParseInt(job.ID, 10, 64)
+	if err != nil {
+		return 0, pgtype.UUID{}, err
+	}
+
+	lease, err := uuid.Parse(job.Receipt)
+	if err != nil {
+		return 0, pgtype.UUID{}, err
+	}
+
+	return id, pgtype.UUID{Bytes: lease, Valid: true}, nil
+}
@@ -0,0 +1,47 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrLeaseLost is returned when acking or extending a job whose visibility
+// timeout already ran out, so it may have been handed to another worker
+var ErrLeaseLost = errors.New("job lease lost")
+
+// Job is a message received from a queue. It stays invisible to other
+// consumers until it's acked, nacked or its visibility timeout runs out.
+type Job struct {
+	ID string
+	// Receipt identifies this delivery of the job, it changes every time the
+	// job is dequeued
+	Receipt string
+	Body    []byte
+	// Number of times the job has been delivered, including this one
+	Attempts int
+}
+
+// JobQueue is an at-least-once work queue between the API and the processing
+// worker. Consumers must be able to handle the same job more than once.
+type JobQueue interface {
+	Enqueue(ctx context.Context, body []byte) error
+	// Dequeue returns up to max jobs. If none are available it waits a short
+	// while for some to show up, and may return an empty slice.
+	Dequeue(ctx context.Context, max int) ([]Job, error)
+	// Ack removes a finished job from the queue
+	Ack(ctx context.Context, job Job) error
+	// Nack makes the job visible again after delay so it can be retried
+	Nack(ctx context.Context, job Job, delay time.Duration) error
+	// ExtendVisibility keeps a long running job hidden for another d
+	ExtendVisibility(ctx context.Context, job Job, d time.Duration) error
+}
+
+// FileJob asks the worker to process (chunk & embed) a single file
+type FileJob struct {
+	// Unique per job, redeliveries of the same job keep it so consumers can
+	// skip jobs they've already handled
+	ID        string `json:"id"`
+	ProjectID string `json:"project_id"`
+	FileName  string `json:"file_name"`
+}
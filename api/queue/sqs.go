@@ -0,0 +1,136 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go"
+)
+
+// SQS allows at most 10 messages per receive and 20 seconds of long polling
+const (
+	sqsMaxMessages = 10
+	sqsWaitSeconds = 10
+)
+
+// sqsClient is the part of *sqs.Client the queue uses
+type sqsClient interface {
+	SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+	ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+	ChangeMessageVisibility(ctx context.Context, params *sqs.ChangeMessageVisibilityInput, optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error)
+}
+
+type SQSQueue struct {
+	client     sqsClient
+	queueUrl   string
+	visibility time.Duration
+}
+
+// NewSQS creates a queue for queueUrl using the default AWS config chain.
+// Dequeued jobs stay hidden for visibility unless extended.
+func NewSQS(ctx context.Context, queueUrl string, visibility time.Duration) (*SQSQueue, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SQSQueue{
+		client:     sqs.NewFromConfig(cfg),
+		queueUrl:   queueUrl,
+		visibility: visibility,
+	}, nil
+}
+
+func (q *SQSQueue) Enqueue(ctx context.Context, body []byte) error {
+	_, err := q.client.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(q.queueUrl),
+		MessageBody: aws.String(string(body)),
+	})
+	return err
+}
+
+func (q *SQSQueue) Dequeue(ctx context.Context, max int) ([]Job, error) {
+	output, err := q.client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(q.queueUrl),
+		MaxNumberOfMessages: int32(min(max, sqsMaxMessages)),
+		WaitTimeSeconds:     sqsWaitSeconds,
+		VisibilityTimeout:   int32(q.visibility.Seconds()),
+		MessageSystemAttributeNames: []types.MessageSystemAttributeName{
+			types.MessageSystemAttributeNameApproximateReceiveCount,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]Job, 0, len(output.Messages))
+	for _, message := range output.Messages {
+		attempts, _ := strconv.Atoi(message.Attributes[string(types.MessageSystemAttributeNameApproximateReceiveCount)])
+		jobs = append(jobs, Job{
+			ID:       aws.ToString(message.MessageId),
+			Receipt:  aws.ToString(message.ReceiptHandle),
+			Body:     []byte(aws.ToString(message.Body)),
+			Attempts: attempts,
+		})
+	}
+
+	return jobs, nil
+}
+
+func (q *SQSQueue) Ack(ctx context.Context, job Job) error {
+	_, err := q.client.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(q.queueUrl),
+		ReceiptHandle: aws.String(job.Receipt),
+	})
+	return leaseError(err)
+}
+
+func (q *SQSQueue) Nack(ctx context.Context, job Job, delay time.Duration) error {
+	return q.changeVisibility(ctx, job, delay)
+}
+
+func (q *SQSQueue) ExtendVisibility(ctx context.Context, job Job, d time.Duration) error {
+	return q.changeVisibility(ctx, job, d)
+}
+
+func (q *SQSQueue) changeVisibility(ctx context.Context, job Job, d time.Duration) error {
+	_, err := q.client.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(q.queueUrl),
+		ReceiptHandle:     aws.String(job.Receipt),
+		VisibilityTimeout: int32(d.Seconds()),
+	})
+	return leaseError(err)
+}
+
+// leaseError turns the errors SQS returns for a receipt handle that stopped
+// being valid into ErrLeaseLost. The handle is unknown, the message isn't
+// in flight anymore, or its visibility timeout ran out, which only comes as
+// an invalid parameter error saying so.
+func leaseError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var invalid *types.ReceiptHandleIsInvalid
+	var notInflight *types.MessageNotInflight
+	if errors.As(err, &invalid) || errors.As(err, &notInflight) {
+		return fmt.Errorf("%w: %w", ErrLeaseLost, err)
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "InvalidParameterValue" &&
+		strings.Contains(strings.ToLower(apiErr.ErrorMessage()), "receipt handle has expired") {
+		return fmt.Errorf("%w: %w", ErrLeaseLost, err)
+	}
+
+	return err
+}
@@ -0,0 +1,83 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go"
+)
+
+// fakeSQS fails every call on a message with err
+type fakeSQS struct {
+	sqsClient
+	err error
+}
+
+func (f *fakeSQS) DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func (f *fakeSQS) ChangeMessageVisibility(ctx context.Context, params *sqs.ChangeMessageVisibilityInput, optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &sqs.ChangeMessageVisibilityOutput{}, nil
+}
+
+func TestSQSLeaseLost(t *testing.T) {
+	throttled := &types.RequestThrottled{Message: aws.String("Rate exceeded")}
+
+	tests := []struct {
+		name      string
+		err       error
+		leaseLost bool
+	}{
+		{name: "ok"},
+		{name: "invalid receipt handle", err: &types.ReceiptHandleIsInvalid{Message: aws.String("The input receipt handle is invalid.")}, leaseLost: true},
+		{name: "not in flight", err: &types.MessageNotInflight{}, leaseLost: true},
+		// What SQS answers once the visibility timeout ran out
+		{name: "expired receipt handle", err: &smithy.GenericAPIError{
+			Code:    "InvalidParameterValue",
+			Message: "Value AQEB... for parameter ReceiptHandle is invalid. Reason: The receipt handle has expired.",
+		}, leaseLost: true},
+		{name: "other invalid parameter", err: &smithy.GenericAPIError{
+			Code:    "InvalidParameterValue",
+			Message: "Value 43201 for parameter VisibilityTimeout is invalid. Reason: Must be between 0 and 43200.",
+		}},
+		{name: "throttled", err: throttled},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q := &SQSQueue{client: &fakeSQS{err: test.err}, queueUrl: "queue", visibility: time.Minute}
+			job := Job{ID: "job", Receipt: "receipt"}
+			ctx := context.Background()
+
+			calls := map[string]error{
+				"Ack":              q.Ack(ctx, job),
+				"Nack":             q.Nack(ctx, job, time.Second),
+				"ExtendVisibility": q.ExtendVisibility(ctx, job, time.Minute),
+			}
+			for call, err := range calls {
+				if got := errors.Is(err, ErrLeaseLost); got != test.leaseLost {
+					t.Errorf("%s: %v, lease lost = %v, want %v", call, err, got, test.leaseLost)
+				}
+				// The SQS error stays available
+				if test.err != nil && !errors.Is(err, test.err) {
+					t.Errorf("%s: %v doesn't wrap %v", call, err, test.err)
+				}
+				if test.err == nil && err != nil {
+					t.Errorf("%s: %v", call, err)
+				}
+			}
+		})
+	}
+}
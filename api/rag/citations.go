@@ -0,0 +1,44 @@
+package rag
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// Matches [1], and each number of [1, 2] or [1][2]
+var citationPattern = regexp.MustCompile(`\[(\d+(?:\s*,\s*\d+)*)\]`)
+var citationNumberPattern = regexp.MustCompile(`\d+`)
+
+// Citation maps a [n] marker in the answer back to the chunk it cites
+type Citation struct {
+	Marker   int    `json:"marker"`
+	ChunkID  string `json:"chunk_id"`
+	FileName string `json:"file_name"`
+	Page     *int32 `json:"page"`
+}
+
+// Citations finds the sources an answer cites, in the order they're first
+// cited. Markers that don't match a source (made up by the model) are ignored.
+func Citations(answer string, sources []Source) []Citation {
+	citations := []Citation{}
+	seen := map[int]bool{}
+
+	for _, marker := range citationPattern.FindAllStringSubmatch(answer, -1) {
+		for _, number := range citationNumberPattern.FindAllString(marker[1], -1) {
+			n, err := strconv.Atoi(number)
+			if err != nil || n < 1 || n > len(sources) || seen[n] {
+				continue
+			}
+			seen[n] = true
+
+			source := sources[n-1]
+			citation := Citation{Marker: n, ChunkID: source.ChunkID, FileName: source.FileName}
+			if source.Page > 0 {
+				citation.Page = &source.Page
+			}
+			citations = append(citations, citation)
+		}
+	}
+
+	return citations
+}
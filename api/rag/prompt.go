@@ -0,0 +1,101 @@
+package rag
+
+import (
+	"fmt"
+	"intualai/llm"
+	"intualai/retrieval"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// DefaultTemplate is used for projects without their own prompt_template
+const DefaultTemplate = `Answer the question using only the sources below. Cite every source you use inline with its number in square brackets, e.g. [1] or [2][3]. If the sources don't contain the answer, say that you don't know.
+
+{{range .Sources}}[{{.Number}}] {{.FileName}}{{if .Page}} (page {{.Page}}){{end}}
+{{.Text}}
+
+{{end}}Question: {{.Question}}`
+
+// Source is a retrieved chunk as the template sees it. Number is what the
+// answer cites it as.
+type Source struct {
+	Number   int
+	ChunkID  string
+	FileName string
+	// 0 for files without pages
+	Page    int32
+	Section string
+	Text    string
+}
+
+// PromptData is what prompt templates are executed with
+type PromptData struct {
+	Question string
+	Sources  []Source
+	Project  string
+}
+
+// ParseTemplate checks a prompt template. Templates are text/template and get
+// a PromptData, they must use .Question and .Sources.
+func ParseTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("prompt").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.Contains(text, ".Question") || !strings.Contains(text, ".Sources") {
+		return nil, fmt.Errorf("prompt template must use .Question and .Sources")
+	}
+
+	// Catch references to fields that don't exist now rather than on every query
+	err = tmpl.Execute(io.Discard, PromptData{
+		Question: "question",
+		Sources:  []Source{{Number: 1, FileName: "file.pdf", Page: 1, Text: "text"}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tmpl, nil
+}
+
+// sources numbers results the way the answer cites them, starting at 1
+func sources(results []retrieval.Result) []Source {
+	sources := make([]Source, len(results))
+	for i, result := range results {
+		sources[i] = Source{
+			Number:   i + 1,
+			ChunkID:  result.ChunkID,
+			FileName: result.FileName,
+			Text:     result.Text,
+		}
+		if result.Page != nil {
+			sources[i].Page = *result.Page
+		}
+		if result.Section != nil {
+			sources[i].Section = *result.Section
+		}
+	}
+	return sources
+}
+
+// BuildPrompt renders the template (DefaultTemplate if empty) into the
+// messages sent to the LLM
+func BuildPrompt(templateText string, data PromptData) ([]llm.Message, error) {
+	if templateText == "" {
+		templateText = DefaultTemplate
+	}
+
+	tmpl, err := ParseTemplate(templateText)
+	if err != nil {
+		return nil, err
+	}
+
+	var prompt strings.Builder
+	if err := tmpl.Execute(&prompt, data); err != nil {
+		return nil, err
+	}
+
+	return []llm.Message{{Role: llm.RoleUser, Content: prompt.String()}}, nil
+}
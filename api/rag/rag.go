@@ -0,0 +1,212 @@
+package rag
+
+import (
+	"context"
+	"intualai/chunker"
+	"intualai/llm"
+	"intualai/retrieval"
+	"intualai/settings"
+)
+
+// Answer is a generated answer. Answer cites sources with [n] markers, which
+// Citations map back to chunks.
+type Answer struct {
+	Answer    string             `json:"answer"`
+	Citations []Citation         `json:"citations"`
+	Sources   []retrieval.Result `json:"sources"`
+	Model     string             `json:"model"`
+	Usage     llm.Usage          `json:"usage"`
+}
+
+// Answerer answers questions about a project's files: retrieve chunks, build
+// a prompt from the project's template, then ask the project's LLM. All of it
+// follows the project's settings.
+type Answerer struct {
+	retriever *retrieval.Retriever
+	providers *llm.Registry
+}
+
+func New(retriever *retrieval.Retriever, providers *llm.Registry) *Answerer {
+	return &Answerer{retriever: retriever, providers: providers}
+}
+
+// Event names sent by Stream, in the order they're sent
+const (
+	EventRetrieval = "retrieval"
+	EventDelta     = "delta"
+	EventCitations = "citations"
+	EventUsage     = "usage"
+)
+
+type RetrievalEvent struct {
+	Sources []retrieval.Result `json:"sources"`
+}
+
+type DeltaEvent struct {
+	Text string `json:"text"`
+}
+
+type CitationsEvent struct {
+	Citations []Citation `json:"citations"`
+}
+
+type UsageEvent struct {
+	Model string    `json:"model"`
+	Usage llm.Usage `json:"usage"`
+}
+
+// How many earlier messages of a conversation are sent along with the prompt
+const MaxHistory = 10
+
+// prompt retrieves the sources for a request and builds the messages sent to
+// the LLM (see buildMessages)
+func (a *Answerer) prompt(ctx context.Context, project settings.Project, request retrieval.Request, history []llm.Message) (llm.LLMProvider, []retrieval.Result, []Source, []llm.Message, error) {
+	results, err := a.retriever.Search(ctx, project, request)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	provider, err := a.providers.Resolve(project.Generation.Model, project.ModelType)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	messages, results, sources, err := buildMessages(project, request.Query, results, history)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	return provider, results, sources, messages, nil
+}
+
+// buildMessages puts together the system prompt, the last MaxHistory
+// messages of history and the prompt built from the template, with as many
+// of results as keep all of it within max_context_tokens. If even the prompt
+// without sources doesn't fit, the oldest history goes first. Returns the
+// messages and the results and sources that made it in.
+func buildMessages(project settings.Project, query string, results []retrieval.Result, history []llm.Message) ([]llm.Message, []retrieval.Result, []Source, error) {
+	budget := project.Generation.MaxContextTokens
+
+	system := []llm.Message{}
+	if project.Generation.SystemPrompt != "" {
+		system = append(system, llm.Message{Role: llm.RoleSystem, Content: project.Generation.SystemPrompt})
+	}
+	history = history[max(0, len(history)-MaxHistory):]
+
+	render := func(results []retrieval.Result) ([]llm.Message, []Source, error) {
+		sources := sources(results)
+		prompt, err := BuildPrompt(project.Generation.PromptTemplate, PromptData{
+			Question: query,
+			Sources:  sources,
+			Project:  project.Name,
+		})
+		return prompt, sources, err
+	}
+
+	// Sent whatever fits: the system prompt and the template around the sources
+	empty, _, err := render(nil)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	overhead := countTokens(system) + countTokens(empty)
+	for len(history) > 0 && overhead+countTokens(history) > budget {
+		history = history[1:]
+	}
+
+	// Chunk texts first, then whatever the template adds per source (numbers,
+	// file names) may still push it over
+	results = fit(results, budget-overhead-countTokens(history))
+	for {
+		prompt, sources, err := render(results)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		messages := make([]llm.Message, 0, len(system)+len(history)+len(prompt))
+		messages = append(messages, system...)
+		messages = append(messages, history...)
+		messages = append(messages, prompt...)
+		if countTokens(messages) <= budget || len(results) == 0 {
+			return messages, results, sources, nil
+		}
+		results = results[:len(results)-1]
+	}
+}
+
+func countTokens(messages []llm.Message) int {
+	tokens := 0
+	for _, message := range messages {
+		tokens += chunker.CountTokens(message.Content)
+	}
+	return tokens
+}
+
+// fit keeps the best results whose text fits in budget tokens, dropping the
+// lowest ranked ones first
+func fit(results []retrieval.Result, budget int) []retrieval.Result {
+	used := 0
+	for i, result := range results {
+		used += chunker.CountTokens(result.Text)
+		if used > budget {
+			return results[:i]
+		}
+	}
+	return results
+}
+
+func llmRequest(project settings.Project, messages []llm.Message) llm.Request {
+	return llm.Request{
+		Messages:    messages,
+		Temperature: project.Generation.Temperature,
+	}
+}
+
+// Answer answers request.Query. history is the conversation so far (if any),
+// request.Query should already make sense without it (see Rewrite).
+func (a *Answerer) Answer(ctx context.Context, project settings.Project, request retrieval.Request, history []llm.Message) (Answer, error) {
+	provider, results, sources, messages, err := a.prompt(ctx, project, request, history)
+	if err != nil {
+		return Answer{}, err
+	}
+
+	response, err := provider.Complete(ctx, llmRequest(project, messages))
+	if err != nil {
+		return Answer{}, err
+	}
+
+	return Answer{
+		Answer:    response.Content,
+		Citations: Citations(response.Content, sources),
+		Sources:   results,
+		Model:     provider.Model(),
+		Usage:     response.Usage,
+	}, nil
+}
+
+// Stream answers like Answer, but sends the answer to emit as it's generated:
+// a RetrievalEvent, a DeltaEvent per piece of the answer, then a
+// CitationsEvent and a UsageEvent. An error from emit (e.g. the client went
+// away) stops the stream and is returned.
+func (a *Answerer) Stream(ctx context.Context, project settings.Project, request retrieval.Request, history []llm.Message, emit func(event string, data any) error) error {
+	provider, results, sources, messages, err := a.prompt(ctx, project, request, history)
+	if err != nil {
+		return err
+	}
+
+	if err := emit(EventRetrieval, RetrievalEvent{Sources: results}); err != nil {
+		return err
+	}
+
+	response, err := provider.Stream(ctx, llmRequest(project, messages), func(delta string) error {
+		return emit(EventDelta, DeltaEvent{Text: delta})
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := emit(EventCitations, CitationsEvent{Citations: Citations(response.Content, sources)}); err != nil {
+		return err
+	}
+
+	return emit(EventUsage, UsageEvent{Model: provider.Model(), Usage: response.Usage})
+}
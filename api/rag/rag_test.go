@@ -0,0 +1,231 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"intualai/llm"
+	"intualai/retrieval"
+	"intualai/settings"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func testSources() []Source {
+	page := int32(3)
+	return sources([]retrieval.Result{
+		{ChunkID: "chunk-a", FileName: "a.pdf", Page: &page, Text: "Invoices are due within 30 days."},
+		{ChunkID: "chunk-b", FileName: "b.txt", Text: "Late invoices cost 2% a month."},
+		{ChunkID: "chunk-c", FileName: "c.md", Text: "Refunds take a week."},
+	})
+}
+
+func TestCitations(t *testing.T) {
+	tests := []struct {
+		answer string
+		want   []int
+	}{
+		{answer: "No citations.", want: []int{}},
+		{answer: "Due in 30 days [1].", want: []int{1}},
+		{answer: "Late fees apply [2][1].", want: []int{2, 1}},
+		{answer: "Both [1, 3] say so.", want: []int{1, 3}},
+		// Cited once, in order of first citation
+		{answer: "See [3]. Also [1] and again [3].", want: []int{3, 1}},
+		// Made up sources
+		{answer: "Per [0], [4] and [12], not [2].", want: []int{2}},
+		{answer: "Brackets [a] and [ ] aren't markers.", want: []int{}},
+	}
+
+	sources := testSources()
+
+	for _, test := range tests {
+		t.Run(test.answer, func(t *testing.T) {
+			got := []int{}
+			for _, citation := range Citations(test.answer, sources) {
+				got = append(got, citation.Marker)
+
+				source := sources[citation.Marker-1]
+				if citation.ChunkID != source.ChunkID || citation.FileName != source.FileName {
+					t.Errorf("[%d] cites %s in %s, want %s in %s", citation.Marker, citation.ChunkID, citation.FileName, source.ChunkID, source.FileName)
+				}
+				if (citation.Page == nil) != (source.Page == 0) {
+					t.Errorf("[%d] has page %v, source has %d", citation.Marker, citation.Page, source.Page)
+				}
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Citations = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBuildPrompt(t *testing.T) {
+	data := PromptData{Question: "When are invoices due?", Sources: testSources()}
+
+	messages, err := BuildPrompt("", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || messages[0].Role != llm.RoleUser {
+		t.Fatalf("got %+v, want a single user message", messages)
+	}
+
+	prompt := messages[0].Content
+	for _, want := range []string{
+		"[1] a.pdf (page 3)\nInvoices are due within 30 days.",
+		"[2] b.txt\nLate invoices cost 2% a month.",
+		"[3] c.md\nRefunds take a week.",
+		"Question: When are invoices due?",
+	} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt doesn't contain %q:\n%s", want, prompt)
+		}
+	}
+
+	messages, err = BuildPrompt("{{.Question}} from {{len .Sources}} sources", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "When are invoices due? from 3 sources"; messages[0].Content != want {
+		t.Errorf("custom template rendered %q, want %q", messages[0].Content, want)
+	}
+}
+
+func TestParseTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		ok       bool
+	}{
+		{name: "default", template: DefaultTemplate, ok: true},
+		{name: "no question", template: "{{range .Sources}}{{.Text}}{{end}}"},
+		{name: "no sources", template: "{{.Question}}"},
+		{name: "syntax", template: "{{.Question}} {{range .Sources}}"},
+		{name: "unknown field", template: "{{.Question}} {{range .Sources}}{{.Score}}{{end}}"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseTemplate(test.template)
+			if test.ok && err != nil {
+				t.Error(err)
+			}
+			if !test.ok && err == nil {
+				t.Error("template is valid")
+			}
+		})
+	}
+}
+
+func TestEchoAnswer(t *testing.T) {
+	provider := llm.NewEcho("Invoices are due within 30 days [1], late ones cost extra [2].")
+	sources := testSources()
+
+	messages, err := BuildPrompt("", PromptData{Question: "When are invoices due?", Sources: sources})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var streamed strings.Builder
+	response, err := provider.Stream(context.Background(), llm.Request{Messages: messages}, func(delta string) error {
+		streamed.WriteString(delta)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if streamed.String() != response.Content || response.Content != provider.Answer {
+		t.Errorf("streamed %q and returned %q, want %q", streamed.String(), response.Content, provider.Answer)
+	}
+	if response.Usage.TotalTokens != response.Usage.PromptTokens+response.Usage.CompletionTokens || response.Usage.PromptTokens == 0 {
+		t.Errorf("usage %+v doesn't add up", response.Usage)
+	}
+
+	citations := Citations(response.Content, sources)
+	if len(citations) != 2 || citations[0].ChunkID != "chunk-a" || citations[1].ChunkID != "chunk-b" {
+		t.Errorf("citations = %+v, want chunk-a and chunk-b", citations)
+	}
+
+	// Without an answer it echoes the prompt
+	response, err = llm.NewEcho("").Complete(context.Background(), llm.Request{Messages: messages})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Content != messages[0].Content {
+		t.Errorf("echoed %q, want the prompt", response.Content)
+	}
+}
+
+func TestFit(t *testing.T) {
+	results := []retrieval.Result{{Text: "one two three"}, {Text: "four five"}, {Text: "six"}}
+
+	for budget, want := range map[int]int{0: 0, 2: 0, 3: 1, 4: 1, 5: 2, 6: 3, 100: 3} {
+		if got := len(fit(results, budget)); got != want {
+			t.Errorf("fit(%d) kept %d results, want %d", budget, got, want)
+		}
+	}
+}
+
+func TestBuildMessagesBudget(t *testing.T) {
+	var project settings.Project
+	project.Generation.MaxContextTokens = 450
+	project.Generation.SystemPrompt = "You answer questions about invoices."
+
+	var results []retrieval.Result
+	for i := range 10 {
+		results = append(results, retrieval.Result{ChunkID: fmt.Sprint(i), FileName: "invoices.pdf", Text: strings.Repeat("Invoices are due within 30 days. ", 4)})
+	}
+
+	turn := func(words int) []llm.Message {
+		return []llm.Message{
+			{Role: llm.RoleUser, Content: strings.Repeat("question ", words)},
+			{Role: llm.RoleAssistant, Content: strings.Repeat("answer ", words)},
+		}
+	}
+	var long []llm.Message
+	for range MaxHistory / 2 {
+		long = append(long, turn(15)...)
+	}
+
+	tests := []struct {
+		name    string
+		history []llm.Message
+		// How many of the last messages of history are kept
+		keptHistory int
+		results     int
+	}{
+		// 68 tokens of template and system prompt, 34 per source
+		{name: "no history", results: 10},
+		// The chunk texts alone would fit, not with their numbers and file names
+		{name: "short history", history: turn(30), keptHistory: 2, results: 9},
+		{name: "long history", history: long, keptHistory: MaxHistory, results: 6},
+		// Even the prompt without sources doesn't fit next to all of it
+		{name: "history over budget", history: slices.Concat(long[2:], turn(150)), keptHistory: 7, results: 0},
+		{name: "last turn over budget", history: turn(400), keptHistory: 0, results: 10},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			messages, kept, sources, err := buildMessages(project, "When are invoices due?", results, test.history)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tokens := countTokens(messages); tokens > project.Generation.MaxContextTokens {
+				t.Errorf("sending %d tokens, over the budget of %d", tokens, project.Generation.MaxContextTokens)
+			}
+			if len(kept) != test.results || len(sources) != len(kept) {
+				t.Errorf("kept %d results and %d sources, want %d", len(kept), len(sources), test.results)
+			}
+			// System prompt, history, then the prompt
+			if messages[0].Role != llm.RoleSystem || len(messages) != test.keptHistory+2 {
+				t.Fatalf("got %d messages, want the system prompt, %d of history and the prompt", len(messages), test.keptHistory)
+			}
+			if history := messages[1 : len(messages)-1]; !slices.Equal(history, test.history[len(test.history)-test.keptHistory:]) {
+				t.Errorf("history isn't the last %d messages", test.keptHistory)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"intualai/llm"
+	"strings"
+)
+
+const rewritePrompt = `Rewrite the follow-up question below so it can be understood without the conversation, e.g. replace "it" or "that one" with what they refer to. Keep everything else the same. Reply with only the rewritten question.
+
+Conversation:
+%s
+Follow-up question: %s`
+
+// Rewrite turns a follow-up question ("what about the second one?") into one
+// that can be searched on its own, using the conversation so far. Questions
+// without history are returned as is.
+func Rewrite(ctx context.Context, provider llm.LLMProvider, history []llm.Message, question string) (string, error) {
+	if len(history) == 0 {
+		return question, nil
+	}
+
+	var conversation strings.Builder
+	for _, message := range history[max(0, len(history)-MaxHistory):] {
+		fmt.Fprintf(&conversation, "%s: %s\n", message.Role, message.Content)
+	}
+
+	response, err := provider.Complete(ctx, llm.Request{
+		Messages: []llm.Message{{Role: llm.RoleUser, Content: fmt.Sprintf(rewritePrompt, conversation.String(), question)}},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	rewritten := strings.TrimSpace(response.Content)
+	if rewritten == "" {
+		return question, nil
+	}
+	return rewritten, nil
+}
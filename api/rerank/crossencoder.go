@@ -0,0 +1,118 @@
+package rerank
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"intualai/retrieval"
+	"intualai/settings"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// CrossEncoder sends the query and every chunk to a reranking model over
+// HTTP. It speaks the /rerank API shared by Cohere, Jina, vLLM, LocalAI and
+// text-embeddings-inference, so a local stand-in works the same way.
+type CrossEncoder struct {
+	baseUrl string
+	apiKey  string
+	model   string
+	client  *http.Client
+}
+
+func NewCrossEncoder(baseUrl string, apiKey string, model string) *CrossEncoder {
+	return &CrossEncoder{
+		baseUrl: strings.TrimSuffix(baseUrl, "/"),
+		apiKey:  apiKey,
+		model:   model,
+		client:  &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+type crossEncoderRequest struct {
+	Model     string   `json:"model,omitempty"`
+	Query     string   `json:"query"`
+	Documents []string `json:"documents"`
+	TopN      int      `json:"top_n"`
+}
+
+type crossEncoderResponse struct {
+	Results []struct {
+		Index          int     `json:"index"`
+		RelevanceScore float32 `json:"relevance_score"`
+	} `json:"results"`
+}
+
+func (e *CrossEncoder) Rerank(ctx context.Context, project settings.Project, query string, results []retrieval.Result, topK int) ([]retrieval.Result, error) {
+	if len(results) == 0 {
+		return results, nil
+	}
+
+	documents := make([]string, len(results))
+	for i, result := range results {
+		documents[i] = result.Text
+	}
+
+	body, err := json.Marshal(crossEncoderRequest{
+		Model:     e.model,
+		Query:     query,
+		Documents: documents,
+		TopN:      min(topK, len(results)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.baseUrl+"/rerank", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.apiKey)
+	}
+
+	res, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return nil, fmt.Errorf("rerank request failed with %s: %s", res.Status, message)
+	}
+
+	var response crossEncoderResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+
+	reranked := make([]retrieval.Result, 0, len(response.Results))
+	for _, item := range response.Results {
+		if item.Index < 0 || item.Index >= len(results) {
+			return nil, fmt.Errorf("rerank response has out of range index %d", item.Index)
+		}
+
+		result := results[item.Index]
+		result.Score = item.RelevanceScore
+		reranked = append(reranked, result)
+	}
+
+	// Most servers sort already, not all of them
+	slices.SortStableFunc(reranked, func(a, b retrieval.Result) int {
+		if a.Score > b.Score {
+			return -1
+		}
+		if a.Score < b.Score {
+			return 1
+		}
+		return 0
+	})
+
+	return reranked[:min(topK, len(reranked))], nil
+}
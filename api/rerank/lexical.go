@@ -0,0 +1,48 @@
+package rerank
+
+import (
+	"context"
+	"intualai/retrieval"
+	"intualai/settings"
+	"slices"
+)
+
+// Lexical reranks by how many of the query's words a chunk contains. It needs
+// no model, chunks with the same overlap keep their first-stage order.
+type Lexical struct{}
+
+func NewLexical() *Lexical {
+	return &Lexical{}
+}
+
+func (l *Lexical) Rerank(ctx context.Context, project settings.Project, query string, results []retrieval.Result, topK int) ([]retrieval.Result, error) {
+	queryTerms := terms(query)
+	if len(queryTerms) == 0 {
+		return results[:min(topK, len(results))], nil
+	}
+
+	reranked := slices.Clone(results)
+	for i := range reranked {
+		chunkTerms := terms(reranked[i].Text)
+
+		matched := 0
+		for term := range queryTerms {
+			if chunkTerms[term] {
+				matched++
+			}
+		}
+		reranked[i].Score = float32(matched) / float32(len(queryTerms))
+	}
+
+	slices.SortStableFunc(reranked, func(a, b retrieval.Result) int {
+		if a.Score > b.Score {
+			return -1
+		}
+		if a.Score < b.Score {
+			return 1
+		}
+		return 0
+	})
+
+	return reranked[:min(topK, len(reranked))], nil
+}
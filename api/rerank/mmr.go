@@ -0,0 +1,109 @@
+package rerank
+
+import (
+	"context"
+	"intualai/embedding"
+	"intualai/retrieval"
+	"intualai/settings"
+	"math"
+)
+
+// MMR (maximal marginal relevance) trades a little relevance for variety, so
+// the top results aren't near-copies of each other (e.g. the same paragraph
+// from several versions of a document). It picks results one at a time,
+// scoring each by Lambda * similarity to the query - (1 - Lambda) * its
+// highest similarity to an already picked result.
+//
+// Results are compared by their stored vectors, only the query (and results
+// whose vector is missing or from another model) is embedded.
+type MMR struct {
+	embedders *embedding.Registry
+	// 1 only looks at relevance, 0 only at variety
+	Lambda float64
+}
+
+func NewMMR(embedders *embedding.Registry) *MMR {
+	return &MMR{embedders: embedders, Lambda: 0.7}
+}
+
+func (m *MMR) Rerank(ctx context.Context, project settings.Project, query string, results []retrieval.Result, topK int) ([]retrieval.Result, error) {
+	if len(results) == 0 {
+		return results, nil
+	}
+
+	embedder, err := m.embedders.Resolve(project.Embedding.Model, project.ModelType)
+	if err != nil {
+		return nil, err
+	}
+
+	// Results without a usable vector are embedded along with the query
+	texts := []string{query}
+	var missing []int
+	chunkVectors := make([][]float32, len(results))
+	for i, result := range results {
+		if len(result.Vector) == 0 || result.VectorModel != embedder.Model() {
+			texts = append(texts, result.Text)
+			missing = append(missing, i)
+			continue
+		}
+		chunkVectors[i] = result.Vector
+	}
+
+	vectors, err := embedding.EmbedAll(ctx, embedder, texts)
+	if err != nil {
+		return nil, err
+	}
+	queryVector := vectors[0]
+	for i, result := range missing {
+		chunkVectors[result] = vectors[i+1]
+	}
+
+	relevance := make([]float64, len(results))
+	for i, vector := range chunkVectors {
+		relevance[i] = cosine(queryVector, vector)
+	}
+
+	// Highest similarity of each result to the picked ones so far
+	redundancy := make([]float64, len(results))
+	picked := make([]bool, len(results))
+
+	reranked := make([]retrieval.Result, 0, min(topK, len(results)))
+	for len(reranked) < cap(reranked) {
+		best, bestScore := -1, math.Inf(-1)
+		for i := range results {
+			if picked[i] {
+				continue
+			}
+			score := m.Lambda*relevance[i] - (1-m.Lambda)*redundancy[i]
+			if score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+
+		picked[best] = true
+		result := results[best]
+		result.Score = float32(bestScore)
+		reranked = append(reranked, result)
+
+		for i := range results {
+			if !picked[i] {
+				redundancy[i] = max(redundancy[i], cosine(chunkVectors[i], chunkVectors[best]))
+			}
+		}
+	}
+
+	return reranked, nil
+}
+
+func cosine(a []float32, b []float32) float64 {
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(normA*normB)
+}
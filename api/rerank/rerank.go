@@ -0,0 +1,35 @@
+package rerank
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Reranker names, picked with retrieval.reranker in project settings
+const (
+	CrossEncoderName = "cross_encoder"
+	LexicalName      = "lexical"
+	MMRName          = "mmr"
+)
+
+var wordPattern = regexp.MustCompile(`[\p{L}\p{M}\p{N}]+`)
+
+// terms returns the distinct lowercased words of text
+func terms(text string) map[string]bool {
+	set := map[string]bool{}
+	for _, word := range wordPattern.FindAllString(strings.ToLower(text), -1) {
+		if !stopWords[word] {
+			set[word] = true
+		}
+	}
+	return set
+}
+
+// Words too common to say anything about relevance
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true,
+	"by": true, "do": true, "does": true, "for": true, "from": true, "how": true, "in": true,
+	"is": true, "it": true, "of": true, "on": true, "or": true, "that": true, "the": true,
+	"this": true, "to": true, "was": true, "what": true, "when": true, "where": true,
+	"which": true, "who": true, "why": true, "with": true,
+}
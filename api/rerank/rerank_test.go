@@ -0,0 +1,232 @@
+package rerank
+
+import (
+	"context"
+	"encoding/json"
+	"intualai/embedding"
+	"intualai/retrieval"
+	"intualai/settings"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testProject = settings.Project{ModelType: "hash"}
+
+func results(texts ...string) []retrieval.Result {
+	results := make([]retrieval.Result, len(texts))
+	for i, text := range texts {
+		results[i] = retrieval.Result{ChunkID: string(rune('a' + i)), Text: text, Score: 1 - float32(i)/10}
+	}
+	return results
+}
+
+func chunkIDs(results []retrieval.Result) string {
+	var ids strings.Builder
+	for _, result := range results {
+		ids.WriteString(result.ChunkID)
+	}
+	return ids.String()
+}
+
+func TestLexical(t *testing.T) {
+	candidates := results(
+		"Refunds take a week.",
+		"Invoices are due within 30 days.",
+		"Late invoices cost 2% a month, payment by card.",
+		"Payment is by bank transfer.",
+	)
+
+	tests := []struct {
+		name  string
+		query string
+		topK  int
+		want  string
+	}{
+		{name: "most overlap first", query: "late invoice payment", topK: 4, want: "cdab"},
+		// Chunks matching as many words keep their first-stage order
+		{name: "ties keep order", query: "invoices payment", topK: 4, want: "cbda"},
+		{name: "case and punctuation", query: "REFUNDS?", topK: 4, want: "abcd"},
+		{name: "cut to top k", query: "late invoice payment", topK: 2, want: "cd"},
+		// Only stop words, nothing to go on
+		{name: "no terms", query: "what is the", topK: 3, want: "abc"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reranked, err := NewLexical().Rerank(context.Background(), testProject, test.query, candidates, test.topK)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := chunkIDs(reranked); got != test.want {
+				t.Errorf("order = %s, want %s", got, test.want)
+			}
+		})
+	}
+
+	reranked, _ := NewLexical().Rerank(context.Background(), testProject, "late invoice payment", candidates, 1)
+	if reranked[0].Score != float32(2)/3 {
+		t.Errorf("score = %v, want the share of query words matched", reranked[0].Score)
+	}
+}
+
+func TestCrossEncoder(t *testing.T) {
+	candidates := results("first", "second", "third")
+
+	tests := []struct {
+		name     string
+		status   int
+		response string
+		topK     int
+		want     string
+		wantErr  bool
+	}{
+		{name: "sorted", status: http.StatusOK, response: `{"results":[{"index":2,"relevance_score":0.9},{"index":0,"relevance_score":0.5}]}`, topK: 2, want: "ca"},
+		{name: "unsorted", status: http.StatusOK, response: `{"results":[{"index":1,"relevance_score":0.1},{"index":0,"relevance_score":0.8},{"index":2,"relevance_score":0.4}]}`, topK: 3, want: "acb"},
+		// Servers that ignore top_n
+		{name: "more than top k", status: http.StatusOK, response: `{"results":[{"index":1,"relevance_score":0.1},{"index":0,"relevance_score":0.8},{"index":2,"relevance_score":0.4}]}`, topK: 1, want: "a"},
+		{name: "index out of range", status: http.StatusOK, response: `{"results":[{"index":3,"relevance_score":0.9}]}`, topK: 2, wantErr: true},
+		{name: "server error", status: http.StatusInternalServerError, response: `model not loaded`, topK: 2, wantErr: true},
+		{name: "bad json", status: http.StatusOK, response: `{"results":`, topK: 2, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var request crossEncoderRequest
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/rerank" || r.Header.Get("Authorization") != "Bearer key" {
+					t.Errorf("got %s with %q", r.URL.Path, r.Header.Get("Authorization"))
+				}
+				if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+					t.Error(err)
+				}
+				w.WriteHeader(test.status)
+				w.Write([]byte(test.response))
+			}))
+			defer server.Close()
+
+			reranked, err := NewCrossEncoder(server.URL+"/", "key", "rerank-model").Rerank(context.Background(), testProject, "query", candidates, test.topK)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("got %s, want an error", chunkIDs(reranked))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := crossEncoderRequest{Model: "rerank-model", Query: "query", Documents: []string{"first", "second", "third"}, TopN: test.topK}
+			if !reflect.DeepEqual(request, want) {
+				t.Errorf("request = %+v, want %+v", request, want)
+			}
+			if got := chunkIDs(reranked); got != test.want {
+				t.Errorf("order = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func hashEmbedders() *embedding.Registry {
+	embedders := embedding.NewRegistry(embedding.ProviderHash)
+	embedders.Register(embedding.ProviderHash, func(model string) (embedding.Embedder, error) {
+		return embedding.NewHash(256), nil
+	})
+	return embedders
+}
+
+func TestMMR(t *testing.T) {
+	// b repeats a, MMR should rather show c next even though it's less similar
+	// to the query
+	candidates := results(
+		"Invoices are due within 30 days of the invoice date.",
+		"Invoices are due within 30 days of the invoice date, as agreed.",
+		"Late invoices cost 2% interest a month.",
+	)
+	query := "when are invoices due"
+
+	tests := []struct {
+		name   string
+		lambda float64
+		want   string
+	}{
+		{name: "relevance only", lambda: 1, want: "abc"},
+		{name: "diverse", lambda: 0.5, want: "acb"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mmr := NewMMR(hashEmbedders())
+			mmr.Lambda = test.lambda
+
+			reranked, err := mmr.Rerank(context.Background(), testProject, query, candidates, 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := chunkIDs(reranked); got != test.want {
+				t.Errorf("order = %s, want %s", got, test.want)
+			}
+		})
+	}
+
+	reranked, err := NewMMR(hashEmbedders()).Rerank(context.Background(), testProject, query, candidates, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reranked) != 2 {
+		t.Errorf("got %d results, want 2", len(reranked))
+	}
+}
+
+// countingEmbedder records every text it embeds
+type countingEmbedder struct {
+	embedding.Embedder
+	texts []string
+}
+
+func (e *countingEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	e.texts = append(e.texts, texts...)
+	return e.Embedder.Embed(ctx, texts)
+}
+
+func TestMMRStoredVectors(t *testing.T) {
+	candidates := results(
+		"Invoices are due within 30 days of the invoice date.",
+		"Invoices are due within 30 days of the invoice date, as agreed.",
+		"Late invoices cost 2% interest a month.",
+	)
+	query := "when are invoices due"
+
+	counter := &countingEmbedder{Embedder: embedding.NewHash(256)}
+	for i := range candidates {
+		vectors, err := counter.Embedder.Embed(context.Background(), []string{candidates[i].Text})
+		if err != nil {
+			t.Fatal(err)
+		}
+		candidates[i].Vector, candidates[i].VectorModel = vectors[0], counter.Model()
+	}
+	// Embedded before the project switched models, it can't be compared
+	candidates[2].VectorModel = "openai/text-embedding-3-small"
+
+	embedders := embedding.NewRegistry(embedding.ProviderHash)
+	embedders.Register(embedding.ProviderHash, func(model string) (embedding.Embedder, error) {
+		return counter, nil
+	})
+
+	mmr := NewMMR(embedders)
+	mmr.Lambda = 0.5
+	reranked, err := mmr.Rerank(context.Background(), testProject, query, candidates, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Same order as when everything is embedded again
+	if got := chunkIDs(reranked); got != "acb" {
+		t.Errorf("order = %s, want acb", got)
+	}
+	if want := []string{query, candidates[2].Text}; !reflect.DeepEqual(counter.texts, want) {
+		t.Errorf("embedded %q, want only %q", counter.texts, want)
+	}
+}
@@ -0,0 +1,64 @@
+package retrieval
+
+import "slices"
+
+// rrfK dampens how much the top ranks dominate, 60 is the value from the
+// original reciprocal rank fusion paper
+const rrfK = 60
+
+// In hybrid mode each list fetches this many times top_k before fusing
+const hybridCandidates = 4
+
+// Ranking is one list of results to fuse, best first
+type Ranking struct {
+	Results []Result
+	Weight  float64
+}
+
+// Fuse merges rankings with weighted reciprocal rank fusion: every chunk
+// scores the sum of weight / (rrfK + rank) over the lists it's in, so chunks
+// found by several lists rise to the top. Only ranks matter, the lists' own
+// scores don't need to be comparable. Returns up to limit results with their
+// fused score.
+func Fuse(limit int, rankings []Ranking) []Result {
+	scores := map[string]float64{}
+	byId := map[string]Result{}
+	// Order chunks were first seen in, keeps ties stable
+	var order []string
+
+	for _, ranking := range rankings {
+		if ranking.Weight == 0 {
+			continue
+		}
+
+		for rank, result := range ranking.Results {
+			if _, ok := byId[result.ChunkID]; !ok {
+				byId[result.ChunkID] = result
+				order = append(order, result.ChunkID)
+			}
+			scores[result.ChunkID] += ranking.Weight / float64(rrfK+rank+1)
+		}
+	}
+
+	slices.SortStableFunc(order, func(a, b string) int {
+		if scores[a] > scores[b] {
+			return -1
+		}
+		if scores[a] < scores[b] {
+			return 1
+		}
+		return 0
+	})
+
+	if len(order) > limit {
+		order = order[:limit]
+	}
+
+	results := make([]Result, 0, len(order))
+	for _, id := range order {
+		result := byId[id]
+		result.Score = float32(scores[id])
+		results = append(results, result)
+	}
+	return results
+}
@@ -0,0 +1,83 @@
+package retrieval
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func ranking(weight float64, ids ...string) Ranking {
+	results := make([]Result, len(ids))
+	for i, id := range ids {
+		results[i] = Result{ChunkID: id}
+	}
+	return Ranking{Results: results, Weight: weight}
+}
+
+func TestFuse(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    int
+		rankings []Ranking
+		want     []string
+	}{
+		{name: "nothing", limit: 10, rankings: nil, want: []string{}},
+		{name: "single list keeps its order", limit: 10, rankings: []Ranking{ranking(1, "a", "b", "c")}, want: []string{"a", "b", "c"}},
+		{name: "limit", limit: 2, rankings: []Ranking{ranking(1, "a", "b", "c")}, want: []string{"a", "b"}},
+		{
+			name:     "found by both lists rises",
+			limit:    10,
+			rankings: []Ranking{ranking(1, "a", "b", "c"), ranking(1, "d", "e", "c")},
+			want:     []string{"c", "a", "d", "b", "e"},
+		},
+		{
+			// Equal ranks score the same, first seen wins
+			name:     "ties keep first seen order",
+			limit:    10,
+			rankings: []Ranking{ranking(1, "a", "b"), ranking(1, "c", "d")},
+			want:     []string{"a", "c", "b", "d"},
+		},
+		{
+			name:     "weights",
+			limit:    10,
+			rankings: []Ranking{ranking(1, "a", "b"), ranking(2, "c", "d")},
+			want:     []string{"c", "d", "a", "b"},
+		},
+		{
+			name:     "zero weight is skipped",
+			limit:    10,
+			rankings: []Ranking{ranking(0, "a", "b"), ranking(1, "c", "a")},
+			want:     []string{"c", "a"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := []string{}
+			for _, result := range Fuse(test.limit, test.rankings) {
+				got = append(got, result.ChunkID)
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Fuse = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFuseScores(t *testing.T) {
+	results := Fuse(10, []Ranking{ranking(1, "a", "b"), ranking(0.5, "b")})
+
+	want := map[string]float64{
+		"a": 1.0 / (rrfK + 1),
+		"b": 1.0/(rrfK+2) + 0.5/(rrfK+1),
+	}
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(results), len(want))
+	}
+	for _, result := range results {
+		if math.Abs(float64(result.Score)-want[result.ChunkID]) > 1e-6 {
+			t.Errorf("%s scored %f, want %f", result.ChunkID, result.Score, want[result.ChunkID])
+		}
+	}
+}
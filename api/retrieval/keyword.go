@@ -0,0 +1,83 @@
+package retrieval
+
+import (
+	"context"
+	"intualai/gen"
+	"intualai/settings"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var queryWord = regexp.MustCompile(`[\p{L}\p{M}\p{N}]+`)
+
+// anyWord turns a query into a tsquery matching any of its words, e.g. "late
+// invoices?" becomes "late | invoices". to_tsquery then stems them and drops
+// stop words, the way plainto_tsquery would. Only runs of letters and digits
+// are kept, nothing in the query can be read as an operator. Empty if the
+// query has no words.
+func anyWord(query string) string {
+	return strings.Join(queryWord.FindAllString(query, -1), " | ")
+}
+
+// keywordSearch runs a full-text search over the project's chunks
+// (chunks.search). Scores are ts_rank_cd, they aren't comparable to cosine
+// similarities.
+func (r *Retriever) keywordSearch(ctx context.Context, project settings.Project, request Request, limit int) ([]Result, error) {
+	query := anyWord(request.Query)
+	if query == "" {
+		return []Result{}, nil
+	}
+
+	params := gen.SearchChunksKeywordParams{
+		Query:      query,
+		ProjectID:  project.ID,
+		FileNames:  request.Filters.FileNames,
+		Tags:       request.Filters.Tags,
+		MaxResults: int32(limit),
+	}
+	if len(params.FileNames) == 0 {
+		params.FileNames = nil
+	}
+	if len(params.Tags) == 0 {
+		params.Tags = nil
+	}
+	if request.Filters.CreatedAfter != nil {
+		params.CreatedAfter = pgtype.Timestamp{Time: request.Filters.CreatedAfter.UTC(), Valid: true}
+	}
+	if request.Filters.CreatedBefore != nil {
+		params.CreatedBefore = pgtype.Timestamp{Time: request.Filters.CreatedBefore.UTC(), Valid: true}
+	}
+
+	chunks, err := r.queries.SearchChunksKeyword(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]Result, 0, len(chunks))
+	for _, chunk := range chunks {
+		result := Result{
+			ChunkID:     uuid.UUID(chunk.ID.Bytes).String(),
+			FileName:    chunk.FileName,
+			ChunkIndex:  chunk.ChunkIndex,
+			StartOffset: chunk.StartOffset,
+			EndOffset:   chunk.EndOffset,
+			Text:        chunk.Content,
+			Score:       chunk.Score,
+			Vector:      chunk.Embedding,
+			VectorModel: chunk.EmbeddingModel.String,
+		}
+		if chunk.Page.Valid {
+			result.Page = &chunk.Page.Int32
+		}
+		if chunk.Section.Valid {
+			result.Section = &chunk.Section.String
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
@@ -0,0 +1,25 @@
+package retrieval
+
+import "testing"
+
+func TestAnyWord(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "late invoices", want: "late | invoices"},
+		{query: "  When are invoices due?  ", want: "When | are | invoices | due"},
+		{query: "Café über 30 days", want: "Café | über | 30 | days"},
+		// tsquery syntax is only text here
+		{query: "late & !paid | (due:* <-> 'now')", want: "late | paid | due | now"},
+		{query: "it's e-mail", want: "it | s | e | mail"},
+		{query: "?! ...", want: ""},
+		{query: "", want: ""},
+	}
+
+	for _, test := range tests {
+		if got := anyWord(test.query); got != test.want {
+			t.Errorf("anyWord(%q) = %q, want %q", test.query, got, test.want)
+		}
+	}
+}
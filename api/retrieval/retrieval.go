@@ -0,0 +1,310 @@
+package retrieval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"intualai/embedding"
+	"intualai/gen"
+	"intualai/settings"
+	"intualai/vectorstore"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rs/zerolog/log"
+)
+
+// Most results a request can ask for
+const MaxTopK = settings.MaxTopK
+
+// Search modes, projects pick a default with retrieval.mode in their settings
+type Mode = settings.Mode
+
+const (
+	ModeVector  = settings.ModeVector
+	ModeKeyword = settings.ModeKeyword
+	ModeHybrid  = settings.ModeHybrid
+)
+
+var ErrEmptyQuery = errors.New("query must not be empty")
+
+// Filters narrow a search down to some of the project's files. Empty fields
+// don't filter.
+type Filters struct {
+	// Files with any of these names
+	FileNames []string `json:"file_names,omitempty"`
+	// Files with at least one of these tags
+	Tags []string `json:"tags,omitempty"`
+	// Files uploaded in this range (inclusive)
+	CreatedAfter  *time.Time `json:"created_after,omitempty"`
+	CreatedBefore *time.Time `json:"created_before,omitempty"`
+}
+
+type Request struct {
+	Query string `json:"query"`
+	// 0 uses the project's retrieval.top_k
+	TopK int `json:"top_k"`
+	// Empty uses the project's retrieval.mode
+	Mode Mode `json:"mode"`
+	// Cosine similarity vector results need to reach, 0 keeps everything.
+	// Keyword results aren't affected.
+	ScoreThreshold float32 `json:"score_threshold"`
+	Filters        Filters `json:"filters"`
+	// How much each list counts in hybrid mode, both default to 1
+	VectorWeight  *float64 `json:"vector_weight,omitempty"`
+	KeywordWeight *float64 `json:"keyword_weight,omitempty"`
+}
+
+// Validate checks a request before it's searched, the error is meant for the
+// caller
+func (r Request) Validate() error {
+	if r.Query == "" {
+		return ErrEmptyQuery
+	}
+	if r.TopK < 0 || r.TopK > MaxTopK {
+		return fmt.Errorf("top_k must be between 1 and %d", MaxTopK)
+	}
+	if r.Mode != "" && !r.Mode.Valid() {
+		return fmt.Errorf("mode must be %s, %s or %s", ModeVector, ModeKeyword, ModeHybrid)
+	}
+	if (r.VectorWeight != nil && *r.VectorWeight < 0) || (r.KeywordWeight != nil && *r.KeywordWeight < 0) {
+		return errors.New("weights must not be negative")
+	}
+	return nil
+}
+
+// Result is a chunk that matched, with enough to cite it
+type Result struct {
+	ChunkID     string  `json:"chunk_id"`
+	FileName    string  `json:"file_name"`
+	ChunkIndex  int32   `json:"chunk_index"`
+	Page        *int32  `json:"page"`
+	Section     *string `json:"section"`
+	StartOffset int32   `json:"start_offset"`
+	EndOffset   int32   `json:"end_offset"`
+	Text        string  `json:"text"`
+	Score       float32 `json:"score"`
+	// The chunk's stored embedding and its model, so rerankers don't have to
+	// embed it again. Empty if the chunk wasn't embedded.
+	Vector      []float32 `json:"-"`
+	VectorModel string    `json:"-"`
+}
+
+// Reranker reorders first-stage results, e.g. with a model that's too slow to
+// run over the whole project. Implementations live in rerank/.
+type Reranker interface {
+	// Rerank returns up to topK of results, best first, with the reranker's
+	// scores
+	Rerank(ctx context.Context, project settings.Project, query string, results []Result, topK int) ([]Result, error)
+}
+
+// Retriever finds the chunks of a project closest to a query
+type Retriever struct {
+	queries   *gen.Queries
+	embedders *embedding.Registry
+	vectors   vectorstore.VectorStore
+
+	// Rerankers by name, projects pick one with retrieval.reranker
+	Rerankers map[string]Reranker
+}
+
+func New(queries *gen.Queries, embedders *embedding.Registry, vectors vectorstore.VectorStore) *Retriever {
+	return &Retriever{queries: queries, embedders: embedders, vectors: vectors}
+}
+
+// Search returns up to request.TopK chunks, best first. If the project has a
+// reranker, the first rerank_depth results are reranked (see rerank).
+func (r *Retriever) Search(ctx context.Context, project settings.Project, request Request) ([]Result, error) {
+	if err := request.Validate(); err != nil {
+		return nil, err
+	}
+	if request.TopK == 0 {
+		request.TopK = project.Retrieval.TopK
+	}
+
+	if project.Retrieval.Reranker == "" {
+		return r.search(ctx, project, request)
+	}
+
+	reranker, ok := r.Rerankers[project.Retrieval.Reranker]
+	if !ok {
+		return nil, fmt.Errorf("reranker %q isn't configured", project.Retrieval.Reranker)
+	}
+
+	topK := request.TopK
+	request.TopK = max(topK, project.Retrieval.RerankDepth)
+
+	results, err := r.search(ctx, project, request)
+	if err != nil {
+		return nil, err
+	}
+
+	return rerank(ctx, reranker, project, request.Query, results, topK), nil
+}
+
+// rerank runs the second stage. Rerankers are often a model behind another
+// service, when one fails the first-stage order is still a good answer, so
+// search falls back to it instead of failing.
+func rerank(ctx context.Context, reranker Reranker, project settings.Project, query string, results []Result, topK int) []Result {
+	reranked, err := reranker.Rerank(ctx, project, query, results, topK)
+	if err != nil {
+		log.Warn().Err(err).Str("reranker", project.Retrieval.Reranker).Msg("Reranking failed, keeping first-stage order")
+		return results[:min(topK, len(results))]
+	}
+	return reranked
+}
+
+// search is the first stage, request.TopK can be more than MaxTopK
+func (r *Retriever) search(ctx context.Context, project settings.Project, request Request) ([]Result, error) {
+	mode := request.Mode
+	if mode == "" {
+		mode = project.Retrieval.Mode
+	}
+
+	switch mode {
+	case ModeVector:
+		return r.vectorSearch(ctx, project, request, request.TopK)
+	case ModeKeyword:
+		return r.keywordSearch(ctx, project, request, request.TopK)
+	}
+
+	// Fuse deeper lists than we return, a chunk ranked low in both lists can
+	// end up on top
+	candidates := request.TopK * hybridCandidates
+
+	vectorResults, err := r.vectorSearch(ctx, project, request, candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	keywordResults, err := r.keywordSearch(ctx, project, request, candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	return Fuse(request.TopK, []Ranking{
+		{Results: vectorResults, Weight: weight(request.VectorWeight)},
+		{Results: keywordResults, Weight: weight(request.KeywordWeight)},
+	}), nil
+}
+
+func weight(w *float64) float64 {
+	if w == nil {
+		return 1
+	}
+	return *w
+}
+
+// vectorSearch embeds the query with the project's current embedder and
+// searches vectors of the same model
+func (r *Retriever) vectorSearch(ctx context.Context, project settings.Project, request Request, limit int) ([]Result, error) {
+	embedder, err := r.embedders.Resolve(project.Embedding.Model, project.ModelType)
+	if err != nil {
+		return nil, err
+	}
+
+	vectors, err := embedder.Embed(ctx, []string{request.Query})
+	if err != nil {
+		return nil, err
+	}
+
+	filter := request.Filters.filter()
+	filter.Must = append(filter.Must, vectorstore.Condition{
+		Key: vectorstore.KeyEmbeddingModel,
+		Any: []string{embedder.Model()},
+	})
+
+	matches, err := r.vectors.Search(ctx, vectorstore.ProjectCollection(uuid.UUID(project.ID.Bytes).String()), vectorstore.SearchRequest{
+		Vector:         vectors[0],
+		Limit:          limit,
+		ScoreThreshold: request.ScoreThreshold,
+		Filter:         filter,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return r.results(ctx, project.ID, matches)
+}
+
+func (f Filters) filter() vectorstore.Filter {
+	var filter vectorstore.Filter
+
+	if len(f.FileNames) > 0 {
+		filter.Must = append(filter.Must, vectorstore.Condition{Key: vectorstore.KeyFileName, Any: f.FileNames})
+	}
+	if len(f.Tags) > 0 {
+		filter.Must = append(filter.Must, vectorstore.Condition{Key: vectorstore.KeyTags, Any: f.Tags})
+	}
+
+	if f.CreatedAfter != nil || f.CreatedBefore != nil {
+		createdAt := &vectorstore.Range{}
+		if f.CreatedAfter != nil {
+			createdAt.Gte = vectorstore.Float(float64(f.CreatedAfter.Unix()))
+		}
+		if f.CreatedBefore != nil {
+			createdAt.Lte = vectorstore.Float(float64(f.CreatedBefore.Unix()))
+		}
+		filter.Must = append(filter.Must, vectorstore.Condition{Key: vectorstore.KeyCreatedAt, Range: createdAt})
+	}
+
+	return filter
+}
+
+// results loads the matched chunks from Postgres, keeping the order of
+// matches. Vectors whose chunk is gone (the file was deleted or processed
+// again in the meantime) are skipped.
+func (r *Retriever) results(ctx context.Context, projectId pgtype.UUID, matches []vectorstore.Match) ([]Result, error) {
+	ids := make([]pgtype.UUID, 0, len(matches))
+	for _, match := range matches {
+		id, err := uuid.Parse(match.ID)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, pgtype.UUID{Bytes: id, Valid: true})
+	}
+
+	chunks, err := r.queries.GetChunksByIDs(ctx, gen.GetChunksByIDsParams{
+		ProjectID: projectId,
+		Ids:       ids,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	byId := make(map[string]gen.GetChunksByIDsRow, len(chunks))
+	for _, chunk := range chunks {
+		byId[uuid.UUID(chunk.ID.Bytes).String()] = chunk
+	}
+
+	results := make([]Result, 0, len(matches))
+	for _, match := range matches {
+		chunk, ok := byId[match.ID]
+		if !ok {
+			continue
+		}
+
+		result := Result{
+			ChunkID:     match.ID,
+			FileName:    chunk.FileName,
+			ChunkIndex:  chunk.ChunkIndex,
+			StartOffset: chunk.StartOffset,
+			EndOffset:   chunk.EndOffset,
+			Text:        chunk.Content,
+			Score:       match.Score,
+			Vector:      chunk.Embedding,
+			VectorModel: chunk.EmbeddingModel.String,
+		}
+		if chunk.Page.Valid {
+			result.Page = &chunk.Page.Int32
+		}
+		if chunk.Section.Valid {
+			result.Section = &chunk.Section.String
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
@@ -0,0 +1,53 @@
+package retrieval
+
+import (
+	"context"
+	"errors"
+	"intualai/settings"
+	"testing"
+)
+
+// reversing returns results in reverse order, or err
+type reversing struct {
+	err error
+}
+
+func (r reversing) Rerank(ctx context.Context, project settings.Project, query string, results []Result, topK int) ([]Result, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	reranked := make([]Result, 0, topK)
+	for i := len(results) - 1; i >= 0 && len(reranked) < topK; i-- {
+		reranked = append(reranked, results[i])
+	}
+	return reranked, nil
+}
+
+func TestRerankFallback(t *testing.T) {
+	results := ranking(1, "a", "b", "c").Results
+
+	tests := []struct {
+		name     string
+		reranker Reranker
+		topK     int
+		want     string
+	}{
+		{name: "reranked", reranker: reversing{}, topK: 2, want: "cb"},
+		// A failing reranker keeps the first-stage order
+		{name: "failed", reranker: reversing{err: errors.New("rerank service unavailable")}, topK: 2, want: "ab"},
+		{name: "failed with fewer results", reranker: reversing{err: errors.New("timeout")}, topK: 5, want: "abc"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got string
+			for _, result := range rerank(context.Background(), test.reranker, settings.Project{}, "query", results, test.topK) {
+				got += result.ChunkID
+			}
+			if got != test.want {
+				t.Errorf("order = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package roles
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// Role is a member's role in a project, stored in project_users.permission.
+// Lower values are more privileged. The JSON API always uses role names.
+type Role int32
+
+const (
+	Owner  Role = 0
+	Editor Role = 1
+	Viewer Role = 2
+)
+
+var names = map[Role]string{
+	Owner:  "owner",
+	Editor: "editor",
+	Viewer: "viewer",
+}
+
+// Parse converts a role name ("owner", "editor" or "viewer") into a Role
+func Parse(name string) (Role, error) {
+	for role, roleName := range names {
+		if roleName == name {
+			return role, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid role %q, must be one of owner, editor or viewer", name)
+}
+
+func (r Role) Valid() bool {
+	_, ok := names[r]
+	return ok
+}
+
+func (r Role) String() string {
+	if name, ok := names[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("Role(%d)", int32(r))
+}
+
+// CanView is true for every valid role
+func (r Role) CanView() bool {
+	return r.Valid()
+}
+
+// CanEdit covers changing project details, files and API keys
+func (r Role) CanEdit() bool {
+	return r == Owner || r == Editor
+}
+
+func (r Role) CanInvite() bool {
+	return r == Owner || r == Editor
+}
+
+func (r Role) CanDelete() bool {
+	return r == Owner
+}
+
+func (r Role) CanRemoveMembers() bool {
+	return r == Owner
+}
+
+// CanManageMember reports whether r can change the role of a member who
+// currently has the target role. Owners can manage anyone, editors can only
+// manage viewers.
+func (r Role) CanManageMember(target Role) bool {
+	switch r {
+	case Owner:
+		return target.Valid()
+	case Editor:
+		return target == Viewer
+	default:
+		return false
+	}
+}
+
+// CanAssign reports whether r can give someone the target role, either through
+// an invite or a role change. Only owners can create other owners.
+func (r Role) CanAssign(target Role) bool {
+	switch r {
+	case Owner:
+		return target.Valid()
+	case Editor:
+		return target == Editor || target == Viewer
+	default:
+		return false
+	}
+}
+
+func (r Role) MarshalJSON() ([]byte, error) {
+	if !r.Valid() {
+		return nil, fmt.Errorf("cannot marshal invalid role %d", int32(r))
+	}
+	return json.Marshal(r.String())
+}
+
+func (r *Role) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return fmt.Errorf("role must be a string: %w", err)
+	}
+
+	role, err := Parse(name)
+	if err != nil {
+		return err
+	}
+
+	*r = role
+	return nil
+}
+
+// Scan implements sql.Scanner so sqlc generated code can read roles directly
+func (r *Role) Scan(src any) error {
+	var value int64
+	switch v := src.(type) {
+	case int64:
+		value = v
+	case int32:
+		value = int64(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Role", src)
+	}
+
+	role := Role(value)
+	if !role.Valid() {
+		return fmt.Errorf("invalid role %d in database", value)
+	}
+
+	*r = role
+	return nil
+}
+
+// Value implements driver.Valuer
+func (r Role) Value() (driver.Value, error) {
+	if !r.Valid() {
+		return nil, fmt.Errorf("invalid role %d", int32(r))
+	}
+	return int64(r), nil
+}
@@ -0,0 +1,168 @@
+package roles
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+var all = []Role{Owner, Editor, Viewer}
+
+func TestPermissions(t *testing.T) {
+	tests := []struct {
+		role          Role
+		view          bool
+		edit          bool
+		invite        bool
+		delete        bool
+		removeMembers bool
+	}{
+		{role: Owner, view: true, edit: true, invite: true, delete: true, removeMembers: true},
+		{role: Editor, view: true, edit: true, invite: true},
+		{role: Viewer, view: true},
+		{role: Role(3)},
+		{role: Role(-1)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.role.String(), func(t *testing.T) {
+			if got := test.role.CanView(); got != test.view {
+				t.Errorf("CanView() = %v, want %v", got, test.view)
+			}
+			if got := test.role.CanEdit(); got != test.edit {
+				t.Errorf("CanEdit() = %v, want %v", got, test.edit)
+			}
+			if got := test.role.CanInvite(); got != test.invite {
+				t.Errorf("CanInvite() = %v, want %v", got, test.invite)
+			}
+			if got := test.role.CanDelete(); got != test.delete {
+				t.Errorf("CanDelete() = %v, want %v", got, test.delete)
+			}
+			if got := test.role.CanRemoveMembers(); got != test.removeMembers {
+				t.Errorf("CanRemoveMembers() = %v, want %v", got, test.removeMembers)
+			}
+		})
+	}
+}
+
+func TestCanManageMember(t *testing.T) {
+	allowed := map[[2]Role]bool{
+		{Owner, Owner}:   true,
+		{Owner, Editor}:  true,
+		{Owner, Viewer}:  true,
+		{Editor, Viewer}: true,
+	}
+
+	// Every pair, unknown roles included, so a new rule can't slip in unnoticed
+	roles := append(all, Role(3))
+	for _, role := range roles {
+		for _, target := range roles {
+			want := allowed[[2]Role{role, target}]
+			if got := role.CanManageMember(target); got != want {
+				t.Errorf("%s managing %s = %v, want %v", role, target, got, want)
+			}
+		}
+	}
+}
+
+func TestCanAssign(t *testing.T) {
+	allowed := map[[2]Role]bool{
+		{Owner, Owner}:   true,
+		{Owner, Editor}:  true,
+		{Owner, Viewer}:  true,
+		{Editor, Editor}: true,
+		{Editor, Viewer}: true,
+	}
+
+	roles := append(all, Role(3))
+	for _, role := range roles {
+		for _, target := range roles {
+			want := allowed[[2]Role{role, target}]
+			if got := role.CanAssign(target); got != want {
+				t.Errorf("%s assigning %s = %v, want %v", role, target, got, want)
+			}
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, role := range all {
+		got, err := Parse(role.String())
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", role.String(), err)
+		}
+		if got != role {
+			t.Errorf("Parse(%q) = %s, want %s", role.String(), got, role)
+		}
+	}
+
+	for _, name := range []string{"", "admin", "Owner", " owner", "0", "Role(3)"} {
+		if role, err := Parse(name); err == nil {
+			t.Errorf("Parse(%q) = %s, want an error", name, role)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	for _, role := range all {
+		data, err := json.Marshal(role)
+		if err != nil {
+			t.Fatalf("Marshal(%s): %v", role, err)
+		}
+		if want := `"` + role.String() + `"`; string(data) != want {
+			t.Errorf("Marshal(%s) = %s, want %s", role, data, want)
+		}
+
+		var got Role
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("Unmarshal(%s): %v", data, err)
+		}
+		if got != role {
+			t.Errorf("Unmarshal(%s) = %s, want %s", data, got, role)
+		}
+	}
+
+	if _, err := json.Marshal(Role(3)); err == nil {
+		t.Error("marshalled Role(3)")
+	}
+
+	// Numbers are what the API used to take, they aren't accepted anymore
+	for _, data := range []string{`"admin"`, `""`, `0`, `2`, `null`} {
+		role := Viewer
+		if err := json.Unmarshal([]byte(data), &role); err == nil {
+			t.Errorf("Unmarshal(%s) = %s, want an error", data, role)
+		}
+	}
+}
+
+func TestDatabase(t *testing.T) {
+	for _, role := range all {
+		value, err := role.Value()
+		if err != nil {
+			t.Fatalf("%s.Value(): %v", role, err)
+		}
+
+		var got Role
+		if err := got.Scan(value); err != nil {
+			t.Fatalf("Scan(%v): %v", value, err)
+		}
+		if got != role {
+			t.Errorf("Scan(%v) = %s, want %s", value, got, role)
+		}
+
+		// pgx hands int4 columns over as int32
+		if err := got.Scan(int32(role)); err != nil || got != role {
+			t.Errorf("Scan(int32(%d)) = %s, %v", int32(role), got, err)
+		}
+	}
+
+	if _, err := Role(3).Value(); err == nil {
+		t.Error("Role(3).Value() succeeded")
+	}
+
+	for _, src := range []any{int64(3), int64(-1), int32(7), "owner", nil, 1.0} {
+		role := Viewer
+		if err := role.Scan(src); err == nil {
+			t.Errorf("Scan(%#v) = %s, want an error", src, role)
+		}
+	}
+}
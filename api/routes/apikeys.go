@@ -0,0 +1,187 @@
+package routes
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"intualai/conn"
+	"intualai/gen"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// Every project API key starts with this, so the auth middleware can tell
+// them apart from Clerk session tokens
+const ApiKeyPrefix = "intual_"
+
+// Number of characters (including ApiKeyPrefix) stored in plaintext to help
+// users identify a key after creation
+const apiKeyDisplayLength = 12
+
+// generateApiKey returns a new random key and the hash that gets stored
+func generateApiKey() (string, string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+
+	key := ApiKeyPrefix + hex.EncodeToString(secret)
+	return key, hashApiKey(key), nil
+}
+
+func hashApiKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// ValidateApiKey authenticates a request made with a project API key. Keys are
+// only valid on routes belonging to their own project.
+func ValidateApiKey(key string, c echo.Context) (bool, error) {
+	// expires_at is stored in UTC
+	now := pgtype.Timestamp{Time: time.Now().UTC(), Valid: true}
+
+	apiKey, err := conn.Queries.GetApiKeyByHash(context.Background(), gen.GetApiKeyByHashParams{
+		Key: hashApiKey(key),
+		Now: now,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		log.Info().Msg("Unknown or expired API key")
+		return false, nil
+	}
+	if err != nil {
+		log.Err(err).Msg("Failed to look up API key")
+		return false, err
+	}
+
+	projectUUID, err := uuid.Parse(c.Param("project_id"))
+	if err != nil || projectUUID != uuid.UUID(apiKey.ProjectID.Bytes) {
+		log.Info().Msg("API key used outside of its project")
+		return false, nil
+	}
+
+	err = conn.Queries.TouchApiKey(context.Background(), gen.TouchApiKeyParams{
+		Now: now,
+		ID:  apiKey.ID,
+	})
+	if err != nil {
+		// Not worth failing the request over
+		log.Err(err).Msg("Failed to update API key last_used_at")
+	}
+
+	c.Set("apiKeyId", apiKey.ID)
+
+	return true, nil
+}
+
+// RequireUser rejects requests authenticated with an API key. Used on routes
+// that only make sense for a person (membership, managing keys, etc.)
+func RequireUser(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if _, ok := c.Get("userId").(string); !ok {
+			return echo.NewHTTPError(http.StatusForbidden, "This route cannot be used with an API key")
+		}
+		return next(c)
+	}
+}
+
+func GetAllApiKeys(c echo.Context) error {
+	apiKeys, err := conn.Queries.GetAllApiKeys(context.Background(), projectID(c))
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to retrieve API keys")
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve API keys")
+	}
+
+	return c.JSON(http.StatusOK, apiKeys)
+}
+
+type CreateApiKeyRequestBody struct {
+	Name      string     `json:"name"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type CreateApiKeyResponse struct {
+	gen.CreateApiKeyRow
+	// Only ever returned here, we can't recover it from the hash later
+	Key string `json:"key"`
+}
+
+func CreateApiKey(c echo.Context) error {
+	userId := c.Get("userId").(string)
+
+	var body CreateApiKeyRequestBody
+	if err := c.Bind(&body); err != nil {
+		log.Error().Err(err).Msg("Invalid request body")
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if body.Name == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "API keys must have a name")
+	}
+
+	if body.ExpiresAt != nil && !body.ExpiresAt.After(time.Now()) {
+		return echo.NewHTTPError(http.StatusBadRequest, "expires_at must be in the future")
+	}
+
+	key, hash, err := generateApiKey()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to generate API key")
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create API key")
+	}
+
+	expiresAt := pgtype.Timestamp{}
+	if body.ExpiresAt != nil {
+		expiresAt = pgtype.Timestamp{Time: body.ExpiresAt.UTC(), Valid: true}
+	}
+
+	apiKey, err := conn.Queries.CreateApiKey(context.Background(), gen.CreateApiKeyParams{
+		ProjectID: projectID(c),
+		Name:      body.Name,
+		Prefix:    key[:apiKeyDisplayLength],
+		Key:       hash,
+		CreatedBy: pgtype.Text{String: userId, Valid: true},
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to create API key")
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create API key")
+	}
+
+	return c.JSON(http.StatusOK, CreateApiKeyResponse{
+		CreateApiKeyRow: apiKey,
+		Key:             key,
+	})
+}
+
+// DeleteApiKey revokes an API key. Requests using it fail immediately.
+func DeleteApiKey(c echo.Context) error {
+	keyUUID, err := uuid.Parse(c.Param("key_id"))
+	if err != nil {
+		log.Err(err).Msg("Invalid API key ID")
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid API key ID")
+	}
+
+	deleted, err := conn.Queries.DeleteApiKey(context.Background(), gen.DeleteApiKeyParams{
+		ID:        pgtype.UUID{Bytes: keyUUID, Valid: true},
+		ProjectID: projectID(c),
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to revoke API key")
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to revoke API key")
+	}
+
+	if deleted == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "API key not found")
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "API key revoked successfully",
+	})
+}
@@ -0,0 +1,324 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"intualai/conn"
+	"intualai/gen"
+	"intualai/llm"
+	"intualai/rag"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// Sessions without a title are named after their first question, cut to this
+// many characters
+const chatTitleLength = 80
+
+// ChatMessageResponse is a gen.ChatMessage with its JSON columns left as JSON
+type ChatMessageResponse struct {
+	ID              int64            `json:"id"`
+	Role            string           `json:"role"`
+	Content         string           `json:"content"`
+	StandaloneQuery *string          `json:"standalone_query"`
+	ChunkIDs        []string         `json:"chunk_ids"`
+	Citations       json.RawMessage  `json:"citations"`
+	Model           *string          `json:"model"`
+	Usage           json.RawMessage  `json:"usage"`
+	CreatedAt       pgtype.Timestamp `json:"created_at"`
+}
+
+func chatMessageResponse(message gen.ChatMessage) ChatMessageResponse {
+	response := ChatMessageResponse{
+		ID:        message.ID,
+		Role:      message.Role,
+		Content:   message.Content,
+		ChunkIDs:  make([]string, 0, len(message.ChunkIds)),
+		Citations: json.RawMessage("null"),
+		Usage:     json.RawMessage("null"),
+		CreatedAt: message.CreatedAt,
+	}
+	if message.StandaloneQuery.Valid {
+		response.StandaloneQuery = &message.StandaloneQuery.String
+	}
+	if message.Model.Valid {
+		response.Model = &message.Model.String
+	}
+	if message.Citations != nil {
+		response.Citations = message.Citations
+	}
+	if message.Usage != nil {
+		response.Usage = message.Usage
+	}
+	for _, id := range message.ChunkIds {
+		response.ChunkIDs = append(response.ChunkIDs, uuid.UUID(id.Bytes).String())
+	}
+	return response
+}
+
+// chatSession loads :session_id, which has to belong to the caller
+func chatSession(c echo.Context) (gen.ChatSession, error) {
+	sessionUUID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		return gen.ChatSession{}, echo.NewHTTPError(http.StatusBadRequest, "Invalid session ID")
+	}
+
+	session, err := conn.Queries.GetChatSession(context.Background(), gen.GetChatSessionParams{
+		ID:        pgtype.UUID{Bytes: sessionUUID, Valid: true},
+		ProjectID: projectID(c),
+		Owner:     actor(c),
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return gen.ChatSession{}, echo.NewHTTPError(http.StatusNotFound, "Session not found")
+	}
+	if err != nil {
+		log.Err(err).Msg("Failed to retrieve chat session")
+		return gen.ChatSession{}, echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve chat session")
+	}
+
+	return session, nil
+}
+
+// GetChatSessions lists the caller's sessions in the project, most recently
+// used first
+func GetChatSessions(c echo.Context) error {
+	sessions, err := conn.Queries.GetChatSessions(context.Background(), gen.GetChatSessionsParams{
+		ProjectID: projectID(c),
+		Owner:     actor(c),
+	})
+	if err != nil {
+		log.Err(err).Msg("Failed to retrieve chat sessions")
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve chat sessions")
+	}
+
+	return c.JSON(http.StatusOK, sessions)
+}
+
+type ChatSessionRequestBody struct {
+	Title string `json:"title"`
+}
+
+func CreateChatSession(c echo.Context) error {
+	var body ChatSessionRequestBody
+	if err := c.Bind(&body); err != nil {
+		log.Error().Err(err).Msg("Invalid request body")
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	session, err := conn.Queries.CreateChatSession(context.Background(), gen.CreateChatSessionParams{
+		ProjectID: projectID(c),
+		Owner:     actor(c),
+		Title:     body.Title,
+	})
+	if err != nil {
+		log.Err(err).Msg("Failed to create chat session")
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create chat session")
+	}
+
+	return c.JSON(http.StatusOK, session)
+}
+
+type ChatSessionResponse struct {
+	gen.ChatSession
+	Messages []ChatMessageResponse `json:"messages"`
+}
+
+// GetChatSession returns a session with all of its messages, oldest first
+func GetChatSession(c echo.Context) error {
+	session, err := chatSession(c)
+	if err != nil {
+		return err
+	}
+
+	messages, err := conn.Queries.GetChatMessages(context.Background(), session.ID)
+	if err != nil {
+		log.Err(err).Msg("Failed to retrieve chat messages")
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve chat session")
+	}
+
+	response := ChatSessionResponse{ChatSession: session, Messages: make([]ChatMessageResponse, 0, len(messages))}
+	for _, message := range messages {
+		response.Messages = append(response.Messages, chatMessageResponse(message))
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+func RenameChatSession(c echo.Context) error {
+	session, err := chatSession(c)
+	if err != nil {
+		return err
+	}
+
+	var body ChatSessionRequestBody
+	if err := c.Bind(&body); err != nil {
+		log.Error().Err(err).Msg("Invalid request body")
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if body.Title == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "title must not be empty")
+	}
+
+	session, err = conn.Queries.RenameChatSession(context.Background(), gen.RenameChatSessionParams{
+		Title:     body.Title,
+		ID:        session.ID,
+		ProjectID: session.ProjectID,
+		Owner:     session.Owner,
+	})
+	if err != nil {
+		log.Err(err).Msg("Failed to rename chat session")
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to rename chat session")
+	}
+
+	return c.JSON(http.StatusOK, session)
+}
+
+func DeleteChatSession(c echo.Context) error {
+	session, err := chatSession(c)
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.Queries.DeleteChatSession(context.Background(), gen.DeleteChatSessionParams{
+		ID:        session.ID,
+		ProjectID: session.ProjectID,
+		Owner:     session.Owner,
+	})
+	if err != nil {
+		log.Err(err).Msg("Failed to delete chat session")
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete chat session")
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "Session deleted successfully",
+	})
+}
+
+type ChatReply struct {
+	// What was searched, query rewritten to make sense without the history
+	StandaloneQuery string `json:"standalone_query"`
+	rag.Answer
+}
+
+// SendChatMessage answers the next question of a session. Takes the same body
+// as Query, follow-up questions are rewritten into standalone ones with the
+// session's history before searching.
+func SendChatMessage(c echo.Context) error {
+	body, project, err := bindRetrievalRequest(c)
+	if err != nil {
+		return err
+	}
+
+	session, err := chatSession(c)
+	if err != nil {
+		return err
+	}
+
+	messages, err := conn.Queries.GetChatMessages(context.Background(), session.ID)
+	if err != nil {
+		log.Err(err).Msg("Failed to retrieve chat messages")
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to answer message")
+	}
+
+	history := make([]llm.Message, 0, len(messages))
+	for _, message := range messages {
+		history = append(history, llm.Message{Role: message.Role, Content: message.Content})
+	}
+
+	provider, err := conn.LLMs.Resolve(project.Generation.Model, project.ModelType)
+	if err != nil {
+		log.Err(err).Msg("Failed to pick LLM provider")
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to answer message")
+	}
+
+	ctx := c.Request().Context()
+	question := body.Query
+
+	body.Query, err = rag.Rewrite(ctx, provider, history, question)
+	if err != nil {
+		log.Err(err).Msg("Failed to rewrite follow-up question")
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to answer message")
+	}
+
+	answer, err := answerer().Answer(ctx, project, body, history)
+	if err != nil {
+		log.Err(err).Msg("Failed to answer message")
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to answer message")
+	}
+
+	// The answer was paid for, keep it even if the client went away
+	err = saveChatTurn(context.Background(), session, question, body.Query, answer)
+	if err != nil {
+		log.Err(err).Msg("Failed to save chat messages")
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to answer message")
+	}
+
+	return c.JSON(http.StatusOK, ChatReply{StandaloneQuery: body.Query, Answer: answer})
+}
+
+// saveChatTurn stores a question and its answer together
+func saveChatTurn(ctx context.Context, session gen.ChatSession, question string, standaloneQuery string, answer rag.Answer) error {
+	citations, err := json.Marshal(answer.Citations)
+	if err != nil {
+		return err
+	}
+	usage, err := json.Marshal(answer.Usage)
+	if err != nil {
+		return err
+	}
+
+	chunkIds := make([]pgtype.UUID, 0, len(answer.Sources))
+	for _, source := range answer.Sources {
+		chunkIds = append(chunkIds, pgtype.UUID{Bytes: uuid.MustParse(source.ChunkID), Valid: true})
+	}
+
+	tx, err := conn.DBPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := conn.Queries.WithTx(tx)
+
+	_, err = qtx.CreateChatMessage(ctx, gen.CreateChatMessageParams{
+		SessionID:       session.ID,
+		Role:            llm.RoleUser,
+		Content:         question,
+		StandaloneQuery: pgtype.Text{String: standaloneQuery, Valid: true},
+		ChunkIds:        []pgtype.UUID{},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = qtx.CreateChatMessage(ctx, gen.CreateChatMessageParams{
+		SessionID: session.ID,
+		Role:      llm.RoleAssistant,
+		Content:   answer.Answer,
+		ChunkIds:  chunkIds,
+		Citations: citations,
+		Model:     pgtype.Text{String: answer.Model, Valid: true},
+		Usage:     usage,
+	})
+	if err != nil {
+		return err
+	}
+
+	title := []rune(question)
+	_, err = qtx.TouchChatSession(ctx, gen.TouchChatSessionParams{
+		Title: string(title[:min(len(title), chatTitleLength)]),
+		ID:    session.ID,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
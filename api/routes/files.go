@@ -2,52 +2,339 @@ package routes
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"intualai/conn"
+	"intualai/filestate"
 	"intualai/gen"
+	"intualai/outbox"
+	"intualai/queue"
+	"intualai/storage"
+	"intualai/uploads"
+	"intualai/vectorstore"
+	"io"
+	"mime"
 	"net/http"
-	"os"
-
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/aws/aws-sdk-go-v2/service/sqs"
-	"github.com/emicklei/pgtalk/convert"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/labstack/echo/v4"
 	"github.com/rs/zerolog/log"
 )
 
+// Page sizes of GetAllFiles
+const (
+	defaultFilePageSize = 50
+	maxFilePageSize     = 200
+)
+
+// fileCursor is the position after the last file of a page. Clients get it
+// base64 encoded and pass it back as is.
+type fileCursor struct {
+	Sort       string    `json:"s"`
+	Descending bool      `json:"d"`
+	Name       string    `json:"n"`
+	CreatedAt  time.Time `json:"c"`
+	Size       int64     `json:"z"`
+}
+
+func (f fileCursor) encode() string {
+	data, _ := json.Marshal(f)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeFileCursor(cursor string) (fileCursor, error) {
+	var f fileCursor
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return f, err
+	}
+	return f, json.Unmarshal(data, &f)
+}
+
+type GetAllFilesResponse struct {
+	Files []gen.File `json:"files"`
+	// Pass as ?cursor= for the next page, empty on the last one
+	NextCursor string `json:"next_cursor,omitempty"`
+	// Files matching the filters across all pages
+	Total int64 `json:"total"`
+}
+
+// GetAllFiles lists a project's files a page at a time. Query parameters:
+//
+//   - limit: page size, defaults to 50, at most 200
+//   - cursor: next_cursor of the previous page
+//   - sort: name, created_at (default) or size
+//   - order: asc or desc (default)
+//   - process_state, name_prefix: filters
+//
+// The cursor only works with the sort and order it was made with.
 func GetAllFiles(c echo.Context) error {
-	projectId := c.Param("project_id")
+	params := gen.GetAllFilesParams{
+		ProjectID:  projectID(c),
+		SortBy:     "created_at",
+		Descending: true,
+		PageSize:   defaultFilePageSize,
+	}
+
+	if v := c.QueryParam("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxFilePageSize {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxFilePageSize))
+		}
+		params.PageSize = int32(limit)
+	}
+
+	switch sort := c.QueryParam("sort"); sort {
+	case "":
+	case "name", "created_at", "size":
+		params.SortBy = sort
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "sort must be name, created_at or size")
+	}
+
+	switch c.QueryParam("order") {
+	case "":
+	case "asc":
+		params.Descending = false
+	case "desc":
+		params.Descending = true
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "order must be asc or desc")
+	}
+
+	if v := c.QueryParam("process_state"); v != "" {
+		if !filestate.State(v).Valid() {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid process_state")
+		}
+		params.ProcessState = pgtype.Text{String: v, Valid: true}
+	}
+	if v := c.QueryParam("name_prefix"); v != "" {
+		params.NamePrefix = pgtype.Text{String: v, Valid: true}
+	}
 
-	results, err := conn.Queries.GetAllFiles(context.Background(), convert.StringToUUID(projectId))
+	if v := c.QueryParam("cursor"); v != "" {
+		cursor, err := decodeFileCursor(v)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid cursor")
+		}
+		if cursor.Sort != params.SortBy || cursor.Descending != params.Descending {
+			return echo.NewHTTPError(http.StatusBadRequest, "cursor was made for another sort or order")
+		}
+		params.AfterName = pgtype.Text{String: cursor.Name, Valid: true}
+		params.AfterCreatedAt = pgtype.Timestamp{Time: cursor.CreatedAt, Valid: true}
+		params.AfterSize = pgtype.Int8{Int64: cursor.Size, Valid: true}
+	}
+
+	ctx := context.Background()
+
+	// One more than asked for tells whether there's another page
+	pageSize := params.PageSize
+	params.PageSize++
+
+	files, err := conn.Queries.GetAllFiles(ctx, params)
 	if err != nil {
-		log.Err(err).Send()
-		return echo.NewHTTPError(http.StatusInternalServerError, map[string]string{
-			"error": "Internal server error, check logs",
-		})
+		log.Err(err).Msg("Failed to retrieve files")
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve files")
 	}
 
-	return c.JSON(http.StatusOK, results)
+	total, err := conn.Queries.CountFiles(ctx, gen.CountFilesParams{
+		ProjectID:    params.ProjectID,
+		ProcessState: params.ProcessState,
+		NamePrefix:   params.NamePrefix,
+	})
+	if err != nil {
+		log.Err(err).Msg("Failed to count files")
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve files")
+	}
+
+	response := GetAllFilesResponse{Files: files, Total: total}
+	if response.Files == nil {
+		response.Files = []gen.File{}
+	}
+
+	if len(files) > int(pageSize) {
+		response.Files = files[:pageSize]
+		last := response.Files[pageSize-1]
+		response.NextCursor = fileCursor{
+			Sort:       params.SortBy,
+			Descending: params.Descending,
+			Name:       last.FileName,
+			CreatedAt:  last.CreatedAt.Time,
+			// NULL sizes sort as 0
+			Size: last.Size.Int64,
+		}.encode()
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// limitedReader fails once more than limit bytes were read from it. Unlike
+// io.LimitReader it doesn't look like a normal EOF, so a file that's too big
+// never gets stored cut short.
+type limitedReader struct {
+	r        io.Reader
+	limit    int64
+	read     int64
+	exceeded bool
+}
+
+var errTooLarge = errors.New("upload too large")
+
+const maxTagLength = 256
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.read > l.limit {
+		l.exceeded = true
+		return n, errTooLarge
+	}
+	return n, err
 }
 
-// Handles multiple files w/ filenames through formdata
+// uploadedContent is what UploadFile records about a file it stored
+type uploadedContent struct {
+	// Staging object (storage.UploadKey)
+	key  string
+	size int64
+	// Hex SHA-256
+	checksum string
+}
+
+func tooLarge(what string, limit int64) error {
+	return echo.NewHTTPError(http.StatusRequestEntityTooLarge, map[string]string{
+		"error": fmt.Sprintf("%s is larger than the %d byte limit", what, limit),
+	})
+}
+
+// Handles multiple files w/ filenames through formdata. Each file is streamed
+// into the blob store as it's read from the request, nothing is buffered
+// in memory or on disk. Files over conn.MaxUploadFileSize or requests over
+// conn.MaxUploadRequestSize are rejected with a 413.
+//
+// Files are deduplicated by their SHA-256. A new name whose content another
+// file already has isn't stored again, an existing name with new content
+// becomes that file's next version (see newVersion).
 func UploadFile(c echo.Context) error {
-	projectId := c.Param("project_id")
+	projectId := uuid.UUID(projectID(c).Bytes).String()
+	request := c.Request()
+
+	if request.ContentLength > conn.MaxUploadRequestSize {
+		return tooLarge("Request", conn.MaxUploadRequestSize)
+	}
 
-	uploadsBucketName := os.Getenv("UPLOADS_BUCKET_NAME")
+	body := &limitedReader{r: request.Body, limit: conn.MaxUploadRequestSize}
+	request.Body = io.NopCloser(body)
 
-	form, err := c.MultipartForm()
+	reader, err := request.MultipartReader()
 	if err != nil {
-		log.Err(err).Send()
-		return echo.NewHTTPError(http.StatusInternalServerError, map[string]string{
-			"error": "Internal server error, check logs",
+		return echo.NewHTTPError(http.StatusBadRequest, map[string]string{
+			"error": "File uploads must be multipart/form-data",
 		})
 	}
-	files := form.File["files"]
 
-	if len(files) == 0 {
+	// Every file in the request gets the same tags. Tags can come after the
+	// files, so the rows are only created once the whole form was read.
+	tags := []string{}
+	var fileNames []string
+	var contents []uploadedContent
+
+	// Files are staged until the whole form was read, whatever happens the
+	// staged objects are removed once the request is done
+	var staged []string
+	defer func() {
+		for _, key := range staged {
+			if err := conn.Blobs.Delete(context.Background(), key); err != nil {
+				log.Err(err).Str("key", key).Msg("Failed to clean up staged upload")
+			}
+		}
+	}()
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if body.exceeded {
+			return tooLarge("Request", conn.MaxUploadRequestSize)
+		}
+		if err != nil {
+			log.Err(err).Send()
+			return echo.NewHTTPError(http.StatusBadRequest, map[string]string{
+				"error": "Invalid multipart form",
+			})
+		}
+
+		switch part.FormName() {
+		case "tags":
+			tag, err := io.ReadAll(io.LimitReader(part, maxTagLength+1))
+			part.Close()
+			if body.exceeded {
+				return tooLarge("Request", conn.MaxUploadRequestSize)
+			}
+			if err != nil {
+				log.Err(err).Send()
+				return echo.NewHTTPError(http.StatusBadRequest, map[string]string{
+					"error": "Invalid multipart form",
+				})
+			}
+			if len(tag) > maxTagLength {
+				return echo.NewHTTPError(http.StatusBadRequest, map[string]string{
+					"error": fmt.Sprintf("Tags can't be longer than %d bytes", maxTagLength),
+				})
+			}
+			if len(tag) > 0 {
+				tags = append(tags, string(tag))
+			}
+
+		case "files":
+			fileName := part.FileName()
+			if fileName == "" {
+				part.Close()
+				return echo.NewHTTPError(http.StatusBadRequest, map[string]string{
+					"error": "Every file must have a filename",
+				})
+			}
+
+			key := storage.UploadKey(projectId, uuid.NewString())
+			staged = append(staged, key)
+			hash := sha256.New()
+			file := &limitedReader{r: io.TeeReader(part, hash), limit: conn.MaxUploadFileSize}
+			err := conn.Blobs.Put(context.Background(), key, file)
+			part.Close()
+			if body.exceeded {
+				return tooLarge("Request", conn.MaxUploadRequestSize)
+			}
+			if file.exceeded {
+				return tooLarge(fmt.Sprintf("File %q", fileName), conn.MaxUploadFileSize)
+			}
+			if err != nil {
+				log.Err(err).Send()
+				return echo.NewHTTPError(http.StatusInternalServerError, map[string]string{
+					"error": "Internal server error, check logs",
+				})
+			}
+
+			fileNames = append(fileNames, fileName)
+			contents = append(contents, uploadedContent{key: key, size: file.read, checksum: hex.EncodeToString(hash.Sum(nil))})
+
+		default:
+			// Unknown fields still have to be read past
+			part.Close()
+		}
+	}
+
+	if len(fileNames) == 0 {
 		return echo.NewHTTPError(http.StatusBadRequest, map[string]string{
 			"error": "File uploads must contain the `files` key",
 		})
@@ -55,70 +342,329 @@ func UploadFile(c echo.Context) error {
 
 	// Once we create each file in the database, store the results here
 	// Avoids additional queries
-	var results []gen.File
+	var results []UploadResult
 
-	// Now that we have the files, upload them to S3
-	for _, file := range files {
-		fileBody, err := file.Open()
+	for i, fileName := range fileNames {
+		result, err := storeUpload(c, fileName, contents[i], tags)
 		if err != nil {
-			log.Err(err).Send()
-			return echo.NewHTTPError(http.StatusInternalServerError, map[string]string{
-				"error": "Internal server error, check logs",
-			})
+			return err
 		}
-		defer fileBody.Close()
 
-		// Upload the file to S3
-		cfg, err := config.LoadDefaultConfig(context.TODO())
-		if err != nil {
-			log.Err(err).Send()
-			return echo.NewHTTPError(http.StatusInternalServerError, map[string]string{
-				"error": "Internal server error, check logs",
-			})
+		results = append(results, result)
+	}
+
+	return c.JSON(http.StatusOK, results)
+}
+
+// storeUpload turns a staged upload into a file, a new version of one, or
+// nothing if its content is already there
+func storeUpload(c echo.Context, fileName string, content uploadedContent, tags []string) (UploadResult, error) {
+	ctx := context.Background()
+	projectId := uuid.UUID(projectID(c).Bytes).String()
+	checksum := pgtype.Text{String: content.checksum, Valid: true}
+	size := pgtype.Int8{Int64: content.size, Valid: true}
+
+	internalError := func(err error) error {
+		log.Err(err).Str("file_name", fileName).Send()
+		return echo.NewHTTPError(http.StatusInternalServerError, map[string]string{
+			"error": "Internal server error, check logs",
+		})
+	}
+
+	file, err := conn.Queries.GetFile(ctx, gen.GetFileParams{
+		ProjectID: projectID(c),
+		FileName:  fileName,
+	})
+	if err == nil {
+		if file.Checksum == checksum {
+			return UploadResult{File: file, UploadStatus: UploadUnchanged}, nil
+		}
+		if err := versionable(file); err != nil {
+			return UploadResult{}, err
 		}
 
-		s3Client := s3.NewFromConfig(cfg)
-		uploader := manager.NewUploader(s3Client)
+		// An upload without tags keeps the file's tags
+		var versionTags []string
+		if len(tags) > 0 {
+			versionTags = tags
+		}
 
-		_, err = uploader.Upload(context.TODO(), &s3.PutObjectInput{
-			Bucket: aws.String(uploadsBucketName),
-			Key:    aws.String(fmt.Sprintf("%s/%s", projectId, file.Filename)),
-			Body:   fileBody,
+		file, err = newVersion(c, file, fileContent{
+			key:      content.key,
+			size:     size,
+			checksum: checksum,
+			tags:     versionTags,
+			reason:   fmt.Sprintf("Version %d uploaded", file.Version+1),
 		})
+		if errors.Is(err, filestate.ErrConflict) {
+			return UploadResult{}, fileStateError(err)
+		}
 		if err != nil {
-			log.Err(err).Send()
-			return echo.NewHTTPError(http.StatusInternalServerError, map[string]string{
-				"error": "Internal server error, check logs",
+			return UploadResult{}, internalError(err)
+		}
+
+		return UploadResult{File: file, UploadStatus: UploadNewVersion}, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return UploadResult{}, internalError(err)
+	}
+
+	duplicate, err := conn.Queries.GetFileByChecksum(ctx, gen.GetFileByChecksumParams{
+		ProjectID: projectID(c),
+		Checksum:  checksum,
+	})
+	if err == nil {
+		return UploadResult{File: duplicate, UploadStatus: UploadDuplicate}, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return UploadResult{}, internalError(err)
+	}
+
+	key := storage.FileKey(projectId, fileName)
+	if err := conn.Blobs.Copy(ctx, content.key, key); err != nil {
+		return UploadResult{}, internalError(err)
+	}
+
+	file, err = createFile(c, gen.CreateFileParams{
+		ProjectID: projectID(c),
+		FileName:  fileName,
+		Tags:      tags,
+		Size:      size,
+		Checksum:  checksum,
+	})
+	if err != nil {
+		if err := conn.Blobs.Delete(ctx, key); err != nil {
+			log.Err(err).Str("key", key).Msg("Failed to clean up partial upload")
+		}
+
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return UploadResult{}, echo.NewHTTPError(http.StatusConflict, map[string]string{
+				"error": fmt.Sprintf("A file named %q was created at the same time", fileName),
 			})
 		}
+		return UploadResult{}, internalError(err)
+	}
+
+	return UploadResult{File: file, UploadStatus: UploadCreated}, nil
+}
+
+// createFile creates the file row and its first file_events entry together
+func createFile(c echo.Context, params gen.CreateFileParams) (gen.File, error) {
+	tx, err := conn.DBPool.Begin(context.Background())
+	if err != nil {
+		return gen.File{}, err
+	}
+	defer tx.Rollback(context.Background())
+
+	qtx := conn.Queries.WithTx(tx)
+
+	file, err := qtx.CreateFile(context.Background(), params)
+	if err != nil {
+		return gen.File{}, err
+	}
+
+	err = filestate.Created(context.Background(), qtx, file, actor(c))
+	if err != nil {
+		return gen.File{}, err
+	}
+
+	return file, tx.Commit(context.Background())
+}
+
+// processDedupeKey is the outbox dedupe key for a file's processing job
+func processDedupeKey(projectId string, fileName string) string {
+	return "process:" + projectId + "/" + fileName
+}
 
-		// Done uploading this file to S3
+// How queueFile got asked to queue a file
+type queueKind int
 
-		// Create file in database
-		dbFile, err := conn.Queries.CreateFile(context.Background(), gen.CreateFileParams{
-			ProjectID: convert.StringToUUID(projectId),
-			FileName:  file.Filename,
+const (
+	queueProcess queueKind = iota
+	queueRetry
+	queueReprocess
+)
+
+// Queues a file for processing. The state change and the job are written in
+// the same transaction (see outbox.Relay), so a file can't end up QUEUED
+// without a job or the other way around.
+func ProcessFile(c echo.Context) error {
+	return queueFile(c, queueProcess, "Queued for processing")
+}
+
+// Re-queues a FAILED file, up to conn.MaxFileRetries times
+func RetryFile(c echo.Context) error {
+	return queueFile(c, queueRetry, "Retried")
+}
+
+// Processes a SUCCEEDED file again, replacing its chunks and vectors, e.g. to
+// pick up changed chunking or embedding settings. Attempts start over.
+func ReprocessFile(c echo.Context) error {
+	return queueFile(c, queueReprocess, "Reprocessing requested")
+}
+
+func queueFile(c echo.Context, kind queueKind, reason string) error {
+	projectId := uuid.UUID(projectID(c).Bytes).String()
+	fileName := c.Param("file_name")
+
+	jobId := uuid.NewString()
+	message, err := json.Marshal(queue.FileJob{
+		ID:        jobId,
+		ProjectID: projectId,
+		FileName:  fileName,
+	})
+	if err != nil {
+		log.Err(err).Send()
+		return echo.NewHTTPError(http.StatusInternalServerError, map[string]string{
+			"error": "Internal server error, check logs",
+		})
+	}
+
+	tx, err := conn.DBPool.Begin(context.Background())
+	if err != nil {
+		log.Err(err).Send()
+		return echo.NewHTTPError(http.StatusInternalServerError, map[string]string{
+			"error": "Internal server error, check logs",
+		})
+	}
+	defer tx.Rollback(context.Background())
+
+	qtx := conn.Queries.WithTx(tx)
+
+	file, err := qtx.GetFile(context.Background(), gen.GetFileParams{
+		ProjectID: projectID(c),
+		FileName:  fileName,
+	})
+	if err != nil {
+		return fileStateError(err)
+	}
+
+	state := filestate.State(file.ProcessState)
+
+	// Already queued (e.g. a retried request), don't queue it twice
+	if state == filestate.Queued {
+		return c.JSON(http.StatusOK, file)
+	}
+
+	switch {
+	case kind == queueRetry && state != filestate.Failed:
+		return echo.NewHTTPError(http.StatusConflict, "Only FAILED files can be retried")
+	case kind == queueReprocess && state != filestate.Succeeded:
+		return echo.NewHTTPError(http.StatusConflict, "Only SUCCEEDED files can be reprocessed")
+	case kind != queueReprocess && state == filestate.Succeeded:
+		return echo.NewHTTPError(http.StatusConflict, "File was already processed, reprocess it to process it again")
+	}
+
+	// The first attempt doesn't count as a retry
+	if state == filestate.Failed && int(file.Attempts) > conn.MaxFileRetries {
+		return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("File already failed %d times, not retrying", file.Attempts))
+	}
+
+	if kind == queueReprocess {
+		_, err = filestate.Reprocess(context.Background(), qtx, projectID(c), fileName, actor(c), reason)
+	} else {
+		_, err = filestate.Apply(context.Background(), qtx, filestate.Transition{
+			ProjectID: projectID(c),
+			FileName:  fileName,
+			From:      state,
+			To:        filestate.Queued,
+			Actor:     actor(c),
+			Reason:    reason,
+		})
+	}
+	if err != nil {
+		return fileStateError(err)
+	}
+
+	written, err := outbox.Write(context.Background(), qtx, processDedupeKey(projectId, fileName), message)
+	if err != nil {
+		log.Err(err).Send()
+		return echo.NewHTTPError(http.StatusInternalServerError, map[string]string{
+			"error": "Internal server error, check logs",
 		})
+	}
+
+	// An older job for the file is still waiting to be published (e.g. it was
+	// cancelled while the relay had it claimed). Only that one is sent, so the
+	// file takes it over instead of waiting for a job that never comes.
+	if !written {
+		jobId, err = pendingJobID(qtx, processDedupeKey(projectId, fileName))
+		if errors.Is(err, pgx.ErrNoRows) {
+			// Published since, there's room for a new job now
+			return echo.NewHTTPError(http.StatusConflict, "The file's previous job is being published, try again")
+		}
 		if err != nil {
 			log.Err(err).Send()
 			return echo.NewHTTPError(http.StatusInternalServerError, map[string]string{
 				"error": "Internal server error, check logs",
 			})
 		}
+	}
+
+	fileUpdate, err := qtx.StartFileAttempt(context.Background(), gen.StartFileAttemptParams{
+		ResetAttempts: kind == queueReprocess,
+		JobID:         pgtype.Text{String: jobId, Valid: true},
+		ProjectID:     projectID(c),
+		FileName:      fileName,
+	})
+	if err != nil {
+		log.Err(err).Send()
+		return echo.NewHTTPError(http.StatusInternalServerError, map[string]string{
+			"error": "Internal server error, check logs",
+		})
+	}
 
-		results = append(results, dbFile)
+	err = tx.Commit(context.Background())
+	if err != nil {
+		log.Err(err).Send()
+		return echo.NewHTTPError(http.StatusInternalServerError, map[string]string{
+			"error": "Internal server error, check logs",
+		})
 	}
 
-	return c.JSON(http.StatusOK, results)
+	return c.JSON(http.StatusOK, fileUpdate)
 }
 
-// Sends inputs from URL path parameters to SQS
-func ProcessFile(c echo.Context) error {
-	projectId := c.Param("project_id")
+// pendingJobID returns the ID of the job waiting in the outbox under dedupeKey
+func pendingJobID(queries *gen.Queries, dedupeKey string) (string, error) {
+	payload, err := outbox.Pending(context.Background(), queries, dedupeKey)
+	if err != nil {
+		return "", err
+	}
+
+	var job queue.FileJob
+	if err := json.Unmarshal(payload, &job); err != nil {
+		return "", err
+	}
+	return job.ID, nil
+}
+
+// Cancels a QUEUED or PROCESSING file. If its job hasn't left the outbox yet
+// it's dropped, otherwise clearing files.job_id tombstones it and the worker
+// skips it.
+func CancelFile(c echo.Context) error {
+	projectId := uuid.UUID(projectID(c).Bytes).String()
 	fileName := c.Param("file_name")
 
-	fileExists, err := conn.Queries.FileExists(context.Background(), gen.FileExistsParams{
-		ProjectID: convert.StringToUUID(projectId),
+	tx, err := conn.DBPool.Begin(context.Background())
+	if err != nil {
+		log.Err(err).Send()
+		return echo.NewHTTPError(http.StatusInternalServerError, map[string]string{
+			"error": "Internal server error, check logs",
+		})
+	}
+	defer tx.Rollback(context.Background())
+
+	qtx := conn.Queries.WithTx(tx)
+
+	_, err = filestate.Move(context.Background(), qtx, projectID(c), fileName, filestate.Cancelled, actor(c), "Cancelled")
+	if err != nil {
+		return fileStateError(err)
+	}
+
+	fileUpdate, err := qtx.ClearFileJob(context.Background(), gen.ClearFileJobParams{
+		ProjectID: projectID(c),
 		FileName:  fileName,
 	})
 	if err != nil {
@@ -128,14 +674,15 @@ func ProcessFile(c echo.Context) error {
 		})
 	}
 
-	if !fileExists {
-		return c.JSON(http.StatusNotFound, map[string]string{"error": "File not found!"})
+	_, err = outbox.Discard(context.Background(), qtx, processDedupeKey(projectId, fileName))
+	if err != nil {
+		log.Err(err).Send()
+		return echo.NewHTTPError(http.StatusInternalServerError, map[string]string{
+			"error": "Internal server error, check logs",
+		})
 	}
 
-	sqsUrl := os.Getenv("QUEUE_URL")
-
-	// Load AWS config
-	cfg, err := config.LoadDefaultConfig(context.TODO())
+	err = tx.Commit(context.Background())
 	if err != nil {
 		log.Err(err).Send()
 		return echo.NewHTTPError(http.StatusInternalServerError, map[string]string{
@@ -143,12 +690,33 @@ func ProcessFile(c echo.Context) error {
 		})
 	}
 
-	// Create SQS client
-	sqsClient := sqs.NewFromConfig(cfg)
+	return c.JSON(http.StatusOK, fileUpdate)
+}
+
+// fileStateError turns errors from filestate into HTTP errors
+func fileStateError(err error) error {
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return echo.NewHTTPError(http.StatusNotFound, "File not found")
+	case errors.Is(err, filestate.ErrIllegalTransition):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	case errors.Is(err, filestate.ErrConflict):
+		return echo.NewHTTPError(http.StatusConflict, "File was changed by another request, try again")
+	}
+
+	log.Err(err).Send()
+	return echo.NewHTTPError(http.StatusInternalServerError, map[string]string{
+		"error": "Internal server error, check logs",
+	})
+}
+
+// Returns the file's process_state history, oldest first
+func GetFileEvents(c echo.Context) error {
+	fileName := c.Param("file_name")
 
-	_, err = sqsClient.SendMessage(context.TODO(), &sqs.SendMessageInput{
-		QueueUrl:    &sqsUrl,
-		MessageBody: aws.String(fmt.Sprintf(`{"project_id": "%s", "file_name": "%s"}`, projectId, fileName)),
+	fileExists, err := conn.Queries.FileExists(context.Background(), gen.FileExistsParams{
+		ProjectID: projectID(c),
+		FileName:  fileName,
 	})
 	if err != nil {
 		log.Err(err).Send()
@@ -157,9 +725,12 @@ func ProcessFile(c echo.Context) error {
 		})
 	}
 
-	// Update file table with "QUEUED" status
-	fileUpdate, err := conn.Queries.UpdateFileQueued(context.Background(), gen.UpdateFileQueuedParams{
-		ProjectID: convert.StringToUUID(projectId),
+	if !fileExists {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "File not found!"})
+	}
+
+	events, err := conn.Queries.GetFileEvents(context.Background(), gen.GetFileEventsParams{
+		ProjectID: projectID(c),
 		FileName:  fileName,
 	})
 	if err != nil {
@@ -169,5 +740,321 @@ func ProcessFile(c echo.Context) error {
 		})
 	}
 
-	return c.JSON(http.StatusOK, fileUpdate)
+	return c.JSON(http.StatusOK, events)
+}
+
+// How long the presigned download URLs GetFile returns work
+const downloadURLExpiry = 15 * time.Minute
+
+type FileResponse struct {
+	gen.File
+	// Where the content can be downloaded, a presigned URL when the blob
+	// store supports it. Empty until the file is uploaded.
+	DownloadURL string `json:"download_url,omitempty"`
+}
+
+// GetFile returns a file's metadata and where to download it
+func GetFile(c echo.Context) error {
+	fileName := c.Param("file_name")
+
+	file, err := conn.Queries.GetFile(context.Background(), gen.GetFileParams{
+		ProjectID: projectID(c),
+		FileName:  fileName,
+	})
+	if err != nil {
+		return fileStateError(err)
+	}
+
+	response := FileResponse{File: file}
+	if filestate.State(file.ProcessState) == filestate.PendingUpload {
+		return c.JSON(http.StatusOK, response)
+	}
+
+	if presigner, ok := conn.Blobs.(storage.Presigner); ok {
+		key := storage.FileKey(uuid.UUID(file.ProjectID.Bytes).String(), fileName)
+		response.DownloadURL, err = presigner.PresignGet(context.Background(), key, fileName, downloadURLExpiry)
+		if err != nil {
+			log.Err(err).Msg("Failed to presign download")
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve file")
+		}
+	} else {
+		response.DownloadURL = c.Request().URL.Path + "/content"
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// DownloadFile streams a file's content through the API
+func DownloadFile(c echo.Context) error {
+	fileName := c.Param("file_name")
+
+	file, err := conn.Queries.GetFile(context.Background(), gen.GetFileParams{
+		ProjectID: projectID(c),
+		FileName:  fileName,
+	})
+	if err != nil {
+		return fileStateError(err)
+	}
+	if filestate.State(file.ProcessState) == filestate.PendingUpload {
+		return echo.NewHTTPError(http.StatusConflict, "File hasn't been uploaded yet")
+	}
+
+	body, err := conn.Blobs.Get(c.Request().Context(), storage.FileKey(uuid.UUID(file.ProjectID.Bytes).String(), fileName))
+	if errors.Is(err, storage.ErrNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, "File content not found")
+	}
+	if err != nil {
+		log.Err(err).Msg("Failed to open file")
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to download file")
+	}
+	defer body.Close()
+
+	contentType := mime.TypeByExtension(filepath.Ext(fileName))
+	if contentType == "" {
+		contentType = echo.MIMEOctetStream
+	}
+
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": fileName}))
+	if file.Size.Valid {
+		header.Set(echo.HeaderContentLength, strconv.FormatInt(file.Size.Int64, 10))
+	}
+
+	return c.Stream(http.StatusOK, contentType, body)
+}
+
+// DeleteFile deletes a file along with everything derived from it, including
+// its archived versions. The row goes first: a pending job for the file is
+// dropped with it, and a worker that's indexing the file right now finds it
+// gone after upserting and removes its vectors again (see Pipeline.index).
+// Vectors deleted after that can't come back.
+func DeleteFile(c echo.Context) error {
+	projectId := uuid.UUID(projectID(c).Bytes).String()
+	fileName := c.Param("file_name")
+	ctx := context.Background()
+
+	file, err := conn.Queries.GetFile(ctx, gen.GetFileParams{
+		ProjectID: projectID(c),
+		FileName:  fileName,
+	})
+	if err != nil {
+		return fileStateError(err)
+	}
+
+	key := storage.FileKey(uuid.UUID(file.ProjectID.Bytes).String(), fileName)
+
+	// The rows go with the file by cascade, their objects are removed after
+	versions, err := conn.Queries.GetFileVersions(ctx, gen.GetFileVersionsParams{
+		ProjectID: projectID(c),
+		FileName:  fileName,
+	})
+	if err != nil {
+		log.Err(err).Msg("Failed to retrieve file versions")
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete file")
+	}
+
+	tx, err := conn.DBPool.Begin(ctx)
+	if err != nil {
+		log.Err(err).Send()
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete file")
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := conn.Queries.WithTx(tx)
+
+	deleted, err := qtx.DeleteFile(ctx, gen.DeleteFileParams{
+		ProjectID: projectID(c),
+		FileName:  fileName,
+	})
+	if err != nil {
+		log.Err(err).Msg("Failed to delete file")
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete file")
+	}
+	if deleted == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "File not found")
+	}
+
+	_, err = outbox.Discard(ctx, qtx, processDedupeKey(projectId, fileName))
+	if err != nil {
+		log.Err(err).Msg("Failed to discard file job")
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete file")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Err(err).Send()
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete file")
+	}
+
+	// The file is gone as far as anyone can tell. Search skips vectors without
+	// chunks, so leftover vectors and objects are only wasted space.
+	err = conn.Vectors.DeleteFile(ctx, vectorstore.ProjectCollection(uuid.UUID(file.ProjectID.Bytes).String()), fileName)
+	if err != nil {
+		log.Err(err).Str("file_name", fileName).Msg("Failed to delete file vectors")
+	}
+	if file.UploadExpiresAt.Valid {
+		staged := uploads.StagingKey(file)
+		if presigner, ok := conn.Blobs.(storage.Presigner); ok && file.UploadID.Valid {
+			if err := presigner.AbortMultipartUpload(ctx, staged, file.UploadID.String); err != nil {
+				log.Err(err).Str("key", staged).Msg("Failed to abort multipart upload")
+			}
+		}
+		if staged != key {
+			if err := conn.Blobs.Delete(ctx, staged); err != nil {
+				log.Err(err).Str("key", staged).Msg("Failed to delete staged upload")
+			}
+		}
+	}
+	if err := conn.Blobs.Delete(ctx, key); err != nil {
+		log.Err(err).Str("key", key).Msg("Failed to delete file object")
+	}
+	for _, version := range versions {
+		if err := conn.Blobs.Delete(ctx, version.ObjectKey); err != nil {
+			log.Err(err).Str("key", version.ObjectKey).Msg("Failed to delete file version object")
+		}
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "File deleted successfully",
+	})
+}
+
+type RenameFileRequestBody struct {
+	FileName string `json:"file_name"`
+}
+
+// RenameFile renames a file, moving its object, and its chunks, events and
+// vectors along with it. Files that are queued, processing or not uploaded
+// yet can't be renamed.
+func RenameFile(c echo.Context) error {
+	fileName := c.Param("file_name")
+	ctx := context.Background()
+
+	var body RenameFileRequestBody
+	if err := c.Bind(&body); err != nil {
+		log.Error().Err(err).Msg("Invalid request body")
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if !validFileName(body.FileName) {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid file_name")
+	}
+
+	file, err := conn.Queries.GetFile(ctx, gen.GetFileParams{
+		ProjectID: projectID(c),
+		FileName:  fileName,
+	})
+	if err != nil {
+		return fileStateError(err)
+	}
+
+	if body.FileName == fileName {
+		return c.JSON(http.StatusOK, file)
+	}
+
+	switch filestate.State(file.ProcessState) {
+	case filestate.PendingUpload, filestate.Queued, filestate.Processing:
+		return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("%s files can't be renamed", file.ProcessState))
+	}
+
+	projectId := uuid.UUID(file.ProjectID.Bytes).String()
+	from := storage.FileKey(projectId, fileName)
+	to := storage.FileKey(projectId, body.FileName)
+	collection := vectorstore.ProjectCollection(projectId)
+
+	exists, err := conn.Queries.FileExists(ctx, gen.FileExistsParams{
+		FileName:  body.FileName,
+		ProjectID: projectID(c),
+	})
+	if err != nil {
+		log.Err(err).Send()
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to rename file")
+	}
+	if exists {
+		return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("A file named %q already exists", body.FileName))
+	}
+
+	// Copy first, the old object is only deleted once nothing points at it
+	err = conn.Blobs.Copy(ctx, from, to)
+	if err != nil {
+		log.Err(err).Msg("Failed to copy file object")
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to rename file")
+	}
+
+	file, err = renameFile(c, file, body.FileName, collection)
+	if err != nil {
+		if err := conn.Blobs.Delete(ctx, to); err != nil {
+			log.Err(err).Str("key", to).Msg("Failed to delete copied file object")
+		}
+
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("A file named %q already exists", body.FileName))
+		}
+		if errors.Is(err, filestate.ErrConflict) {
+			return fileStateError(err)
+		}
+		log.Err(err).Msg("Failed to rename file")
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to rename file")
+	}
+
+	if err := conn.Blobs.Delete(ctx, from); err != nil {
+		log.Err(err).Str("key", from).Msg("Failed to delete renamed file object")
+	}
+
+	return c.JSON(http.StatusOK, file)
+}
+
+// renameFile renames the row (chunks and file_events follow by cascade) and
+// the vectors' payload. The vectors are renamed before the transaction
+// commits and renamed back if the commit fails, so the two can't disagree.
+func renameFile(c echo.Context, file gen.File, newFileName string, collection string) (gen.File, error) {
+	ctx := context.Background()
+
+	tx, err := conn.DBPool.Begin(ctx)
+	if err != nil {
+		return gen.File{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := conn.Queries.WithTx(tx)
+
+	renamed, err := qtx.RenameFile(ctx, gen.RenameFileParams{
+		NewFileName: newFileName,
+		ProjectID:   file.ProjectID,
+		FileName:    file.FileName,
+	})
+	if err != nil {
+		return gen.File{}, err
+	}
+
+	// Queued in the meantime, the worker would look for the old name. Or a
+	// new version replaced the content after it was copied.
+	if renamed.ProcessState != file.ProcessState || renamed.Version != file.Version {
+		return gen.File{}, filestate.ErrConflict
+	}
+
+	err = qtx.CreateFileEvent(ctx, gen.CreateFileEventParams{
+		ProjectID: renamed.ProjectID,
+		FileName:  renamed.FileName,
+		FromState: pgtype.Text{String: renamed.ProcessState, Valid: true},
+		ToState:   renamed.ProcessState,
+		Actor:     actor(c),
+		Reason:    fmt.Sprintf("Renamed from %q", file.FileName),
+	})
+	if err != nil {
+		return gen.File{}, err
+	}
+
+	if err := conn.Vectors.RenameFile(ctx, collection, file.FileName, newFileName); err != nil {
+		return gen.File{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		if err := conn.Vectors.RenameFile(ctx, collection, newFileName, file.FileName); err != nil {
+			log.Err(err).Msg("Failed to rename file vectors back")
+		}
+		return gen.File{}, err
+	}
+
+	return renamed, nil
 }
@@ -0,0 +1,81 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/labstack/echo/v4"
+)
+
+func TestFileCursorRoundTrip(t *testing.T) {
+	tests := []fileCursor{
+		{Sort: "created_at", Descending: true, Name: "report.pdf", CreatedAt: time.Date(2024, 5, 1, 12, 30, 15, 123456000, time.UTC)},
+		{Sort: "name", Name: "notes/ä b+c?.txt"},
+		{Sort: "size", Descending: true, Name: "big.bin", Size: 1 << 40},
+		// NULL sizes sort as 0
+		{Sort: "size", Name: "pending.txt"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Sort+"/"+test.Name, func(t *testing.T) {
+			encoded := test.encode()
+			if escaped := url.QueryEscape(encoded); escaped != encoded {
+				t.Errorf("cursor %q isn't URL safe", encoded)
+			}
+
+			decoded, err := decodeFileCursor(encoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decoded.Sort != test.Sort || decoded.Descending != test.Descending || decoded.Name != test.Name ||
+				!decoded.CreatedAt.Equal(test.CreatedAt) || decoded.Size != test.Size {
+				t.Errorf("decoded %+v, want %+v", decoded, test)
+			}
+		})
+	}
+}
+
+func TestDecodeFileCursorInvalid(t *testing.T) {
+	for _, cursor := range []string{"not base64!", "bm90IGpzb24", "eyJzIjoxfQ"} {
+		if _, err := decodeFileCursor(cursor); err == nil {
+			t.Errorf("decodeFileCursor(%q) succeeded", cursor)
+		}
+	}
+}
+
+func TestGetAllFilesInvalidQuery(t *testing.T) {
+	descending := fileCursor{Sort: "created_at", Descending: true}.encode()
+
+	tests := []string{
+		"limit=0",
+		"limit=201",
+		"limit=ten",
+		"sort=type",
+		"order=up",
+		"process_state=DONE",
+		"cursor=garbage!",
+		// Made for another order or sort than asked for
+		"order=asc&cursor=" + descending,
+		"sort=name&cursor=" + descending,
+	}
+
+	for _, query := range tests {
+		t.Run(query, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/projects/p/files?"+query, nil)
+			c := echo.New().NewContext(request, httptest.NewRecorder())
+			c.Set("projectId", pgtype.UUID{Bytes: uuid.New(), Valid: true})
+
+			// Rejected before the database is queried
+			var httpErr *echo.HTTPError
+			if err := GetAllFiles(c); !errors.As(err, &httpErr) || httpErr.Code != http.StatusBadRequest {
+				t.Errorf("got %v, want a 400", err)
+			}
+		})
+	}
+}
@@ -6,6 +6,9 @@ import (
 	"fmt"
 	"intualai/conn"
 	"intualai/gen"
+	"intualai/roles"
+	"intualai/settings"
+	"intualai/vectorstore"
 	"net/http"
 	"os"
 
@@ -88,59 +91,21 @@ func CreateProject(c echo.Context) error {
 }
 
 func CheckUserPermission(c echo.Context) error {
-	userId := c.Get("userId").(string)
-	projectId := c.Param("project_id")
-
-	projectUUID, err := uuid.Parse(projectId)
-	if err != nil {
-		log.Err(err).Msg("Invalid project ID")
-		return echo.NewHTTPError(http.StatusBadRequest, "Invalid project ID")
-	}
-
-	var pgUUID pgtype.UUID
-	copy(pgUUID.Bytes[:], projectUUID[:])
-	pgUUID.Valid = true
-
-	permission, err := conn.Queries.GetProjectUserPermission(context.Background(), gen.GetProjectUserPermissionParams{
-		UserID:    userId,
-		ProjectID: pgUUID,
-	})
-	if err != nil {
-		log.Err(err).Msg("Failed to retrieve user permission")
-		return echo.NewHTTPError(http.StatusNotFound, "Project not found or no permission")
-	}
-
-	return c.JSON(http.StatusOK, map[string]int32{"permission": permission})
+	return c.JSON(http.StatusOK, map[string]roles.Role{"permission": projectRole(c)})
 }
 
+// DeleteProject deletes the project's vectors first, so a failure leaves the
+// project around to try again instead of orphaning its collection
 func DeleteProject(c echo.Context) error {
-	userId := c.Get("userId").(string)
-	projectId := c.Param("project_id")
+	projectId := uuid.UUID(projectID(c).Bytes).String()
 
-	projectUUID, err := uuid.Parse(projectId)
+	err := vectorstore.DeleteProject(context.Background(), conn.Vectors, projectId)
 	if err != nil {
-		log.Err(err).Msg("Invalid project ID")
-		return echo.NewHTTPError(http.StatusBadRequest, "Invalid project ID")
-	}
-
-	var pgUUID pgtype.UUID
-	copy(pgUUID.Bytes[:], projectUUID[:])
-	pgUUID.Valid = true
-
-	permission, err := conn.Queries.GetProjectUserPermission(context.Background(), gen.GetProjectUserPermissionParams{
-		UserID:    userId,
-		ProjectID: pgUUID,
-	})
-	if err != nil {
-		log.Err(err).Msg("Failed to retrieve user permission")
-		return echo.NewHTTPError(http.StatusForbidden, "You do not have permission to delete this project")
-	}
-
-	if permission != 0 {
-		return echo.NewHTTPError(http.StatusForbidden, "Only the project owner can delete this project")
+		log.Err(err).Msg("Failed to delete project vectors")
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete project")
 	}
 
-	err = conn.Queries.DeleteProject(context.Background(), pgUUID)
+	err = conn.Queries.DeleteProject(context.Background(), projectID(c))
 	if err != nil {
 		log.Err(err).Msg("Failed to delete project")
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete project")
@@ -150,19 +115,7 @@ func DeleteProject(c echo.Context) error {
 }
 
 func GetProjectByID(c echo.Context) error {
-	projectId := c.Param("project_id")
-
-	projectUUID, err := uuid.Parse(projectId)
-	if err != nil {
-		log.Err(err).Msg("Invalid project ID")
-		return echo.NewHTTPError(http.StatusBadRequest, "Invalid project ID")
-	}
-
-	var pgUUID pgtype.UUID
-	copy(pgUUID.Bytes[:], projectUUID[:])
-	pgUUID.Valid = true
-
-	project, err := conn.Queries.GetProjectByID(context.Background(), pgUUID)
+	project, err := conn.Queries.GetProjectByID(context.Background(), projectID(c))
 	if err != nil {
 		log.Err(err).Msg("Failed to fetch project details")
 		return echo.NewHTTPError(http.StatusNotFound, "Project not found")
@@ -178,60 +131,72 @@ type UpdateProjectRequestBody struct {
 	ModelType   string `json:"model_type,omitempty"`
 }
 
-// UpdateProjectDetails updates partial project details.
-func UpdateProjectDetails(c echo.Context) error {
-	projectIdStr := c.Param("project_id")
-	projectUUID, err := uuid.Parse(projectIdStr)
-	if err != nil {
-		log.Error().Err(err).Msg("Invalid project ID")
-		return echo.NewHTTPError(http.StatusBadRequest, "Invalid project ID")
-	}
+type UpdateProjectResponse struct {
+	Message string `json:"message"`
+	// Set when the new model_type changed the project's embedder, like
+	// PutProjectSettingsResponse
+	ReembedRequired bool     `json:"reembed_required"`
+	InvalidatedBy   []string `json:"invalidated_by"`
+}
 
+// UpdateProjectDetails updates partial project details. Chunking, retrieval
+// and generation are in the project's settings (see GetProjectSettings).
+func UpdateProjectDetails(c echo.Context) error {
 	var body UpdateProjectRequestBody
 	if err := json.NewDecoder(c.Request().Body).Decode(&body); err != nil {
 		log.Error().Err(err).Msg("Invalid request body")
 		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
 	}
 
-	params := gen.UpdateProjectDetailsParams{
-		ID:          pgtype.UUID{Bytes: projectUUID, Valid: true},
+	// With an empty embedding.model the embedder comes from model_type
+	current, err := settings.Load(context.Background(), conn.Queries, projectID(c))
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to retrieve project settings")
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update project details")
+	}
+
+	modelType := current.ModelType
+	if body.ModelType != "" {
+		modelType = body.ModelType
+		if err := checkAvailable(current.Settings, modelType); err != nil {
+			return err
+		}
+	}
+
+	err = conn.Queries.UpdateProjectDetails(context.Background(), gen.UpdateProjectDetailsParams{
+		ID:          projectID(c),
 		Description: pgtype.Text{String: body.Description, Valid: body.Description != ""},
 		Industry:    pgtype.Text{String: body.Industry, Valid: body.Industry != ""},
 		UseCase:     pgtype.Text{String: body.UseCase, Valid: body.UseCase != ""},
 		ModelType:   pgtype.Text{String: body.ModelType, Valid: body.ModelType != ""},
-	}
-
-	err = conn.Queries.UpdateProjectDetails(context.Background(), params)
+	})
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to update project details")
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update project details")
 	}
 
-	return c.JSON(http.StatusOK, map[string]string{
-		"message": "Project details updated successfully",
+	invalidatedBy := current.InvalidatesEmbeddings(current.Settings,
+		embeddingModel(current.Embedding.Model, modelType),
+		embeddingModel(current.Embedding.Model, current.ModelType))
+	if len(invalidatedBy) > 0 {
+		resetCollection(c, current.Embedding.Model, modelType)
+	}
+
+	return c.JSON(http.StatusOK, UpdateProjectResponse{
+		Message:         "Project details updated successfully",
+		ReembedRequired: len(invalidatedBy) > 0,
+		InvalidatedBy:   invalidatedBy,
 	})
 }
 
 // InviteUserRequestBody for Invite Request
 type InviteUserRequestBody struct {
 	Email      string `json:"email"`
-	Permission int32  `json:"permission"`
+	Permission string `json:"permission"` // owner, editor or viewer
 }
 
 func InviteUserToProject(c echo.Context) error {
-	userId := c.Get("userId").(string)
-	projectIdStr := c.Param("project_id")
-
-	// Parse projectId string to UUID
-	projectUUID, err := uuid.Parse(projectIdStr)
-	if err != nil {
-		log.Err(err).Msg("Invalid project ID")
-		return echo.NewHTTPError(http.StatusBadRequest, "Invalid project ID")
-	}
-
-	var pgUUID pgtype.UUID
-	copy(pgUUID.Bytes[:], projectUUID[:])
-	pgUUID.Valid = true
+	pgUUID := projectID(c)
 
 	var body InviteUserRequestBody
 	if err := c.Bind(&body); err != nil {
@@ -239,13 +204,17 @@ func InviteUserToProject(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
 	}
 
-	currentPermission, err := conn.Queries.GetProjectUserPermission(context.Background(), gen.GetProjectUserPermissionParams{
-		UserID:    userId,
-		ProjectID: pgUUID,
-	})
-	if err != nil || (currentPermission != 0 && currentPermission != 1) {
-		log.Error().Err(err).Msg("Insufficient permissions to invite users")
-		return echo.NewHTTPError(http.StatusForbidden, "You do not have permission to invite users")
+	if body.Email == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Email is required")
+	}
+
+	role, err := roles.Parse(body.Permission)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if !projectRole(c).CanAssign(role) {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("You cannot invite someone as %s", role))
 	}
 
 	invitedUser, err := conn.Queries.GetUserByEmail(context.Background(), body.Email)
@@ -254,7 +223,7 @@ func InviteUserToProject(c echo.Context) error {
 		err = conn.Queries.InviteUserToProjectByEmail(context.Background(), gen.InviteUserToProjectByEmailParams{
 			Email:      body.Email,
 			ProjectID:  pgUUID,
-			Permission: body.Permission,
+			Permission: role,
 		})
 		if err != nil {
 			log.Error().Err(err).Msg("Failed to add user to project")
@@ -265,7 +234,7 @@ func InviteUserToProject(c echo.Context) error {
 		err = conn.Queries.InviteUserToProject(context.Background(), gen.InviteUserToProjectParams{
 			UserID:     invitedUser.ID,
 			ProjectID:  pgUUID,
-			Permission: body.Permission,
+			Permission: role,
 			Email:      body.Email,
 		})
 		if err != nil {
@@ -340,32 +309,8 @@ func sendInviteEmail(recipientEmail, projectName string) error {
 }
 
 func GetProjectMembers(c echo.Context) error {
-	userId := c.Get("userId").(string)
-	projectId := c.Param("project_id")
-
-	// Convert the projectId string to pgtype.UUID
-	projectUUID, err := uuid.Parse(projectId)
-	if err != nil {
-		log.Error().Err(err).Msg("Invalid project ID")
-		return echo.NewHTTPError(http.StatusBadRequest, "Invalid project ID")
-	}
-
-	var pgUUID pgtype.UUID
-	copy(pgUUID.Bytes[:], projectUUID[:])
-	pgUUID.Valid = true
-
-	// Check if the current user has permission to view project members
-	currentPermission, err := conn.Queries.GetProjectUserPermission(context.Background(), gen.GetProjectUserPermissionParams{
-		UserID:    userId,
-		ProjectID: pgUUID,
-	})
-	if err != nil || (currentPermission != 0 && currentPermission != 1) {
-		log.Error().Err(err).Msg("Insufficient permissions to view project members")
-		return echo.NewHTTPError(http.StatusForbidden, "You do not have permission to view project members")
-	}
-
 	// Retrieve all members of the project along with their permission levels
-	members, err := conn.Queries.GetProjectMembers(context.Background(), pgUUID)
+	members, err := conn.Queries.GetProjectMembers(context.Background(), projectID(c))
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to retrieve project members")
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve project members")
@@ -376,45 +321,30 @@ func GetProjectMembers(c echo.Context) error {
 }
 
 type ChangePermissionRequestBody struct {
-	Permission int32 `json:"permission"`
+	Permission string `json:"permission"` // owner, editor or viewer
 }
 
 // ChangeUserPermission allows an owner or editor to change the permissions of project members.
 func ChangeUserPermission(c echo.Context) error {
 	userId := c.Get("userId").(string)   // Current user (performing the change)
 	memberId := c.Param("member_id")     // The user whose permissions are being changed
-	projectId := c.Param("project_id")   // Project ID
+	pgUUID := projectID(c)               // Project ID
+	currentRole := projectRole(c)        // Current user's role
 	var body ChangePermissionRequestBody // Request body to accept permission change
 
-	// Parse the projectId and memberId to UUIDs
-	projectUUID, err := uuid.Parse(projectId)
-	if err != nil {
-		log.Err(err).Msg("Invalid project ID")
-		return echo.NewHTTPError(http.StatusBadRequest, "Invalid project ID")
-	}
-
-	var pgUUID pgtype.UUID
-	copy(pgUUID.Bytes[:], projectUUID[:])
-	pgUUID.Valid = true
-
 	// Parse the request body
 	if err := c.Bind(&body); err != nil {
 		log.Error().Err(err).Msg("Invalid request body")
 		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
 	}
 
-	// Check current user's permission
-	currentPermission, err := conn.Queries.GetProjectUserPermission(context.Background(), gen.GetProjectUserPermissionParams{
-		UserID:    userId,
-		ProjectID: pgUUID,
-	})
+	newRole, err := roles.Parse(body.Permission)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to check current user's permission")
-		return echo.NewHTTPError(http.StatusForbidden, "You do not have permission to change project member permissions")
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
-	// Check the target user's current permission
-	memberPermission, err := conn.Queries.GetProjectUserPermission(context.Background(), gen.GetProjectUserPermissionParams{
+	// Check the target user's current role
+	memberRole, err := conn.Queries.GetProjectUserPermission(context.Background(), gen.GetProjectUserPermissionParams{
 		UserID:    memberId,
 		ProjectID: pgUUID,
 	})
@@ -423,22 +353,22 @@ func ChangeUserPermission(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusNotFound, "Member not found or invalid permissions")
 	}
 
-	// Owners (permission level 0) can change any user's permissions
-	// Editors (permission level 1) can only change "Can View" (permission level 2) users to "Can Edit" (permission level 1) or back
+	// Owners can change anyone's role. Editors can only move viewers between
+	// viewer and editor (see roles.Role.CanManageMember)
 	// No one can change their own permission
 	if userId == memberId {
 		return echo.NewHTTPError(http.StatusForbidden, "You cannot change your own permission")
 	}
 
-	if currentPermission == 1 && (memberPermission == 1 || body.Permission == 0) {
+	if !currentRole.CanManageMember(memberRole) || !currentRole.CanAssign(newRole) {
 		return echo.NewHTTPError(http.StatusForbidden, "Editors cannot change other editors or make someone an owner")
 	}
 
-	// Update the target user's permission
+	// Update the target user's role
 	err = conn.Queries.UpdateProjectUserPermission(context.Background(), gen.UpdateProjectUserPermissionParams{
 		UserID:     memberId,
 		ProjectID:  pgUUID,
-		Permission: body.Permission,
+		Permission: newRole,
 	})
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to update project member's permission")
@@ -450,37 +380,10 @@ func ChangeUserPermission(c echo.Context) error {
 	})
 }
 
-// DeleteUserFromProject allows only project owners to delete a member from a project.
+// DeleteUserFromProject removes a member from a project (see roles.Role.CanRemoveMembers).
 func DeleteUserFromProject(c echo.Context) error {
 	userId := c.Get("userId").(string) // Current user (performing the deletion)
 	memberId := c.Param("member_id")   // The user to be removed
-	projectId := c.Param("project_id") // Project ID
-
-	// Parse the projectId and memberId to UUIDs
-	projectUUID, err := uuid.Parse(projectId)
-	if err != nil {
-		log.Err(err).Msg("Invalid project ID")
-		return echo.NewHTTPError(http.StatusBadRequest, "Invalid project ID")
-	}
-
-	var pgUUID pgtype.UUID
-	copy(pgUUID.Bytes[:], projectUUID[:])
-	pgUUID.Valid = true
-
-	// Check current user's permission
-	currentPermission, err := conn.Queries.GetProjectUserPermission(context.Background(), gen.GetProjectUserPermissionParams{
-		UserID:    userId,
-		ProjectID: pgUUID,
-	})
-	if err != nil {
-		log.Err(err).Err(err).Msg("Failed to check current user's permission")
-		return echo.NewHTTPError(http.StatusForbidden, "You do not have permission to delete project members")
-	}
-
-	// Only owners (permission 0) can delete project members
-	if currentPermission != 0 {
-		return echo.NewHTTPError(http.StatusForbidden, "Only project owners can delete members")
-	}
 
 	// Prevent owners from deleting themselves
 	if userId == memberId {
@@ -488,9 +391,9 @@ func DeleteUserFromProject(c echo.Context) error {
 	}
 
 	// Delete the user from the project_users table
-	err = conn.Queries.DeleteUserFromProject(context.Background(), gen.DeleteUserFromProjectParams{
+	err := conn.Queries.DeleteUserFromProject(context.Background(), gen.DeleteUserFromProjectParams{
 		UserID:    memberId,
-		ProjectID: pgUUID,
+		ProjectID: projectID(c),
 	})
 	if err != nil {
 		log.Err(err).Err(err).Msg("Failed to remove user from project")
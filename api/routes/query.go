@@ -0,0 +1,80 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"intualai/conn"
+	"intualai/rag"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+)
+
+func answerer() *rag.Answerer {
+	return rag.New(retriever(), conn.LLMs)
+}
+
+// Query answers a question from the project's files. Takes the same body as
+// Search, the answer cites the chunks it used.
+func Query(c echo.Context) error {
+	body, project, err := bindRetrievalRequest(c)
+	if err != nil {
+		return err
+	}
+
+	answer, err := answerer().Answer(c.Request().Context(), project, body, nil)
+	if err != nil {
+		log.Err(err).Msg("Failed to answer query")
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to answer query")
+	}
+
+	return c.JSON(http.StatusOK, answer)
+}
+
+// Sent instead of the remaining events if answering fails after the stream
+// started
+const eventError = "error"
+
+// QueryStream is Query as server-sent events (see rag.Answerer.Stream), so
+// the answer shows up as it's generated. Closing the connection cancels the
+// LLM request.
+func QueryStream(c echo.Context) error {
+	body, project, err := bindRetrievalRequest(c)
+	if err != nil {
+		return err
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	// Stop nginx and friends from buffering the whole response
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+
+	ctx := c.Request().Context()
+	emit := func(event string, data any) error {
+		payload, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(res, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+			return err
+		}
+		res.Flush()
+		return nil
+	}
+
+	err = answerer().Stream(ctx, project, body, nil, emit)
+	if err != nil && ctx.Err() != nil {
+		log.Info().Msg("Client disconnected from query stream")
+		return nil
+	}
+	if err != nil {
+		log.Err(err).Msg("Failed to stream answer")
+		emit(eventError, map[string]string{"error": "Failed to answer query"})
+	}
+
+	return nil
+}
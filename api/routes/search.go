@@ -0,0 +1,60 @@
+package routes
+
+import (
+	"context"
+	"intualai/conn"
+	"intualai/retrieval"
+	"intualai/settings"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+)
+
+type SearchResponse struct {
+	Results []retrieval.Result `json:"results"`
+}
+
+func retriever() *retrieval.Retriever {
+	r := retrieval.New(conn.Queries, conn.Embedders, conn.Vectors)
+	r.Rerankers = conn.Rerankers
+	return r
+}
+
+// bindRetrievalRequest reads the body shared by Search and Query, along with
+// the project it's for
+func bindRetrievalRequest(c echo.Context) (retrieval.Request, settings.Project, error) {
+	var body retrieval.Request
+	if err := c.Bind(&body); err != nil {
+		log.Error().Err(err).Msg("Invalid request body")
+		return body, settings.Project{}, echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if err := body.Validate(); err != nil {
+		return body, settings.Project{}, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	project, err := settings.Load(context.Background(), conn.Queries, projectID(c))
+	if err != nil {
+		log.Err(err).Msg("Failed to fetch project details")
+		return body, settings.Project{}, echo.NewHTTPError(http.StatusNotFound, "Project not found")
+	}
+
+	return body, project, nil
+}
+
+// Search returns the project's chunks closest to a query, best first
+func Search(c echo.Context) error {
+	body, project, err := bindRetrievalRequest(c)
+	if err != nil {
+		return err
+	}
+
+	results, err := retriever().Search(c.Request().Context(), project, body)
+	if err != nil {
+		log.Err(err).Msg("Failed to search project")
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to search project")
+	}
+
+	return c.JSON(http.StatusOK, SearchResponse{Results: results})
+}
@@ -0,0 +1,244 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"intualai/conn"
+	"intualai/gen"
+	"intualai/rag"
+	"intualai/settings"
+	"intualai/vectorstore"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+)
+
+type ProjectSettingsResponse struct {
+	// 0 means the project still uses the defaults
+	Version  int32             `json:"version"`
+	Settings settings.Settings `json:"settings"`
+}
+
+// GetProjectSettings returns the project's current settings, or an earlier
+// version with ?version=
+func GetProjectSettings(c echo.Context) error {
+	ctx := context.Background()
+
+	if v := c.QueryParam("version"); v != "" {
+		version, err := strconv.Atoi(v)
+		if err != nil || version < 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid version")
+		}
+
+		row, err := conn.Queries.GetProjectSettingsVersion(ctx, gen.GetProjectSettingsVersionParams{
+			ProjectID: projectID(c),
+			Version:   int32(version),
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, "Settings version not found")
+		}
+		if err != nil {
+			log.Err(err).Msg("Failed to retrieve project settings")
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve project settings")
+		}
+
+		response := ProjectSettingsResponse{Version: row.Version, Settings: settings.Default()}
+		if err := json.Unmarshal(row.Settings, &response.Settings); err != nil {
+			log.Err(err).Msg("Failed to decode project settings")
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve project settings")
+		}
+
+		return c.JSON(http.StatusOK, response)
+	}
+
+	project, err := settings.Load(ctx, conn.Queries, projectID(c))
+	if err != nil {
+		log.Err(err).Msg("Failed to retrieve project settings")
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve project settings")
+	}
+
+	return c.JSON(http.StatusOK, ProjectSettingsResponse{Version: project.Version, Settings: project.Settings})
+}
+
+// GetProjectSettingsVersions lists every saved version, newest first
+func GetProjectSettingsVersions(c echo.Context) error {
+	versions, err := conn.Queries.GetProjectSettingsVersions(context.Background(), projectID(c))
+	if err != nil {
+		log.Err(err).Msg("Failed to retrieve project settings versions")
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve project settings versions")
+	}
+
+	return c.JSON(http.StatusOK, versions)
+}
+
+type PutProjectSettingsRequestBody struct {
+	// The version the change was made from. If set and it isn't the current
+	// version anymore, the request fails with 409 instead of overwriting
+	// someone else's change.
+	Version  *int32          `json:"version,omitempty"`
+	Settings json.RawMessage `json:"settings"`
+}
+
+type PutProjectSettingsResponse struct {
+	ProjectSettingsResponse
+	// Set when chunking or the embedding model changed. Stored chunks and
+	// vectors were made with the old settings, files need to be processed
+	// again for search to use the new ones.
+	ReembedRequired bool     `json:"reembed_required"`
+	InvalidatedBy   []string `json:"invalidated_by"`
+}
+
+// PutProjectSettings saves a new version of the project's settings. Fields
+// left out of settings get their defaults.
+func PutProjectSettings(c echo.Context) error {
+	ctx := context.Background()
+
+	var body PutProjectSettingsRequestBody
+	if err := json.NewDecoder(c.Request().Body).Decode(&body); err != nil {
+		log.Error().Err(err).Msg("Invalid request body")
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if len(body.Settings) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "settings is required")
+	}
+
+	next := settings.Default()
+	decoder := json.NewDecoder(bytes.NewReader(body.Settings))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&next); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid settings: %v", err))
+	}
+
+	if err := next.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	current, err := settings.Load(ctx, conn.Queries, projectID(c))
+	if err != nil {
+		log.Err(err).Msg("Failed to retrieve project settings")
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update project settings")
+	}
+
+	if body.Version != nil && *body.Version != current.Version {
+		return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("Settings were changed since version %d, the current version is %d", *body.Version, current.Version))
+	}
+
+	if err := checkAvailable(next, current.ModelType); err != nil {
+		return err
+	}
+
+	document, err := json.Marshal(next)
+	if err != nil {
+		log.Err(err).Msg("Failed to encode project settings")
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update project settings")
+	}
+
+	row, err := conn.Queries.CreateProjectSettings(ctx, gen.CreateProjectSettingsParams{
+		ProjectID: projectID(c),
+		Version:   current.Version + 1,
+		Settings:  document,
+		CreatedBy: actor(c),
+	})
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		// Someone else saved between Load and here
+		return echo.NewHTTPError(http.StatusConflict, "Settings were changed at the same time, try again")
+	}
+	if err != nil {
+		log.Err(err).Msg("Failed to save project settings")
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update project settings")
+	}
+
+	invalidatedBy := next.InvalidatesEmbeddings(current.Settings,
+		embeddingModel(next.Embedding.Model, current.ModelType),
+		embeddingModel(current.Embedding.Model, current.ModelType))
+	if len(invalidatedBy) > 0 {
+		resetCollection(c, next.Embedding.Model, current.ModelType)
+	}
+
+	return c.JSON(http.StatusOK, PutProjectSettingsResponse{
+		ProjectSettingsResponse: ProjectSettingsResponse{Version: row.Version, Settings: next},
+		ReembedRequired:         len(invalidatedBy) > 0,
+		InvalidatedBy:           invalidatedBy,
+	})
+}
+
+// embeddingModel is the model of the embedder model and modelType resolve to,
+// empty if they don't resolve to one
+func embeddingModel(model string, modelType string) string {
+	embedder, err := conn.Embedders.Resolve(model, modelType)
+	if err != nil {
+		return ""
+	}
+	return embedder.Model()
+}
+
+// resetCollection drops the project's collection if its vectors have another
+// size than the embedding model makes now. They can't be searched with the new
+// model anyway, and the worker can't add vectors of the new size to it, it's
+// recreated once files are processed again.
+func resetCollection(c echo.Context, model string, modelType string) {
+	ctx := context.Background()
+	collection := vectorstore.ProjectCollection(uuid.UUID(projectID(c).Bytes).String())
+
+	embedder, err := conn.Embedders.Resolve(model, modelType)
+	if err != nil {
+		log.Err(err).Msg("Failed to resolve embedding model")
+		return
+	}
+
+	info, err := conn.Vectors.Info(ctx, collection)
+	if errors.Is(err, vectorstore.ErrCollectionNotFound) {
+		return
+	}
+	if err != nil {
+		log.Err(err).Str("collection", collection).Msg("Failed to check collection")
+		return
+	}
+	if info.Dimensions == embedder.Dimensions() {
+		return
+	}
+
+	log.Info().
+		Str("collection", collection).
+		Str("embedding_model", embedder.Model()).
+		Msg("Dropping collection for new embedding dimensions")
+
+	if err := conn.Vectors.DeleteCollection(ctx, collection); err != nil {
+		log.Err(err).Str("collection", collection).Msg("Failed to drop collection")
+	}
+}
+
+// checkAvailable makes sure this API instance can actually use the models,
+// reranker and prompt template s asks for
+func checkAvailable(s settings.Settings, modelType string) error {
+	if _, err := conn.Embedders.Resolve(s.Embedding.Model, modelType); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid embedding.model: %v", err))
+	}
+
+	if _, err := conn.LLMs.Resolve(s.Generation.Model, modelType); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid generation.model: %v", err))
+	}
+
+	if s.Retrieval.Reranker != "" {
+		if _, ok := conn.Rerankers[s.Retrieval.Reranker]; !ok {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Reranker %q isn't available", s.Retrieval.Reranker))
+		}
+	}
+
+	if s.Generation.PromptTemplate != "" {
+		if _, err := rag.ParseTemplate(s.Generation.PromptTemplate); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid generation.prompt_template: %v", err))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,496 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"intualai/conn"
+	"intualai/filestate"
+	"intualai/gen"
+	"intualai/storage"
+	"intualai/uploads"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+)
+
+type CreateUploadURLRequestBody struct {
+	FileName string `json:"file_name"`
+	// Exact size of the file in bytes, the URLs only accept that much
+	Size int64    `json:"size"`
+	Tags []string `json:"tags"`
+}
+
+type UploadPart struct {
+	Number int32  `json:"part_number"`
+	Size   int64  `json:"size"`
+	URL    string `json:"url"`
+}
+
+// Either URL (a single PUT) or UploadID and Parts (multipart) are set
+type UploadPlan struct {
+	Method    string       `json:"method"`
+	URL       string       `json:"url,omitempty"`
+	UploadID  string       `json:"upload_id,omitempty"`
+	PartSize  int64        `json:"part_size,omitempty"`
+	Parts     []UploadPart `json:"parts,omitempty"`
+	ExpiresAt time.Time    `json:"expires_at"`
+}
+
+type CreateUploadURLResponse struct {
+	File   gen.File   `json:"file"`
+	Upload UploadPlan `json:"upload"`
+}
+
+// validFileName keeps file names usable as the last segment of a blob key
+func validFileName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, "/\\") && len(name) <= 1024
+}
+
+// CreateUploadURL starts a direct upload: the client gets presigned URLs to
+// PUT the content to, so it never passes through the API. A new file is
+// created PENDING_UPLOAD, an existing one gets the upload as its next version
+// once completed. Either way the URLs point at a staging object, which
+// CompleteUpload copies into place. Files of uploads.MultipartThreshold or
+// more are uploaded in parts. Uploads that aren't completed before the URLs
+// expire are removed by uploads.Expirer.
+func CreateUploadURL(c echo.Context) error {
+	presigner, ok := conn.Blobs.(storage.Presigner)
+	if !ok {
+		return echo.NewHTTPError(http.StatusNotImplemented, "Direct uploads aren't supported by this blob store, use POST /files")
+	}
+
+	var body CreateUploadURLRequestBody
+	if err := c.Bind(&body); err != nil {
+		log.Error().Err(err).Msg("Invalid request body")
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if !validFileName(body.FileName) {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid file_name")
+	}
+	if body.Size <= 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "size must be the file's size in bytes")
+	}
+	if body.Size > conn.MaxDirectUploadSize {
+		return tooLarge("File", conn.MaxDirectUploadSize)
+	}
+
+	tags := []string{}
+	for _, tag := range body.Tags {
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	ctx := context.Background()
+	key := storage.UploadKey(uuid.UUID(projectID(c).Bytes).String(), uuid.NewString())
+	expiresAt := time.Now().UTC().Add(conn.UploadURLExpiry)
+
+	plan := UploadPlan{Method: http.MethodPut, ExpiresAt: expiresAt}
+	multipart := body.Size >= uploads.MultipartThreshold
+
+	uploadId := pgtype.Text{}
+	if multipart {
+		id, err := presigner.CreateMultipartUpload(ctx, key)
+		if err != nil {
+			log.Err(err).Msg("Failed to start multipart upload")
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create upload URL")
+		}
+		uploadId = pgtype.Text{String: id, Valid: true}
+		plan.UploadID = id
+	}
+
+	file, err := startUpload(c, body.FileName, tags, key, uploadId, expiresAt)
+	if err != nil {
+		if multipart {
+			if err := presigner.AbortMultipartUpload(ctx, key, uploadId.String); err != nil {
+				log.Err(err).Msg("Failed to abort multipart upload")
+			}
+		}
+		return err
+	}
+
+	if !multipart {
+		plan.URL, err = presigner.PresignPut(ctx, key, body.Size, conn.UploadURLExpiry)
+		if err != nil {
+			log.Err(err).Msg("Failed to presign upload")
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create upload URL")
+		}
+
+		return c.JSON(http.StatusOK, CreateUploadURLResponse{File: file, Upload: plan})
+	}
+
+	partSize, parts := uploads.Plan(body.Size)
+	plan.PartSize = partSize
+	plan.Parts = make([]UploadPart, 0, parts)
+	for number := int32(1); number <= parts; number++ {
+		size := uploads.PartSize(body.Size, partSize, number)
+		url, err := presigner.PresignPart(ctx, key, uploadId.String, number, size, conn.UploadURLExpiry)
+		if err != nil {
+			log.Err(err).Msg("Failed to presign upload part")
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create upload URL")
+		}
+		plan.Parts = append(plan.Parts, UploadPart{Number: number, Size: size, URL: url})
+	}
+
+	return c.JSON(http.StatusOK, CreateUploadURLResponse{File: file, Upload: plan})
+}
+
+// startUpload records a direct upload to key, creating the file if there
+// isn't one named fileName yet
+func startUpload(c echo.Context, fileName string, tags []string, key string, uploadId pgtype.Text, expiresAt time.Time) (gen.File, error) {
+	ctx := context.Background()
+
+	file, err := conn.Queries.GetFile(ctx, gen.GetFileParams{
+		ProjectID: projectID(c),
+		FileName:  fileName,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		file, err = createPendingFile(c, gen.CreatePendingFileParams{
+			ProjectID:       projectID(c),
+			FileName:        fileName,
+			Tags:            tags,
+			UploadID:        uploadId,
+			UploadKey:       pgtype.Text{String: key, Valid: true},
+			UploadExpiresAt: pgtype.Timestamp{Time: expiresAt, Valid: true},
+		})
+
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return gen.File{}, echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("A file named %q was created at the same time", fileName))
+		}
+		if err != nil {
+			log.Err(err).Msg("Failed to create pending file")
+			return gen.File{}, echo.NewHTTPError(http.StatusInternalServerError, "Failed to create upload URL")
+		}
+		return file, nil
+	}
+	if err != nil {
+		log.Err(err).Send()
+		return gen.File{}, echo.NewHTTPError(http.StatusInternalServerError, "Failed to create upload URL")
+	}
+
+	if err := versionable(file); err != nil {
+		return gen.File{}, err
+	}
+
+	// An upload without tags keeps the file's tags
+	var versionTags []string
+	if len(tags) > 0 {
+		versionTags = tags
+	}
+
+	file, err = conn.Queries.StartFileUpload(ctx, gen.StartFileUploadParams{
+		UploadID:        uploadId,
+		UploadKey:       key,
+		UploadTags:      versionTags,
+		UploadExpiresAt: pgtype.Timestamp{Time: expiresAt, Valid: true},
+		ProjectID:       projectID(c),
+		FileName:        fileName,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return gen.File{}, echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("%q is being uploaded or processed already", fileName))
+	}
+	if err != nil {
+		log.Err(err).Msg("Failed to start file upload")
+		return gen.File{}, echo.NewHTTPError(http.StatusInternalServerError, "Failed to create upload URL")
+	}
+
+	return file, nil
+}
+
+// createPendingFile creates the PENDING_UPLOAD file row and its first
+// file_events entry together
+func createPendingFile(c echo.Context, params gen.CreatePendingFileParams) (gen.File, error) {
+	tx, err := conn.DBPool.Begin(context.Background())
+	if err != nil {
+		return gen.File{}, err
+	}
+	defer tx.Rollback(context.Background())
+
+	qtx := conn.Queries.WithTx(tx)
+
+	file, err := qtx.CreatePendingFile(context.Background(), params)
+	if err != nil {
+		return gen.File{}, err
+	}
+
+	err = filestate.Created(context.Background(), qtx, file, actor(c))
+	if err != nil {
+		return gen.File{}, err
+	}
+
+	return file, tx.Commit(context.Background())
+}
+
+type CompleteUploadRequestBody struct {
+	// Multipart uploads only: the ETag S3 returned for every part
+	Parts []storage.Part `json:"parts"`
+}
+
+// CompleteUpload finishes a direct upload. The object has to be in the
+// bucket by now, it's read back to record its size and SHA-256. A new file
+// moves to UPLOADED, after which it can be processed like any other, unless
+// another file already has the same content, then the upload is dropped and
+// that file is returned instead. An upload to an existing file becomes its
+// next version (see newVersion).
+func CompleteUpload(c echo.Context) error {
+	presigner, ok := conn.Blobs.(storage.Presigner)
+	if !ok {
+		return echo.NewHTTPError(http.StatusNotImplemented, "Direct uploads aren't supported by this blob store, use POST /files")
+	}
+
+	fileName := c.Param("file_name")
+	ctx := context.Background()
+
+	var body CompleteUploadRequestBody
+	if err := c.Bind(&body); err != nil {
+		log.Error().Err(err).Msg("Invalid request body")
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	file, err := conn.Queries.GetFile(ctx, gen.GetFileParams{
+		ProjectID: projectID(c),
+		FileName:  fileName,
+	})
+	if err != nil {
+		return fileStateError(err)
+	}
+
+	if !file.UploadExpiresAt.Valid {
+		return echo.NewHTTPError(http.StatusConflict, "File isn't waiting for an upload")
+	}
+	if file.UploadExpiresAt.Time.Before(time.Now().UTC()) {
+		return echo.NewHTTPError(http.StatusGone, "Upload expired, create a new upload URL")
+	}
+
+	key := uploads.StagingKey(file)
+
+	if file.UploadID.Valid {
+		if len(body.Parts) == 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Multipart uploads must list their parts")
+		}
+
+		err := presigner.CompleteMultipartUpload(ctx, key, file.UploadID.String, body.Parts)
+		if err != nil {
+			log.Err(err).Msg("Failed to complete multipart upload")
+			return echo.NewHTTPError(http.StatusBadRequest, "Failed to complete multipart upload, check that every part was uploaded")
+		}
+	}
+
+	size, checksum, err := uploads.Checksum(ctx, conn.Blobs, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return echo.NewHTTPError(http.StatusConflict, "File hasn't been uploaded yet")
+	}
+	if err != nil {
+		log.Err(err).Msg("Failed to read uploaded file")
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to complete upload")
+	}
+
+	content := fileContent{
+		key:      key,
+		size:     pgtype.Int8{Int64: size, Valid: true},
+		checksum: pgtype.Text{String: checksum, Valid: true},
+	}
+
+	if filestate.State(file.ProcessState) == filestate.PendingUpload {
+		return completeNewFile(c, file, content)
+	}
+	return completeNewVersion(c, file, content)
+}
+
+// completeNewFile moves a PENDING_UPLOAD file's content into place
+func completeNewFile(c echo.Context, file gen.File, content fileContent) error {
+	ctx := context.Background()
+
+	duplicate, err := conn.Queries.GetFileByChecksum(ctx, gen.GetFileByChecksumParams{
+		ProjectID: file.ProjectID,
+		Checksum:  content.checksum,
+	})
+	if err == nil {
+		return dropDuplicateUpload(c, content.key, duplicate)
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		log.Err(err).Msg("Failed to look up duplicate files")
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to complete upload")
+	}
+
+	key := storage.FileKey(uuid.UUID(file.ProjectID.Bytes).String(), file.FileName)
+	// Uploads started before staging are in place already
+	staged := content.key != key
+
+	file, err = saveNewFile(c, file, key, content)
+	if err != nil {
+		if errors.Is(err, filestate.ErrConflict) || errors.Is(err, pgx.ErrNoRows) {
+			return fileStateError(err)
+		}
+		log.Err(err).Msg("Failed to complete upload")
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to complete upload")
+	}
+
+	if staged {
+		deleteStaged(content.key)
+	}
+
+	return c.JSON(http.StatusOK, UploadResult{File: file, UploadStatus: UploadCreated})
+}
+
+// saveNewFile copies the staged content to key, then moves file to UPLOADED
+// and records its content together.
+//
+// The file's row is locked and checked to still be PENDING_UPLOAD before the
+// copy, so a concurrent completion either finished first and this returns
+// filestate.ErrConflict without touching key, or waits until this one is done.
+// The copy is only deleted again while the lock is held, it can't be another
+// completion's object.
+func saveNewFile(c echo.Context, file gen.File, key string, content fileContent) (gen.File, error) {
+	ctx := context.Background()
+
+	tx, err := conn.DBPool.Begin(ctx)
+	if err != nil {
+		return gen.File{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := conn.Queries.WithTx(tx)
+
+	if err := lockVersion(ctx, qtx, file); err != nil {
+		return gen.File{}, err
+	}
+
+	staged := content.key != key
+	if staged {
+		if err := conn.Blobs.Copy(ctx, content.key, key); err != nil {
+			return gen.File{}, err
+		}
+	}
+
+	saved, err := recordNewFile(c, qtx, file, content)
+	if err != nil {
+		if staged {
+			if err := conn.Blobs.Delete(ctx, key); err != nil {
+				log.Err(err).Str("key", key).Msg("Failed to delete copied file object")
+			}
+		}
+		return gen.File{}, err
+	}
+
+	// The file stays PENDING_UPLOAD if the commit fails, the copy is
+	// overwritten when the upload is completed again
+	return saved, tx.Commit(ctx)
+}
+
+// recordNewFile moves file to UPLOADED and records its content
+func recordNewFile(c echo.Context, qtx *gen.Queries, file gen.File, content fileContent) (gen.File, error) {
+	ctx := context.Background()
+
+	_, err := filestate.Apply(ctx, qtx, filestate.Transition{
+		ProjectID: file.ProjectID,
+		FileName:  file.FileName,
+		From:      filestate.PendingUpload,
+		To:        filestate.Uploaded,
+		Actor:     actor(c),
+		Reason:    "Upload completed",
+	})
+	if err != nil {
+		return gen.File{}, err
+	}
+
+	file, err = qtx.SetFileContent(ctx, gen.SetFileContentParams{
+		ProjectID: file.ProjectID,
+		FileName:  file.FileName,
+		Size:      content.size,
+		Checksum:  content.checksum,
+	})
+	if err != nil {
+		return gen.File{}, err
+	}
+
+	return file, nil
+}
+
+// completeNewVersion makes a direct upload to an existing file its next
+// version, like POST /files does for an upload under an existing name
+func completeNewVersion(c echo.Context, file gen.File, content fileContent) error {
+	ctx := context.Background()
+
+	if file.Checksum == content.checksum {
+		file, err := conn.Queries.ClearFileUpload(ctx, gen.ClearFileUploadParams{
+			ProjectID: file.ProjectID,
+			FileName:  file.FileName,
+			UploadKey: file.UploadKey,
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusConflict, "File isn't waiting for an upload")
+		}
+		if err != nil {
+			log.Err(err).Msg("Failed to complete upload")
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to complete upload")
+		}
+
+		deleteStaged(content.key)
+		return c.JSON(http.StatusOK, UploadResult{File: file, UploadStatus: UploadUnchanged})
+	}
+
+	// Queued while the upload was pending
+	if err := versionable(file); err != nil {
+		return err
+	}
+
+	content.tags = file.UploadTags
+	content.upload = file.UploadKey
+	content.reason = fmt.Sprintf("Version %d uploaded", file.Version+1)
+
+	file, err := newVersion(c, file, content)
+	if errors.Is(err, filestate.ErrConflict) {
+		return fileStateError(err)
+	}
+	if err != nil {
+		log.Err(err).Msg("Failed to complete upload")
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to complete upload")
+	}
+
+	deleteStaged(content.key)
+	return c.JSON(http.StatusOK, UploadResult{File: file, UploadStatus: UploadNewVersion})
+}
+
+// deleteStaged removes a staging object once its content was moved into
+// place. It's kept until then so a failed completion can be tried again.
+func deleteStaged(key string) {
+	if err := conn.Blobs.Delete(context.Background(), key); err != nil {
+		log.Err(err).Str("key", key).Msg("Failed to delete staged upload")
+	}
+}
+
+// dropDuplicateUpload removes a completed direct upload whose content
+// duplicate already has, and answers with duplicate instead
+func dropDuplicateUpload(c echo.Context, key string, duplicate gen.File) error {
+	ctx := context.Background()
+
+	deleted, err := conn.Queries.DeletePendingFile(ctx, gen.DeletePendingFileParams{
+		ProjectID: projectID(c),
+		FileName:  c.Param("file_name"),
+	})
+	if err != nil {
+		log.Err(err).Msg("Failed to delete duplicate upload")
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to complete upload")
+	}
+	if deleted == 0 {
+		// Completed by a concurrent request
+		return echo.NewHTTPError(http.StatusConflict, "File isn't waiting for an upload")
+	}
+
+	if err := conn.Blobs.Delete(ctx, key); err != nil {
+		log.Err(err).Str("key", key).Msg("Failed to delete duplicate upload")
+	}
+
+	return c.JSON(http.StatusOK, UploadResult{File: duplicate, UploadStatus: UploadDuplicate})
+}
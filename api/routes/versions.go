@@ -0,0 +1,332 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"intualai/conn"
+	"intualai/filestate"
+	"intualai/gen"
+	"intualai/storage"
+	"intualai/vectorstore"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// What happened to each file of an upload
+const (
+	UploadCreated = "created"
+	// Same name, new content: the old content was archived as a version
+	UploadNewVersion = "new_version"
+	// Same name and content as the current version, nothing changed
+	UploadUnchanged = "unchanged"
+	// Another file already has this content, it's returned instead
+	UploadDuplicate = "duplicate"
+)
+
+type UploadResult struct {
+	gen.File
+	UploadStatus string `json:"upload_status"`
+}
+
+// versionable rejects files whose content is in use right now
+func versionable(file gen.File) error {
+	switch filestate.State(file.ProcessState) {
+	case filestate.PendingUpload, filestate.Queued, filestate.Processing:
+		return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("%s files can't get a new version", file.ProcessState))
+	}
+	return nil
+}
+
+// fileContent is what a new version of a file is made from
+type fileContent struct {
+	// Object the content is copied from
+	key  string
+	size pgtype.Int8
+	// Hex SHA-256
+	checksum pgtype.Text
+	// nil keeps the file's tags
+	tags   []string
+	reason string
+	// The direct upload (files.upload_key) the content came from, cleared
+	// along with saving the version
+	upload pgtype.Text
+}
+
+// newVersion makes content the current version of file. The current content
+// is copied to a VersionKey and recorded in file_versions, then the file
+// starts over as UPLOADED with its chunks and vectors gone, so retrieval
+// never mixes versions. It has to be processed again to be searchable.
+//
+// The file's row stays locked while its object is replaced, so concurrent
+// uploads, restores and queueing wait instead of seeing content that doesn't
+// match files.checksum. Returns filestate.ErrConflict if the file changed
+// since it was read.
+func newVersion(c echo.Context, file gen.File, content fileContent) (gen.File, error) {
+	ctx := context.Background()
+	projectId := uuid.UUID(file.ProjectID.Bytes).String()
+	current := storage.FileKey(projectId, file.FileName)
+	archive := storage.VersionKey(projectId, uuid.NewString())
+
+	tx, err := conn.DBPool.Begin(ctx)
+	if err != nil {
+		return gen.File{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := conn.Queries.WithTx(tx)
+
+	if err := lockVersion(ctx, qtx, file); err != nil {
+		return gen.File{}, err
+	}
+
+	if err := conn.Blobs.Copy(ctx, current, archive); err != nil {
+		return gen.File{}, err
+	}
+
+	if err := conn.Blobs.Copy(ctx, content.key, current); err != nil {
+		restoreObject(archive, current)
+		return gen.File{}, err
+	}
+
+	versioned, err := saveVersion(c, qtx, file, archive, content)
+	if err != nil {
+		restoreObject(archive, current)
+		return gen.File{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		restoreUnchanged(file, archive, current)
+		return gen.File{}, err
+	}
+
+	// Search skips vectors without chunks, leftovers only waste space until
+	// the file is processed again
+	err = conn.Vectors.DeleteFile(ctx, vectorstore.ProjectCollection(projectId), file.FileName)
+	if err != nil {
+		log.Err(err).Str("file_name", file.FileName).Msg("Failed to delete old version's vectors")
+	}
+
+	return versioned, nil
+}
+
+// lockVersion locks file's row for the rest of the transaction, failing
+// with filestate.ErrConflict if it was queued or replaced since it was read
+func lockVersion(ctx context.Context, queries *gen.Queries, file gen.File) error {
+	locked, err := queries.GetFileForUpdate(ctx, gen.GetFileForUpdateParams{
+		ProjectID: file.ProjectID,
+		FileName:  file.FileName,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return filestate.ErrConflict
+	}
+	if err != nil {
+		return err
+	}
+	if locked.Version != file.Version || locked.ProcessState != file.ProcessState {
+		return filestate.ErrConflict
+	}
+	return nil
+}
+
+// restoreObject puts the archived content back if the new version couldn't
+// be saved. Only call it while holding the row lock.
+func restoreObject(archive string, current string) {
+	ctx := context.Background()
+
+	if err := conn.Blobs.Copy(ctx, archive, current); err != nil {
+		log.Err(err).Str("key", current).Msg("Failed to restore file object")
+		return
+	}
+	if err := conn.Blobs.Delete(ctx, archive); err != nil {
+		log.Err(err).Str("key", archive).Msg("Failed to delete archived file object")
+	}
+}
+
+// restoreUnchanged restores the archived content after a failed commit. The
+// lock went with the transaction, so it's taken again and the content is only
+// put back if the file is still at the version it was replacing. Otherwise
+// the commit went through after all, or someone else replaced it since.
+func restoreUnchanged(file gen.File, archive string, current string) {
+	ctx := context.Background()
+
+	tx, err := conn.DBPool.Begin(ctx)
+	if err != nil {
+		log.Err(err).Str("key", current).Msg("Failed to restore file object")
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	err = lockVersion(ctx, conn.Queries.WithTx(tx), file)
+	if errors.Is(err, filestate.ErrConflict) {
+		return
+	}
+	if err != nil {
+		log.Err(err).Str("key", current).Msg("Failed to restore file object")
+		return
+	}
+
+	restoreObject(archive, current)
+}
+
+// saveVersion archives file's current version under archive and records
+// content as the new one. queries must be bound to the transaction holding
+// the lock from lockVersion.
+func saveVersion(c echo.Context, queries *gen.Queries, file gen.File, archive string, content fileContent) (gen.File, error) {
+	ctx := context.Background()
+
+	_, err := queries.CreateFileVersion(ctx, gen.CreateFileVersionParams{
+		ProjectID:    file.ProjectID,
+		FileName:     file.FileName,
+		Version:      file.Version,
+		ObjectKey:    archive,
+		Checksum:     file.Checksum,
+		Size:         file.Size,
+		ProcessState: file.ProcessState,
+		UploadedAt:   file.VersionCreatedAt,
+		ArchivedBy:   actor(c),
+	})
+	if err != nil {
+		return gen.File{}, err
+	}
+
+	versioned, err := queries.SetFileVersion(ctx, gen.SetFileVersionParams{
+		Size:      content.size,
+		Checksum:  content.checksum,
+		Tags:      content.tags,
+		ProjectID: file.ProjectID,
+		FileName:  file.FileName,
+	})
+	if err != nil {
+		return gen.File{}, err
+	}
+
+	if content.upload.Valid {
+		versioned, err = queries.ClearFileUpload(ctx, gen.ClearFileUploadParams{
+			ProjectID: file.ProjectID,
+			FileName:  file.FileName,
+			UploadKey: content.upload,
+		})
+		// Expired or completed by someone else
+		if errors.Is(err, pgx.ErrNoRows) {
+			return gen.File{}, filestate.ErrConflict
+		}
+		if err != nil {
+			return gen.File{}, err
+		}
+	}
+
+	err = queries.DeleteFileChunks(ctx, gen.DeleteFileChunksParams{
+		ProjectID: file.ProjectID,
+		FileName:  file.FileName,
+	})
+	if err != nil {
+		return gen.File{}, err
+	}
+
+	err = filestate.Versioned(ctx, queries, filestate.State(file.ProcessState), versioned, actor(c), content.reason)
+	if err != nil {
+		return gen.File{}, err
+	}
+
+	return versioned, nil
+}
+
+type FileVersionsResponse struct {
+	Current gen.File `json:"current"`
+	// Archived versions, newest first
+	Versions []gen.FileVersion `json:"versions"`
+}
+
+// GetFileVersions returns a file's current version along with the ones it
+// replaced
+func GetFileVersions(c echo.Context) error {
+	fileName := c.Param("file_name")
+	ctx := context.Background()
+
+	file, err := conn.Queries.GetFile(ctx, gen.GetFileParams{
+		ProjectID: projectID(c),
+		FileName:  fileName,
+	})
+	if err != nil {
+		return fileStateError(err)
+	}
+
+	versions, err := conn.Queries.GetFileVersions(ctx, gen.GetFileVersionsParams{
+		ProjectID: projectID(c),
+		FileName:  fileName,
+	})
+	if err != nil {
+		log.Err(err).Msg("Failed to retrieve file versions")
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve file versions")
+	}
+	if versions == nil {
+		versions = []gen.FileVersion{}
+	}
+
+	return c.JSON(http.StatusOK, FileVersionsResponse{Current: file, Versions: versions})
+}
+
+// RestoreFileVersion makes a copy of an archived version the file's newest
+// version. The version it replaces is archived like any other, so restoring
+// never loses anything.
+func RestoreFileVersion(c echo.Context) error {
+	fileName := c.Param("file_name")
+	ctx := context.Background()
+
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil || version < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid version")
+	}
+
+	file, err := conn.Queries.GetFile(ctx, gen.GetFileParams{
+		ProjectID: projectID(c),
+		FileName:  fileName,
+	})
+	if err != nil {
+		return fileStateError(err)
+	}
+
+	archived, err := conn.Queries.GetFileVersion(ctx, gen.GetFileVersionParams{
+		ProjectID: projectID(c),
+		FileName:  fileName,
+		Version:   int32(version),
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return echo.NewHTTPError(http.StatusNotFound, "File version not found")
+	}
+	if err != nil {
+		log.Err(err).Msg("Failed to retrieve file version")
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to restore file version")
+	}
+
+	if archived.Checksum.Valid && archived.Checksum == file.Checksum {
+		return c.JSON(http.StatusOK, UploadResult{File: file, UploadStatus: UploadUnchanged})
+	}
+
+	if err := versionable(file); err != nil {
+		return err
+	}
+
+	file, err = newVersion(c, file, fileContent{
+		key:      archived.ObjectKey,
+		size:     archived.Size,
+		checksum: archived.Checksum,
+		reason:   fmt.Sprintf("Restored version %d", archived.Version),
+	})
+	if errors.Is(err, filestate.ErrConflict) {
+		return fileStateError(err)
+	}
+	if err != nil {
+		log.Err(err).Msg("Failed to restore file version")
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to restore file version")
+	}
+
+	return c.JSON(http.StatusOK, UploadResult{File: file, UploadStatus: UploadNewVersion})
+}
@@ -0,0 +1,199 @@
+package settings
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"intualai/chunker"
+	"intualai/gen"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Search modes (see retrieval/)
+type Mode string
+
+const (
+	// Embedding similarity, finds chunks that mean the same thing
+	ModeVector Mode = "vector"
+	// Postgres full-text search, finds exact words like identifiers and codes
+	ModeKeyword Mode = "keyword"
+	// Both, merged with reciprocal rank fusion
+	ModeHybrid Mode = "hybrid"
+)
+
+func (m Mode) Valid() bool {
+	return m == ModeVector || m == ModeKeyword || m == ModeHybrid
+}
+
+// Limits checked by Validate
+const (
+	MaxTopK          = 100
+	MaxRerankDepth   = 200
+	MaxTemperature   = 2
+	MinContextTokens = 256
+	MaxContextTokens = 200_000
+)
+
+// Settings is a project's settings document. Every change is stored as a new
+// version in project_settings.
+type Settings struct {
+	Chunking   chunker.Config `json:"chunking"`
+	Embedding  Embedding      `json:"embedding"`
+	Retrieval  Retrieval      `json:"retrieval"`
+	Generation Generation     `json:"generation"`
+}
+
+type Embedding struct {
+	// "provider/model", e.g. "openai/text-embedding-3-small". Empty uses the
+	// default model of the provider named by the project's model_type.
+	Model string `json:"model"`
+}
+
+type Retrieval struct {
+	// Used when a search doesn't set its mode
+	Mode Mode `json:"mode"`
+	// Used when a search doesn't set top_k
+	TopK int `json:"top_k"`
+	// Empty doesn't rerank
+	Reranker string `json:"reranker"`
+	// How many first-stage results are reranked
+	RerankDepth int `json:"rerank_depth"`
+}
+
+type Generation struct {
+	// "provider/model", e.g. "openai/gpt-4o". Empty uses the model_type.
+	Model       string  `json:"model"`
+	Temperature float64 `json:"temperature"`
+	// Sent as the system message, empty sends none
+	SystemPrompt string `json:"system_prompt"`
+	// Empty uses rag.DefaultTemplate
+	PromptTemplate string `json:"prompt_template"`
+	// Everything sent is kept under this: system prompt, history, template
+	// and sources. Sources are dropped first (lowest ranked first), then the
+	// oldest history.
+	MaxContextTokens int `json:"max_context_tokens"`
+}
+
+// Default is what projects use until their settings are changed
+func Default() Settings {
+	return Settings{
+		Chunking: chunker.DefaultConfig(),
+		Retrieval: Retrieval{
+			Mode:        ModeHybrid,
+			TopK:        10,
+			RerankDepth: 50,
+		},
+		Generation: Generation{
+			MaxContextTokens: 6000,
+		},
+	}
+}
+
+// Validate checks the settings on their own. Whether the models, reranker and
+// prompt template can actually be used depends on how the API is configured,
+// the settings route checks that.
+func (s Settings) Validate() error {
+	if err := s.Chunking.Validate(); err != nil {
+		return err
+	}
+
+	if s.Embedding.Model != "" && !strings.Contains(s.Embedding.Model, "/") {
+		return errors.New("embedding.model must look like provider/model")
+	}
+
+	if !s.Retrieval.Mode.Valid() {
+		return fmt.Errorf("retrieval.mode must be %s, %s or %s", ModeVector, ModeKeyword, ModeHybrid)
+	}
+	if s.Retrieval.TopK < 1 || s.Retrieval.TopK > MaxTopK {
+		return fmt.Errorf("retrieval.top_k must be between 1 and %d", MaxTopK)
+	}
+	if s.Retrieval.RerankDepth < 1 || s.Retrieval.RerankDepth > MaxRerankDepth {
+		return fmt.Errorf("retrieval.rerank_depth must be between 1 and %d", MaxRerankDepth)
+	}
+
+	if s.Generation.Model != "" && !strings.Contains(s.Generation.Model, "/") {
+		return errors.New("generation.model must look like provider/model")
+	}
+	if s.Generation.Temperature < 0 || s.Generation.Temperature > MaxTemperature {
+		return fmt.Errorf("generation.temperature must be between 0 and %d", MaxTemperature)
+	}
+	if s.Generation.MaxContextTokens < MinContextTokens || s.Generation.MaxContextTokens > MaxContextTokens {
+		return fmt.Errorf("generation.max_context_tokens must be between %d and %d", MinContextTokens, MaxContextTokens)
+	}
+
+	return nil
+}
+
+// InvalidatesEmbeddings lists the settings that changed from old to s and
+// make stored chunks and vectors stale. Files have to be processed again for
+// the change to apply to them.
+//
+// model and oldModel are the embedders the two resolve to (Embedder.Model()).
+// With an empty embedding.model that's up to the project's model_type, so the
+// embedder can change while the settings don't.
+func (s Settings) InvalidatesEmbeddings(old Settings, model string, oldModel string) []string {
+	changed := []string{}
+	if s.Chunking.Strategy != old.Chunking.Strategy {
+		changed = append(changed, "chunking.strategy")
+	}
+	if s.Chunking.Size != old.Chunking.Size {
+		changed = append(changed, "chunking.size")
+	}
+	if s.Chunking.Overlap != old.Chunking.Overlap {
+		changed = append(changed, "chunking.overlap")
+	}
+	if model != oldModel {
+		if s.Embedding.Model != old.Embedding.Model {
+			changed = append(changed, "embedding.model")
+		} else {
+			changed = append(changed, "model_type")
+		}
+	}
+	return changed
+}
+
+// Project is a project along with its current settings, what processing,
+// retrieval and generation work from
+type Project struct {
+	ID        pgtype.UUID
+	Name      string
+	ModelType string
+	// 0 until the settings are changed for the first time
+	Version int32
+	Settings
+}
+
+// Load returns a project with its latest settings
+func Load(ctx context.Context, queries *gen.Queries, projectId pgtype.UUID) (Project, error) {
+	project, err := queries.GetProjectByID(ctx, projectId)
+	if err != nil {
+		return Project{}, err
+	}
+
+	result := Project{
+		ID:        project.ID,
+		Name:      project.Name,
+		ModelType: project.ModelType.String,
+		Settings:  Default(),
+	}
+
+	row, err := queries.GetProjectSettings(ctx, projectId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return result, nil
+	}
+	if err != nil {
+		return Project{}, err
+	}
+
+	result.Version = row.Version
+	// Fields missing from older documents keep their defaults
+	if err := json.Unmarshal(row.Settings, &result.Settings); err != nil {
+		return Project{}, err
+	}
+
+	return result, nil
+}
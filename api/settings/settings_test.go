@@ -0,0 +1,83 @@
+package settings
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInvalidatesEmbeddings(t *testing.T) {
+	tests := []struct {
+		name     string
+		change   func(s *Settings)
+		model    string
+		oldModel string
+		want     []string
+	}{
+		{name: "nothing", change: func(s *Settings) {}, want: []string{}},
+		{name: "retrieval", change: func(s *Settings) { s.Retrieval.TopK++ }, want: []string{}},
+		{name: "chunking", change: func(s *Settings) { s.Chunking.Size++; s.Chunking.Overlap++ }, want: []string{"chunking.size", "chunking.overlap"}},
+		{
+			name:     "embedding model",
+			change:   func(s *Settings) { s.Embedding.Model = "hash/fnv-64" },
+			model:    "hash/fnv-64",
+			oldModel: "openai/text-embedding-3-small",
+			want:     []string{"embedding.model"},
+		},
+		{
+			// What the model type already resolved to
+			name:     "same embedder",
+			change:   func(s *Settings) { s.Embedding.Model = "openai/text-embedding-3-small" },
+			model:    "openai/text-embedding-3-small",
+			oldModel: "openai/text-embedding-3-small",
+			want:     []string{},
+		},
+		{
+			name:     "model type",
+			change:   func(s *Settings) {},
+			model:    "hash/fnv-256",
+			oldModel: "openai/text-embedding-3-small",
+			want:     []string{"model_type"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			old := Default()
+			next := Default()
+			test.change(&next)
+
+			if got := next.InvalidatesEmbeddings(old, test.model, test.oldModel); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("InvalidatesEmbeddings = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(s *Settings)
+		err    string
+	}{
+		{name: "defaults", change: func(s *Settings) {}},
+		{name: "chunking size", change: func(s *Settings) { s.Chunking.Size = 8 }, err: "chunking.size must be between 16 and 8192 tokens, got 8"},
+		{name: "chunking overlap", change: func(s *Settings) { s.Chunking.Overlap = s.Chunking.Size }, err: "chunking.overlap must be at least 0 and less than chunking.size, got 512"},
+		{name: "embedding model", change: func(s *Settings) { s.Embedding.Model = "small" }, err: "embedding.model must look like provider/model"},
+		{name: "top k", change: func(s *Settings) { s.Retrieval.TopK = 0 }, err: "retrieval.top_k must be between 1 and 100"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := Default()
+			test.change(&s)
+
+			err := s.Validate()
+			if test.err == "" && err != nil {
+				t.Fatal(err)
+			}
+			if test.err != "" && (err == nil || err.Error() != test.err) {
+				t.Errorf("Validate = %v, want %q", err, test.err)
+			}
+		})
+	}
+}
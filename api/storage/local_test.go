@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalStorePath(t *testing.T) {
+	store, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key  string
+		want string
+		ok   bool
+	}{
+		{key: "project/file.txt", want: "project/file.txt", ok: true},
+		{key: "project/dir/../file.txt", want: "project/file.txt", ok: true},
+		// Absolute keys are still relative to the root
+		{key: "/project/file.txt", want: "project/file.txt", ok: true},
+		{key: "../file.txt"},
+		{key: "project/../../file.txt"},
+		{key: "project/../.."},
+		{key: "../" + filepath.Base(store.root) + "-other/file.txt"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.key, func(t *testing.T) {
+			path, err := store.path(test.key)
+			if !test.ok {
+				if err == nil {
+					t.Fatalf("path(%q) = %q, want an error", test.key, path)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("path(%q): %v", test.key, err)
+			}
+			if want := filepath.Join(store.root, filepath.FromSlash(test.want)); path != want {
+				t.Errorf("path(%q) = %q, want %q", test.key, path, want)
+			}
+		})
+	}
+}
+
+func TestLocalStoreEscape(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewLocal(filepath.Join(dir, "root"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := os.WriteFile(filepath.Join(dir, "secret"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Get(ctx, "../secret"); err == nil {
+		t.Error("Get read a file outside the root")
+	}
+	if err := store.Put(ctx, "../written", strings.NewReader("data")); err == nil {
+		t.Error("Put wrote a file outside the root")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "written")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("file outside the root exists: %v", err)
+	}
+	if err := store.Copy(ctx, "../secret", "copy"); err == nil {
+		t.Error("Copy read a file outside the root")
+	}
+	if err := store.Delete(ctx, "../secret"); err == nil {
+		t.Error("Delete removed a file outside the root")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "secret")); err != nil {
+		t.Errorf("file outside the root is gone: %v", err)
+	}
+}
+
+func TestLocalStoreRoundTrip(t *testing.T) {
+	store, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := store.Put(ctx, "project/file.txt", strings.NewReader("content")); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Copy(ctx, "project/file.txt", "versions/project/1"); err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := store.Get(ctx, "versions/project/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "content" {
+		t.Errorf("copy contains %q, want %q", data, "content")
+	}
+
+	objects, err := store.List(ctx, "project/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 1 || objects[0].Key != "project/file.txt" || objects[0].Size != 7 {
+		t.Errorf("List(project/) = %+v, want project/file.txt of 7 bytes", objects)
+	}
+
+	if err := store.Delete(ctx, "project/file.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(ctx, "project/file.txt"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete: %v, want ErrNotFound", err)
+	}
+	// Deleting twice is fine
+	if err := store.Delete(ctx, "project/file.txt"); err != nil {
+		t.Errorf("second Delete: %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ErrNotFound is returned when an object doesn't exist
+var ErrNotFound = errors.New("object not found")
+
+type ObjectInfo struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// BlobStore is where uploaded files live. The API and the processing worker
+// both go through it, so either can run against S3 or a local directory.
+type BlobStore interface {
+	// Put streams body into key, overwriting anything already there
+	Put(ctx context.Context, key string, body io.Reader) error
+	// Get opens key for reading. Callers must close the reader.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes key. Deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+	// Copy copies from to to, overwriting anything already there. Returns
+	// ErrNotFound if from doesn't exist.
+	Copy(ctx context.Context, from string, to string) error
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	// List returns every object whose key starts with prefix
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+}
+
+// Part is an uploaded part of a multipart upload
+type Part struct {
+	Number int32  `json:"part_number"`
+	ETag   string `json:"etag"`
+}
+
+// Presigner is implemented by stores that clients can upload to directly,
+// without the file passing through the API. URLs stop working after expires.
+type Presigner interface {
+	// PresignPut returns a URL that a single PUT of exactly size bytes can
+	// upload key with
+	PresignPut(ctx context.Context, key string, size int64, expires time.Duration) (string, error)
+	// CreateMultipartUpload starts a multipart upload of key and returns its ID
+	CreateMultipartUpload(ctx context.Context, key string) (string, error)
+	// PresignPart returns a URL that part number of the upload can be PUT to
+	PresignPart(ctx context.Context, key string, uploadId string, number int32, size int64, expires time.Duration) (string, error)
+	// CompleteMultipartUpload assembles the parts into key
+	CompleteMultipartUpload(ctx context.Context, key string, uploadId string, parts []Part) error
+	// AbortMultipartUpload drops the upload and any parts already uploaded
+	AbortMultipartUpload(ctx context.Context, key string, uploadId string) error
+	// PresignGet returns a URL key can be downloaded from, as fileName
+	PresignGet(ctx context.Context, key string, fileName string, expires time.Duration) (string, error)
+}
+
+// FileKey is where a project's file is stored. Each project is a "folder"
+func FileKey(projectId string, fileName string) string {
+	return fmt.Sprintf("%s/%s", projectId, fileName)
+}
+
+// UploadKey is where an upload is staged until it's known whether it's a new
+// file, a new version of one or a duplicate
+func UploadKey(projectId string, id string) string {
+	return fmt.Sprintf("uploads/%s/%s", projectId, id)
+}
+
+// VersionKey is where an archived version of a file is kept. It doesn't
+// contain the file name, so renaming the file leaves its versions alone.
+func VersionKey(projectId string, id string) string {
+	return fmt.Sprintf("versions/%s/%s", projectId, id)
+}
@@ -0,0 +1,182 @@
+package uploads
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"intualai/filestate"
+	"intualai/gen"
+	"intualai/storage"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rs/zerolog/log"
+)
+
+// Files at least this big are uploaded in parts, S3 takes up to 5 GiB in a
+// single PUT but one failed request would mean starting over
+const MultipartThreshold = 64 << 20
+
+// S3 limits for multipart uploads
+const (
+	minPartSize = 16 << 20
+	maxParts    = 10_000
+)
+
+// Plan splits size bytes into parts of partSize, the last one smaller. Parts
+// are numbered from 1.
+func Plan(size int64) (partSize int64, parts int32) {
+	partSize = max(minPartSize, (size+maxParts-1)/maxParts)
+	// Round up to a whole MiB
+	partSize = (partSize + 1<<20 - 1) &^ (1<<20 - 1)
+	return partSize, int32((size + partSize - 1) / partSize)
+}
+
+// PartSize is the size of part number (from 1) of a size byte upload split
+// into parts of partSize
+func PartSize(size int64, partSize int64, number int32) int64 {
+	return min(partSize, size-int64(number-1)*partSize)
+}
+
+// StagingKey is where file's pending direct upload is put. Uploads started
+// before staging went straight to the file's key.
+func StagingKey(file gen.File) string {
+	if file.UploadKey.Valid {
+		return file.UploadKey.String
+	}
+	return storage.FileKey(uuid.UUID(file.ProjectID.Bytes).String(), file.FileName)
+}
+
+// Checksum reads key back from the store and returns its size and hex
+// SHA-256
+func Checksum(ctx context.Context, blobs storage.BlobStore, key string) (int64, string, error) {
+	body, err := blobs.Get(ctx, key)
+	if err != nil {
+		return 0, "", err
+	}
+	defer body.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, body)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Expirer removes direct uploads that were started but never completed: the
+// PENDING_UPLOAD file row, or the pending upload of an existing file's next
+// version, and whatever made it into the bucket. Several API instances can run
+// one, an upload is only cleaned up by whoever removes it from its row.
+type Expirer struct {
+	queries *gen.Queries
+	blobs   storage.BlobStore
+
+	pollInterval time.Duration
+	batchSize    int32
+}
+
+func NewExpirer(queries *gen.Queries, blobs storage.BlobStore) *Expirer {
+	return &Expirer{
+		queries:      queries,
+		blobs:        blobs,
+		pollInterval: time.Minute,
+		batchSize:    50,
+	}
+}
+
+// Run expires uploads until ctx is cancelled. The batch in progress when it
+// is gets to finish, so no upload is left half removed.
+func (e *Expirer) Run(ctx context.Context) {
+	batchCtx := context.WithoutCancel(ctx)
+
+	for ctx.Err() == nil {
+		expired, err := e.expireBatch(batchCtx)
+		if err != nil && ctx.Err() == nil {
+			log.Err(err).Msg("Failed to expire pending uploads")
+		}
+
+		if expired > 0 {
+			log.Info().Int("expired", expired).Msg("Expired pending uploads")
+		}
+
+		// A full batch probably means there's more waiting, keep going
+		if err == nil && expired == int(e.batchSize) {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(e.pollInterval):
+		}
+	}
+}
+
+func (e *Expirer) expireBatch(ctx context.Context) (int, error) {
+	files, err := e.queries.GetExpiredUploads(ctx, gen.GetExpiredUploadsParams{
+		UploadExpiresAt: pgtype.Timestamp{Time: time.Now().UTC(), Valid: true},
+		Limit:           e.batchSize,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, file := range files {
+		removed, err := e.removeUpload(ctx, file)
+		if err != nil {
+			return expired, err
+		}
+		// Completed or expired by someone else in the meantime
+		if !removed {
+			continue
+		}
+		expired++
+
+		key := StagingKey(file)
+		if err := e.removeObject(ctx, key, file.UploadID); err != nil {
+			log.Err(err).Str("key", key).Msg("Failed to remove expired upload")
+		}
+	}
+
+	return expired, nil
+}
+
+// removeUpload deletes a file that was never uploaded, or clears the pending
+// upload of an existing file
+func (e *Expirer) removeUpload(ctx context.Context, file gen.File) (bool, error) {
+	if filestate.State(file.ProcessState) == filestate.PendingUpload {
+		deleted, err := e.queries.DeletePendingFile(ctx, gen.DeletePendingFileParams{
+			ProjectID: file.ProjectID,
+			FileName:  file.FileName,
+		})
+		return deleted > 0, err
+	}
+
+	_, err := e.queries.ClearFileUpload(ctx, gen.ClearFileUploadParams{
+		ProjectID: file.ProjectID,
+		FileName:  file.FileName,
+		UploadKey: file.UploadKey,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// removeObject drops the parts of an unfinished multipart upload, or the
+// object if a single PUT made it in before the upload expired
+func (e *Expirer) removeObject(ctx context.Context, key string, uploadId pgtype.Text) error {
+	var err error
+	if presigner, ok := e.blobs.(storage.Presigner); ok && uploadId.Valid {
+		err = presigner.AbortMultipartUpload(ctx, key, uploadId.String)
+	}
+
+	return errors.Join(err, e.blobs.Delete(ctx, key))
+}
@@ -0,0 +1,226 @@
+package vectorstore
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+)
+
+// Memory is a brute-force VectorStore that lives in the process. Meant for
+// tests and single process setups, it compares the query with every vector.
+type Memory struct {
+	mu          sync.RWMutex
+	collections map[string]*memoryCollection
+}
+
+type memoryCollection struct {
+	dimensions int
+	points     map[string]Point
+}
+
+func NewMemory() *Memory {
+	return &Memory{collections: map[string]*memoryCollection{}}
+}
+
+func (m *Memory) CreateCollection(ctx context.Context, collection string, dimensions int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.collections[collection]; ok {
+		if existing.dimensions != dimensions {
+			return ErrDimensionMismatch
+		}
+		return nil
+	}
+
+	m.collections[collection] = &memoryCollection{dimensions: dimensions, points: map[string]Point{}}
+	return nil
+}
+
+func (m *Memory) DeleteCollection(ctx context.Context, collection string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.collections, collection)
+	return nil
+}
+
+func (m *Memory) Info(ctx context.Context, collection string) (CollectionInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	c, ok := m.collections[collection]
+	if !ok {
+		return CollectionInfo{}, ErrCollectionNotFound
+	}
+
+	return CollectionInfo{Name: collection, Dimensions: c.dimensions, Points: int64(len(c.points))}, nil
+}
+
+func (m *Memory) Upsert(ctx context.Context, collection string, points []Point) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.collections[collection]
+	if !ok {
+		return ErrCollectionNotFound
+	}
+
+	for _, point := range points {
+		if len(point.Vector) != c.dimensions {
+			return fmt.Errorf("point %s has %d dimensions, collection has %d", point.ID, len(point.Vector), c.dimensions)
+		}
+	}
+	for _, point := range points {
+		c.points[point.ID] = point
+	}
+	return nil
+}
+
+func (m *Memory) DeleteFile(ctx context.Context, collection string, fileName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.collections[collection]
+	if !ok {
+		return nil
+	}
+
+	for id, point := range c.points {
+		if point.Payload[KeyFileName] == fileName {
+			delete(c.points, id)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) RenameFile(ctx context.Context, collection string, from string, to string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.collections[collection]
+	if !ok {
+		return nil
+	}
+
+	for id, point := range c.points {
+		if point.Payload[KeyFileName] == from {
+			payload := make(Payload, len(point.Payload))
+			for key, value := range point.Payload {
+				payload[key] = value
+			}
+			payload[KeyFileName] = to
+			point.Payload = payload
+			c.points[id] = point
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Search(ctx context.Context, collection string, request SearchRequest) ([]Match, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	c, ok := m.collections[collection]
+	if !ok {
+		return nil, nil
+	}
+	if len(request.Vector) != c.dimensions {
+		return nil, fmt.Errorf("query has %d dimensions, collection has %d", len(request.Vector), c.dimensions)
+	}
+
+	var matches []Match
+	for _, point := range c.points {
+		if !request.Filter.matches(point.Payload) {
+			continue
+		}
+
+		score := cosine(request.Vector, point.Vector)
+		if score < request.ScoreThreshold {
+			continue
+		}
+
+		matches = append(matches, Match{ID: point.ID, Score: score, Payload: point.Payload})
+	}
+
+	// Ties are broken by ID so results are stable
+	slices.SortFunc(matches, func(a, b Match) int {
+		if a.Score != b.Score {
+			if a.Score > b.Score {
+				return -1
+			}
+			return 1
+		}
+		if a.ID < b.ID {
+			return -1
+		}
+		return 1
+	})
+
+	if len(matches) > request.Limit {
+		matches = matches[:request.Limit]
+	}
+	return matches, nil
+}
+
+func cosine(a []float32, b []float32) float32 {
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return float32(dot / math.Sqrt(normA*normB))
+}
+
+func (f Filter) matches(payload Payload) bool {
+	for _, condition := range f.Must {
+		if !condition.matches(payload[condition.Key]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c Condition) matches(value any) bool {
+	if c.Range != nil {
+		number, ok := toFloat(value)
+		if !ok {
+			return false
+		}
+		return (c.Range.Gte == nil || number >= *c.Range.Gte) && (c.Range.Lte == nil || number <= *c.Range.Lte)
+	}
+
+	switch value := value.(type) {
+	case string:
+		return slices.Contains(c.Any, value)
+	case []string:
+		for _, item := range value {
+			if slices.Contains(c.Any, item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func toFloat(value any) (float64, bool) {
+	switch value := value.(type) {
+	case int:
+		return float64(value), true
+	case int32:
+		return float64(value), true
+	case int64:
+		return float64(value), true
+	case float32:
+		return float64(value), true
+	case float64:
+		return value, true
+	}
+	return 0, false
+}
@@ -0,0 +1,182 @@
+package vectorstore
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// testMemory has a collection "c" with points a to d. Point i is tagged "all"
+// and tag{i}, has chunk_index i and belongs to file{i%2}.
+func testMemory(t *testing.T) *Memory {
+	t.Helper()
+
+	m := NewMemory()
+	ctx := context.Background()
+
+	if err := m.CreateCollection(ctx, "c", 3); err != nil {
+		t.Fatal(err)
+	}
+
+	points := []Point{
+		{ID: "a", Vector: []float32{1, 0, 0}},
+		{ID: "b", Vector: []float32{0.8, 0.6, 0}},
+		{ID: "c", Vector: []float32{0, 1, 0}},
+		{ID: "d", Vector: []float32{0, 0, 1}},
+	}
+	for i := range points {
+		points[i].Payload = Payload{
+			KeyFileName:   []string{"file0", "file1"}[i%2],
+			KeyChunkIndex: i,
+			KeyTags:       []string{"all", []string{"tag0", "tag1", "tag2", "tag3"}[i]},
+		}
+	}
+	if err := m.Upsert(ctx, "c", points); err != nil {
+		t.Fatal(err)
+	}
+
+	return m
+}
+
+func float(f float64) *float64 {
+	return &f
+}
+
+func TestMemorySearch(t *testing.T) {
+	tests := []struct {
+		name    string
+		request SearchRequest
+		want    []string
+	}{
+		{name: "closest first", request: SearchRequest{Vector: []float32{1, 0, 0}, Limit: 10}, want: []string{"a", "b", "c", "d"}},
+		{name: "limit", request: SearchRequest{Vector: []float32{1, 0, 0}, Limit: 2}, want: []string{"a", "b"}},
+		// Scores are equal, IDs break the tie
+		{name: "ties", request: SearchRequest{Vector: []float32{0, 0, 0}, Limit: 10}, want: []string{"a", "b", "c", "d"}},
+		{name: "threshold", request: SearchRequest{Vector: []float32{1, 0, 0}, Limit: 10, ScoreThreshold: 0.5}, want: []string{"a", "b"}},
+		{
+			name: "file name",
+			request: SearchRequest{Vector: []float32{1, 0, 0}, Limit: 10, Filter: Filter{Must: []Condition{
+				{Key: KeyFileName, Any: []string{"file1"}},
+			}}},
+			want: []string{"b", "d"},
+		},
+		{
+			name: "any tag",
+			request: SearchRequest{Vector: []float32{1, 0, 0}, Limit: 10, Filter: Filter{Must: []Condition{
+				{Key: KeyTags, Any: []string{"tag2", "tag3", "missing"}},
+			}}},
+			want: []string{"c", "d"},
+		},
+		{
+			name: "range",
+			request: SearchRequest{Vector: []float32{1, 0, 0}, Limit: 10, Filter: Filter{Must: []Condition{
+				{Key: KeyChunkIndex, Range: &Range{Gte: float(1), Lte: float(2)}},
+			}}},
+			want: []string{"b", "c"},
+		},
+		{
+			name: "every condition",
+			request: SearchRequest{Vector: []float32{1, 0, 0}, Limit: 10, Filter: Filter{Must: []Condition{
+				{Key: KeyTags, Any: []string{"all"}},
+				{Key: KeyFileName, Any: []string{"file0"}},
+				{Key: KeyChunkIndex, Range: &Range{Gte: float(1)}},
+			}}},
+			want: []string{"c"},
+		},
+		{
+			name: "missing key",
+			request: SearchRequest{Vector: []float32{1, 0, 0}, Limit: 10, Filter: Filter{Must: []Condition{
+				{Key: KeyCreatedAt, Range: &Range{Gte: float(0)}},
+			}}},
+			want: []string{},
+		},
+	}
+
+	m := testMemory(t)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			matches, err := m.Search(context.Background(), "c", test.request)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := []string{}
+			for _, match := range matches {
+				got = append(got, match.ID)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Search = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMemoryFiles(t *testing.T) {
+	m := testMemory(t)
+	ctx := context.Background()
+	search := SearchRequest{Vector: []float32{1, 0, 0}, Limit: 10}
+
+	if err := m.RenameFile(ctx, "c", "file0", "renamed"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.DeleteFile(ctx, "c", "file1"); err != nil {
+		t.Fatal(err)
+	}
+
+	matches, err := m.Search(ctx, "c", search)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 2 {
+		t.Fatalf("got %d matches, want 2", len(matches))
+	}
+	for _, match := range matches {
+		if match.Payload[KeyFileName] != "renamed" {
+			t.Errorf("%s belongs to %v, want renamed", match.ID, match.Payload[KeyFileName])
+		}
+	}
+
+	info, err := m.Info(ctx, "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Points != 2 || info.Dimensions != 3 {
+		t.Errorf("Info = %+v, want 2 points of 3 dimensions", info)
+	}
+}
+
+func TestMemoryCollections(t *testing.T) {
+	m := testMemory(t)
+	ctx := context.Background()
+
+	if err := m.CreateCollection(ctx, "c", 3); err != nil {
+		t.Errorf("creating an existing collection: %v", err)
+	}
+	if err := m.CreateCollection(ctx, "c", 4); !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("creating with other dimensions: %v, want ErrDimensionMismatch", err)
+	}
+	if err := m.Upsert(ctx, "c", []Point{{ID: "e", Vector: []float32{1, 0}}}); err == nil {
+		t.Error("upserted a vector of the wrong size")
+	}
+	if _, err := m.Search(ctx, "c", SearchRequest{Vector: []float32{1, 0}, Limit: 10}); err == nil {
+		t.Error("searched with a vector of the wrong size")
+	}
+
+	if err := m.DeleteCollection(ctx, "c"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Info(ctx, "c"); !errors.Is(err, ErrCollectionNotFound) {
+		t.Errorf("Info after delete: %v, want ErrCollectionNotFound", err)
+	}
+	if err := m.Upsert(ctx, "c", nil); !errors.Is(err, ErrCollectionNotFound) {
+		t.Errorf("Upsert after delete: %v, want ErrCollectionNotFound", err)
+	}
+	if matches, err := m.Search(ctx, "c", SearchRequest{Vector: []float32{1, 0, 0}, Limit: 10}); err != nil || len(matches) != 0 {
+		t.Errorf("Search after delete = %v, %v, want nothing", matches, err)
+	}
+	if err := m.DeleteCollection(ctx, "c"); err != nil {
+		t.Errorf("deleting a missing collection: %v", err)
+	}
+}
@@ -0,0 +1,283 @@
+package vectorstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Qdrant talks to a Qdrant server over its REST API (:6333)
+type Qdrant struct {
+	baseUrl string
+	apiKey  string
+	client  *http.Client
+}
+
+// NewQdrant returns a store for the server at baseUrl. apiKey can be empty for
+// unsecured servers (local development).
+func NewQdrant(baseUrl string, apiKey string) *Qdrant {
+	return &Qdrant{
+		baseUrl: strings.TrimSuffix(baseUrl, "/"),
+		apiKey:  apiKey,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// errQdrantNotFound is returned by do for 404 responses
+var errQdrantNotFound = errors.New("not found")
+
+// do sends a request and decodes the "result" field of the response into result
+// (if not nil)
+func (q *Qdrant) do(ctx context.Context, method string, path string, body any, result any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, q.baseUrl+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if q.apiKey != "" {
+		req.Header.Set("api-key", q.apiKey)
+	}
+
+	res, err := q.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return errQdrantNotFound
+	}
+	if res.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("qdrant %s %s failed with %s: %s", method, path, res.Status, message)
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	envelope := struct {
+		Result any `json:"result"`
+	}{Result: result}
+	return json.NewDecoder(res.Body).Decode(&envelope)
+}
+
+func collectionPath(collection string) string {
+	return "/collections/" + url.PathEscape(collection)
+}
+
+func (q *Qdrant) CreateCollection(ctx context.Context, collection string, dimensions int) error {
+	info, err := q.Info(ctx, collection)
+	if err == nil {
+		if info.Dimensions != dimensions {
+			return ErrDimensionMismatch
+		}
+		return nil
+	}
+	if !errors.Is(err, ErrCollectionNotFound) {
+		return err
+	}
+
+	err = q.do(ctx, http.MethodPut, collectionPath(collection), map[string]any{
+		"vectors": map[string]any{"size": dimensions, "distance": "Cosine"},
+	}, nil)
+	if err != nil {
+		// Another worker may have created it in the meantime
+		info, infoErr := q.Info(ctx, collection)
+		if infoErr != nil {
+			return err
+		}
+		if info.Dimensions != dimensions {
+			return ErrDimensionMismatch
+		}
+	}
+
+	// Deleting a file filters on its name
+	return q.do(ctx, http.MethodPut, collectionPath(collection)+"/index?wait=true", map[string]any{
+		"field_name":   KeyFileName,
+		"field_schema": "keyword",
+	}, nil)
+}
+
+func (q *Qdrant) DeleteCollection(ctx context.Context, collection string) error {
+	err := q.do(ctx, http.MethodDelete, collectionPath(collection), nil, nil)
+	if errors.Is(err, errQdrantNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (q *Qdrant) Info(ctx context.Context, collection string) (CollectionInfo, error) {
+	var result struct {
+		PointsCount int64 `json:"points_count"`
+		Config      struct {
+			Params struct {
+				Vectors struct {
+					Size int `json:"size"`
+				} `json:"vectors"`
+			} `json:"params"`
+		} `json:"config"`
+	}
+
+	err := q.do(ctx, http.MethodGet, collectionPath(collection), nil, &result)
+	if errors.Is(err, errQdrantNotFound) {
+		return CollectionInfo{}, ErrCollectionNotFound
+	}
+	if err != nil {
+		return CollectionInfo{}, err
+	}
+
+	return CollectionInfo{
+		Name:       collection,
+		Dimensions: result.Config.Params.Vectors.Size,
+		Points:     result.PointsCount,
+	}, nil
+}
+
+type qdrantPoint struct {
+	ID      string    `json:"id"`
+	Vector  []float32 `json:"vector"`
+	Payload Payload   `json:"payload"`
+}
+
+// Points per upsert request, keeps request bodies at a few MB
+const qdrantUpsertBatch = 256
+
+func (q *Qdrant) Upsert(ctx context.Context, collection string, points []Point) error {
+	for start := 0; start < len(points); start += qdrantUpsertBatch {
+		end := min(start+qdrantUpsertBatch, len(points))
+
+		batch := make([]qdrantPoint, 0, end-start)
+		for _, point := range points[start:end] {
+			batch = append(batch, qdrantPoint{ID: point.ID, Vector: point.Vector, Payload: point.Payload})
+		}
+
+		err := q.do(ctx, http.MethodPut, collectionPath(collection)+"/points?wait=true", map[string]any{
+			"points": batch,
+		}, nil)
+		if errors.Is(err, errQdrantNotFound) {
+			return ErrCollectionNotFound
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (q *Qdrant) DeleteFile(ctx context.Context, collection string, fileName string) error {
+	err := q.do(ctx, http.MethodPost, collectionPath(collection)+"/points/delete?wait=true", map[string]any{
+		"filter": qdrantFilter(Filter{Must: []Condition{{Key: KeyFileName, Any: []string{fileName}}}}),
+	}, nil)
+	if errors.Is(err, errQdrantNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (q *Qdrant) RenameFile(ctx context.Context, collection string, from string, to string) error {
+	err := q.do(ctx, http.MethodPost, collectionPath(collection)+"/points/payload?wait=true", map[string]any{
+		"payload": map[string]any{KeyFileName: to},
+		"filter":  qdrantFilter(Filter{Must: []Condition{{Key: KeyFileName, Any: []string{from}}}}),
+	}, nil)
+	if errors.Is(err, errQdrantNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (q *Qdrant) Search(ctx context.Context, collection string, request SearchRequest) ([]Match, error) {
+	body := map[string]any{
+		"vector":       request.Vector,
+		"limit":        request.Limit,
+		"with_payload": true,
+	}
+	if request.ScoreThreshold != 0 {
+		body["score_threshold"] = request.ScoreThreshold
+	}
+	if len(request.Filter.Must) > 0 {
+		body["filter"] = qdrantFilter(request.Filter)
+	}
+
+	var result []struct {
+		ID      any            `json:"id"`
+		Score   float32        `json:"score"`
+		Payload map[string]any `json:"payload"`
+	}
+
+	err := q.do(ctx, http.MethodPost, collectionPath(collection)+"/points/search", body, &result)
+	if errors.Is(err, errQdrantNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]Match, 0, len(result))
+	for _, point := range result {
+		matches = append(matches, Match{
+			ID:      fmt.Sprint(point.ID),
+			Score:   point.Score,
+			Payload: decodePayload(point.Payload),
+		})
+	}
+	return matches, nil
+}
+
+func qdrantFilter(filter Filter) map[string]any {
+	must := make([]map[string]any, 0, len(filter.Must))
+	for _, condition := range filter.Must {
+		if condition.Range != nil {
+			must = append(must, map[string]any{
+				"key":   condition.Key,
+				"range": map[string]*float64{"gte": condition.Range.Gte, "lte": condition.Range.Lte},
+			})
+			continue
+		}
+
+		must = append(must, map[string]any{
+			"key":   condition.Key,
+			"match": map[string]any{"any": condition.Any},
+		})
+	}
+	return map[string]any{"must": must}
+}
+
+// decodePayload turns JSON lists of strings back into []string, so payloads
+// look the same as the ones that were stored
+func decodePayload(raw map[string]any) Payload {
+	payload := make(Payload, len(raw))
+	for key, value := range raw {
+		list, ok := value.([]any)
+		if !ok {
+			payload[key] = value
+			continue
+		}
+
+		strs := make([]string, 0, len(list))
+		for _, item := range list {
+			if s, ok := item.(string); ok {
+				strs = append(strs, s)
+			}
+		}
+		payload[key] = strs
+	}
+	return payload
+}
@@ -0,0 +1,115 @@
+package vectorstore
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// ErrDimensionMismatch is returned when a collection already exists with a
+// different vector size, e.g. after a project switched embedding models
+var ErrDimensionMismatch = errors.New("collection exists with different dimensions")
+
+// ErrCollectionNotFound is returned by Info for collections that don't exist
+var ErrCollectionNotFound = errors.New("collection not found")
+
+// Point is one stored vector. IDs are chunk IDs (UUIDs).
+type Point struct {
+	ID      string
+	Vector  []float32
+	Payload Payload
+}
+
+// Payload is the metadata stored with a vector, which searches can filter on.
+// Values must be strings, string slices or numbers.
+type Payload map[string]any
+
+// Payload keys set on every chunk vector
+const (
+	KeyFileName       = "file_name"
+	KeyChunkIndex     = "chunk_index"
+	KeyEmbeddingModel = "embedding_model"
+	// The file's tags
+	KeyTags = "tags"
+	// Unix seconds, when the file was uploaded
+	KeyCreatedAt = "created_at"
+)
+
+// Condition matches points whose payload value at Key passes it. Set one of
+// Any or Range.
+type Condition struct {
+	Key string
+	// Value is one of these, or for lists, shares one with them
+	Any []string
+	// Value is a number within the range
+	Range *Range
+}
+
+// Range bounds are inclusive, nil means unbounded
+type Range struct {
+	Gte *float64
+	Lte *float64
+}
+
+// Filter matches points that pass every condition
+type Filter struct {
+	Must []Condition
+}
+
+// Match is a search result. Score is the cosine similarity, higher is closer.
+type Match struct {
+	ID      string
+	Score   float32
+	Payload Payload
+}
+
+type SearchRequest struct {
+	Vector []float32
+	Limit  int
+	// Results scoring below this are dropped, 0 keeps everything
+	ScoreThreshold float32
+	Filter         Filter
+}
+
+type CollectionInfo struct {
+	Name       string `json:"name"`
+	Dimensions int    `json:"dimensions"`
+	Points     int64  `json:"points"`
+}
+
+// VectorStore is where chunk embeddings are searched. Every project gets its
+// own collection (see ProjectCollection).
+type VectorStore interface {
+	// CreateCollection makes sure collection exists for vectors of size
+	// dimensions. It's a no-op if it already does, or ErrDimensionMismatch if
+	// it exists with another size.
+	CreateCollection(ctx context.Context, collection string, dimensions int) error
+	// DeleteCollection removes a collection and its vectors. Deleting a
+	// missing collection is not an error.
+	DeleteCollection(ctx context.Context, collection string) error
+	Info(ctx context.Context, collection string) (CollectionInfo, error)
+	// Upsert stores points, replacing any with the same ID
+	Upsert(ctx context.Context, collection string, points []Point) error
+	// DeleteFile removes every vector of a file
+	DeleteFile(ctx context.Context, collection string, fileName string) error
+	// RenameFile changes the file_name payload of every vector of a file
+	RenameFile(ctx context.Context, collection string, from string, to string) error
+	// Search returns the closest points, best first. Searching a missing
+	// collection returns nothing.
+	Search(ctx context.Context, collection string, request SearchRequest) ([]Match, error)
+}
+
+// ProjectCollection is the collection that holds a project's vectors
+func ProjectCollection(projectId string) string {
+	return "project_" + strings.ReplaceAll(projectId, "-", "")
+}
+
+// DeleteProject removes all of a project's vectors
+func DeleteProject(ctx context.Context, store VectorStore, projectId string) error {
+	return store.DeleteCollection(ctx, ProjectCollection(projectId))
+}
+
+// Float is a helper for Range bounds
+func Float(value float64) *float64 {
+	return &value
+}
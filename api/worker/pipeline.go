@@ -0,0 +1,208 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"intualai/chunker"
+	"intualai/embedding"
+	"intualai/gen"
+	"intualai/parser"
+	"intualai/settings"
+	"intualai/storage"
+	"intualai/vectorstore"
+	"io"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+// Pipeline is the Processor the worker runs for every file: parse, chunk with
+// the project's chunking settings, embed with the project's embedder, then
+// index the vectors in the project's collection
+type Pipeline struct {
+	pool      *pgxpool.Pool
+	queries   *gen.Queries
+	embedders *embedding.Registry
+	vectors   vectorstore.VectorStore
+
+	Parsers *parser.Registry
+	// Files bigger than this fail without being parsed, parsers need the
+	// whole file in memory
+	MaxFileSize int64
+}
+
+func NewPipeline(pool *pgxpool.Pool, queries *gen.Queries, embedders *embedding.Registry, vectors vectorstore.VectorStore) *Pipeline {
+	return &Pipeline{
+		pool:        pool,
+		queries:     queries,
+		embedders:   embedders,
+		vectors:     vectors,
+		Parsers:     parser.NewRegistry(),
+		MaxFileSize: 100 << 20,
+	}
+}
+
+func (p *Pipeline) Process(ctx context.Context, file gen.File, body io.Reader) error {
+	data, err := io.ReadAll(io.LimitReader(body, p.MaxFileSize+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) > p.MaxFileSize {
+		return Permanent(fmt.Errorf("file is larger than the %d MB limit", p.MaxFileSize>>20))
+	}
+
+	// Unsupported types fail here, the error ends up as the FAILED reason
+	doc, err := p.Parsers.Parse(file.FileName, data)
+	if err != nil {
+		return Permanent(err)
+	}
+
+	project, err := settings.Load(ctx, p.queries, file.ProjectID)
+	if err != nil {
+		return err
+	}
+
+	chunks, err := p.chunk(project, file, doc)
+	if err != nil {
+		return Permanent(err)
+	}
+
+	log.Info().
+		Str("file_name", file.FileName).
+		Str("mime_type", doc.MIMEType).
+		Int("length", len(doc.Text)).
+		Int("pages", len(doc.Pages)).
+		Int("chunks", len(chunks)).
+		Msg("Chunked file")
+
+	// Not configured on this instance, nothing to wait for
+	embedder, err := p.embedders.Resolve(project.Embedding.Model, project.ModelType)
+	if err != nil {
+		return Permanent(err)
+	}
+
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = chunk.Text
+	}
+
+	vectors, err := embedding.EmbedAll(ctx, embedder, texts)
+	if err != nil {
+		return fmt.Errorf("failed to embed chunks: %w", err)
+	}
+
+	err = p.saveChunks(ctx, file, chunks, vectors, embedder.Model())
+	if err != nil {
+		return err
+	}
+
+	return p.index(ctx, file, chunks, vectors, embedder)
+}
+
+func (p *Pipeline) chunk(project settings.Project, file gen.File, doc *parser.Document) ([]chunker.Chunk, error) {
+	c, err := chunker.New(project.Chunking)
+	if err != nil {
+		return nil, err
+	}
+
+	source := storage.FileKey(uuid.UUID(file.ProjectID.Bytes).String(), file.FileName)
+	return c.Chunk(doc, source), nil
+}
+
+// saveChunks replaces the file's chunks from any earlier run. vectors[i] is
+// the embedding of chunks[i], made by model.
+func (p *Pipeline) saveChunks(ctx context.Context, file gen.File, chunks []chunker.Chunk, vectors [][]float32, model string) error {
+	rows := make([]gen.CreateChunksParams, 0, len(chunks))
+	for i, chunk := range chunks {
+		rows = append(rows, gen.CreateChunksParams{
+			ID:             pgtype.UUID{Bytes: uuid.MustParse(chunk.ID), Valid: true},
+			ProjectID:      file.ProjectID,
+			FileName:       file.FileName,
+			ChunkIndex:     int32(chunk.Index),
+			Content:        chunk.Text,
+			StartOffset:    int32(chunk.Start),
+			EndOffset:      int32(chunk.End),
+			Page:           pgtype.Int4{Int32: int32(chunk.Page), Valid: chunk.Page > 0},
+			Section:        pgtype.Text{String: chunk.Section, Valid: chunk.Section != ""},
+			Embedding:      vectors[i],
+			EmbeddingModel: pgtype.Text{String: model, Valid: true},
+		})
+	}
+
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := p.queries.WithTx(tx)
+
+	err = qtx.DeleteFileChunks(ctx, gen.DeleteFileChunksParams{
+		ProjectID: file.ProjectID,
+		FileName:  file.FileName,
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := qtx.CreateChunks(ctx, rows); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// index replaces the file's vectors in the vector store
+func (p *Pipeline) index(ctx context.Context, file gen.File, chunks []chunker.Chunk, vectors [][]float32, embedder embedding.Embedder) error {
+	collection := vectorstore.ProjectCollection(uuid.UUID(file.ProjectID.Bytes).String())
+
+	err := p.vectors.CreateCollection(ctx, collection, embedder.Dimensions())
+	if errors.Is(err, vectorstore.ErrDimensionMismatch) {
+		// The collection holds other files' vectors of another model. Only
+		// changing the project's settings resets it (see routes.resetCollection),
+		// this file can be processed again after that.
+		return Permanent(fmt.Errorf("%w: %s makes %d dimensional vectors", err, embedder.Model(), embedder.Dimensions()))
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := p.vectors.DeleteFile(ctx, collection, file.FileName); err != nil {
+		return err
+	}
+
+	points := make([]vectorstore.Point, 0, len(chunks))
+	for i, chunk := range chunks {
+		points = append(points, vectorstore.Point{
+			ID:     chunk.ID,
+			Vector: vectors[i],
+			Payload: vectorstore.Payload{
+				vectorstore.KeyFileName:       file.FileName,
+				vectorstore.KeyChunkIndex:     chunk.Index,
+				vectorstore.KeyEmbeddingModel: embedder.Model(),
+				vectorstore.KeyTags:           file.Tags,
+				vectorstore.KeyCreatedAt:      file.CreatedAt.Time.Unix(),
+			},
+		})
+	}
+
+	if err := p.vectors.Upsert(ctx, collection, points); err != nil {
+		return err
+	}
+
+	// DeleteFile removes the row before the vectors. If the file was deleted
+	// since it was read, its vectors may already be gone and these would be
+	// left behind, so remove them as well.
+	_, err = p.queries.GetFile(ctx, gen.GetFileParams{
+		ProjectID: file.ProjectID,
+		FileName:  file.FileName,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return p.vectors.DeleteFile(ctx, collection, file.FileName)
+	}
+	return err
+}
@@ -0,0 +1,356 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"intualai/filestate"
+	"intualai/gen"
+	"intualai/queue"
+	"intualai/storage"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+// Processor does the actual work for a file (parse, chunk & embed). Errors
+// marked with Permanent mark the file FAILED with the error as the reason.
+// Other errors (network, database, ...) are retried when the job is delivered
+// again, until it ran out of attempts.
+type Processor interface {
+	Process(ctx context.Context, file gen.File, body io.Reader) error
+}
+
+// permanentError is a processing error that trying again won't fix
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks err as caused by the file or the project's settings, e.g. a
+// file that can't be parsed. The file is marked FAILED right away instead of
+// being retried.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err: err}
+}
+
+func isPermanent(err error) bool {
+	var permanent permanentError
+	return errors.As(err, &permanent)
+}
+
+// Worker consumes FileJobs from the job queue and drives files through
+// QUEUED -> PROCESSING -> SUCCEEDED / FAILED
+type Worker struct {
+	pool      *pgxpool.Pool
+	queries   *gen.Queries
+	jobs      queue.JobQueue
+	blobs     storage.BlobStore
+	processor Processor
+
+	// Max number of jobs processed at once
+	Concurrency int
+	// How long a job stays hidden from other workers, extended by a heartbeat
+	// while the job runs. Should match the queue's visibility timeout.
+	Visibility time.Duration
+	// How long in-flight jobs get to finish after Run's context is cancelled
+	// before they're aborted and handed back to the queue
+	DrainTimeout time.Duration
+	// How long to wait before retrying a job that hit an infrastructure error
+	// (database, blob store), as opposed to a processing error
+	RetryDelay time.Duration
+	// How many deliveries a job gets when processing keeps failing with
+	// errors that aren't Permanent, the file is marked FAILED after the last
+	MaxAttempts int
+}
+
+func New(pool *pgxpool.Pool, queries *gen.Queries, jobs queue.JobQueue, blobs storage.BlobStore, processor Processor) *Worker {
+	return &Worker{
+		pool:         pool,
+		queries:      queries,
+		jobs:         jobs,
+		blobs:        blobs,
+		processor:    processor,
+		Concurrency:  4,
+		Visibility:   5 * time.Minute,
+		DrainTimeout: 30 * time.Second,
+		RetryDelay:   30 * time.Second,
+		MaxAttempts:  4,
+	}
+}
+
+// Run processes jobs until ctx is cancelled, then stops taking new jobs and
+// waits up to DrainTimeout for the ones in flight
+func (w *Worker) Run(ctx context.Context) {
+	// Jobs keep running after ctx is cancelled, until the drain timeout
+	jobCtx, abortJobs := context.WithCancel(context.Background())
+	defer abortJobs()
+
+	slots := make(chan struct{}, w.Concurrency)
+	var wg sync.WaitGroup
+
+	log.Info().Int("concurrency", w.Concurrency).Msg("Worker started")
+
+	for ctx.Err() == nil {
+		// Wait for at least one free slot before asking for more work
+		select {
+		case slots <- struct{}{}:
+			<-slots
+		case <-ctx.Done():
+			continue
+		}
+
+		jobs, err := w.jobs.Dequeue(ctx, w.Concurrency-len(slots))
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Err(err).Msg("Failed to dequeue jobs")
+				sleep(ctx, time.Second)
+			}
+			continue
+		}
+
+		for _, job := range jobs {
+			slots <- struct{}{}
+			wg.Add(1)
+
+			go func(job queue.Job) {
+				defer wg.Done()
+				defer func() { <-slots }()
+				w.handle(jobCtx, job)
+			}(job)
+		}
+	}
+
+	log.Info().Int("in_flight", len(slots)).Msg("Worker draining")
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(w.DrainTimeout):
+		log.Warn().Msg("Drain timeout reached, aborting in-flight jobs")
+		abortJobs()
+		<-done
+	}
+
+	log.Info().Msg("Worker stopped")
+}
+
+func (w *Worker) handle(ctx context.Context, job queue.Job) {
+	var fileJob queue.FileJob
+	if err := json.Unmarshal(job.Body, &fileJob); err != nil {
+		// Will never succeed, drop it
+		log.Err(err).Str("job", job.ID).Msg("Malformed job, dropping it")
+		w.ack(ctx, job)
+		return
+	}
+
+	logger := log.With().
+		Str("job", fileJob.ID).
+		Str("project_id", fileJob.ProjectID).
+		Str("file_name", fileJob.FileName).
+		Int("attempt", job.Attempts).
+		Logger()
+
+	projectUUID, err := uuid.Parse(fileJob.ProjectID)
+	if err != nil {
+		logger.Err(err).Msg("Invalid project ID, dropping job")
+		w.ack(ctx, job)
+		return
+	}
+	projectId := pgtype.UUID{Bytes: projectUUID, Valid: true}
+
+	file, err := w.queries.GetFile(ctx, gen.GetFileParams{
+		ProjectID: projectId,
+		FileName:  fileJob.FileName,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		logger.Info().Msg("File was deleted, dropping job")
+		w.ack(ctx, job)
+		return
+	}
+	if err != nil {
+		logger.Err(err).Msg("Failed to look up file")
+		w.nack(ctx, job, w.RetryDelay)
+		return
+	}
+
+	// The job was cancelled or replaced by a newer one (see CancelFile)
+	if file.JobID.String != fileJob.ID {
+		logger.Info().Msg("Job is no longer current, dropping it")
+		w.ack(ctx, job)
+		return
+	}
+
+	switch filestate.State(file.ProcessState) {
+	case filestate.Queued:
+		file, err = w.transition(ctx, file, filestate.Processing, "Worker started processing")
+		if errors.Is(err, filestate.ErrConflict) {
+			logger.Info().Msg("File changed before processing started, dropping job")
+			w.ack(ctx, job)
+			return
+		}
+		if err != nil {
+			logger.Err(err).Msg("Failed to mark file as processing")
+			w.nack(ctx, job, w.RetryDelay)
+			return
+		}
+	case filestate.Processing:
+		// Redelivery after a worker died or was aborted mid-job, pick it up again
+		logger.Info().Msg("Resuming file that was already processing")
+	default:
+		logger.Info().Str("state", file.ProcessState).Msg("File isn't queued anymore, dropping job")
+		w.ack(ctx, job)
+		return
+	}
+
+	processCtx, stopHeartbeat := context.WithCancel(ctx)
+	heartbeatDone := make(chan struct{})
+	go func() {
+		defer close(heartbeatDone)
+		w.heartbeat(processCtx, stopHeartbeat, job)
+	}()
+
+	processErr := w.process(processCtx, file)
+
+	stopHeartbeat()
+	<-heartbeatDone
+
+	// Aborted by the drain timeout (or lost the lease), leave the file
+	// PROCESSING and let the job be redelivered
+	if processCtx.Err() != nil && processErr != nil {
+		logger.Warn().Err(processErr).Msg("Processing aborted, handing job back")
+		w.nack(context.Background(), job, 0)
+		return
+	}
+
+	// Leave the job unacked, it's delivered again once its visibility runs out
+	// and the file is picked up again where it is (PROCESSING)
+	if processErr != nil && !isPermanent(processErr) && job.Attempts < w.MaxAttempts {
+		logger.Warn().Err(processErr).Msg("Processing failed, retrying when the job is redelivered")
+		return
+	}
+
+	if processErr != nil {
+		logger.Err(processErr).Msg("Processing failed")
+		_, err = w.transition(ctx, file, filestate.Failed, processErr.Error())
+	} else {
+		logger.Info().Msg("Processing succeeded")
+		_, err = w.transition(ctx, file, filestate.Succeeded, "Processed")
+	}
+
+	if errors.Is(err, filestate.ErrConflict) {
+		// Most likely cancelled while processing, nothing to record
+		logger.Info().Msg("File changed while processing, discarding result")
+	} else if err != nil {
+		logger.Err(err).Msg("Failed to record processing result")
+		w.nack(ctx, job, w.RetryDelay)
+		return
+	}
+
+	w.ack(ctx, job)
+}
+
+func (w *Worker) process(ctx context.Context, file gen.File) error {
+	body, err := w.blobs.Get(ctx, storage.FileKey(uuid.UUID(file.ProjectID.Bytes).String(), file.FileName))
+	if errors.Is(err, storage.ErrNotFound) {
+		return Permanent(err)
+	}
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	return w.processor.Process(ctx, file, body)
+}
+
+// heartbeat keeps the job hidden from other workers while it runs. If the
+// lease is lost someone else may pick the job up, so processing is stopped.
+func (w *Worker) heartbeat(ctx context.Context, abort context.CancelFunc, job queue.Job) {
+	ticker := time.NewTicker(w.Visibility / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := w.jobs.ExtendVisibility(ctx, job, w.Visibility)
+			if errors.Is(err, queue.ErrLeaseLost) {
+				log.Warn().Str("job", job.ID).Msg("Lost job lease, aborting")
+				abort()
+				return
+			}
+			if err != nil && ctx.Err() == nil {
+				// Try again on the next tick, there's still time left on the lease
+				log.Err(err).Str("job", job.ID).Msg("Failed to extend job visibility")
+			}
+		}
+	}
+}
+
+// transition moves the file out of its current state and records the event.
+// It only happens while the file still belongs to the job it was read for
+// (file.JobID), the check above isn't enough on its own: the file can be
+// cancelled and queued under a new job right after it.
+func (w *Worker) transition(ctx context.Context, file gen.File, to filestate.State, reason string) (gen.File, error) {
+	tx, err := w.pool.Begin(ctx)
+	if err != nil {
+		return gen.File{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	file, err = filestate.Apply(ctx, w.queries.WithTx(tx), filestate.Transition{
+		ProjectID: file.ProjectID,
+		FileName:  file.FileName,
+		From:      filestate.State(file.ProcessState),
+		To:        to,
+		Actor:     filestate.ActorWorker,
+		Reason:    reason,
+		JobID:     file.JobID,
+	})
+	if err != nil {
+		return gen.File{}, err
+	}
+
+	return file, tx.Commit(ctx)
+}
+
+func (w *Worker) ack(ctx context.Context, job queue.Job) {
+	if err := w.jobs.Ack(ctx, job); err != nil {
+		log.Err(err).Str("job", job.ID).Msg("Failed to ack job")
+	}
+}
+
+func (w *Worker) nack(ctx context.Context, job queue.Job, delay time.Duration) {
+	if err := w.jobs.Nack(ctx, job, delay); err != nil {
+		log.Err(err).Str("job", job.ID).Msg("Failed to nack job")
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
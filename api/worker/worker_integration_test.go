@@ -0,0 +1,334 @@
+package worker_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"intualai/embedding"
+	"intualai/filestate"
+	"intualai/gen"
+	"intualai/outbox"
+	"intualai/queue"
+	"intualai/storage"
+	"intualai/vectorstore"
+	"intualai/worker"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// testDB migrates a fresh schema in the database at TEST_POSTGRES_DSN, it's
+// dropped when the test ends
+func testDB(t *testing.T) (*pgxpool.Pool, *gen.Queries) {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN not set")
+	}
+
+	ctx := context.Background()
+	schema := "test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+
+	admin, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(admin.Close)
+
+	if _, err := admin.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		admin.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE")
+	})
+
+	config, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Extensions may already live in public
+	config.ConnConfig.RuntimeParams["search_path"] = schema + ",public"
+
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+
+	migrations, err := filepath.Glob("../../sql/migrations/*.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(migrations)
+
+	for _, migration := range migrations {
+		sql, err := os.ReadFile(migration)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := pool.Exec(ctx, string(sql)); err != nil {
+			t.Fatalf("%s: %v", filepath.Base(migration), err)
+		}
+	}
+
+	return pool, gen.New(pool)
+}
+
+// queueTestFile creates a project with a file holding content and queues it
+// the way queueFile does
+func queueTestFile(t *testing.T, queries *gen.Queries, blobs storage.BlobStore, content string) gen.File {
+	t.Helper()
+	ctx := context.Background()
+
+	_, err := queries.CreateUser(ctx, gen.CreateUserParams{ID: "user", Email: "user@example.com", Name: "User"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	project, err := queries.CreateProject(ctx, gen.CreateProjectParams{UserID: "user", Name: "Project"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	projectId := uuid.UUID(project.ProjectID.Bytes).String()
+
+	err = blobs.Put(ctx, storage.FileKey(projectId, "notes.txt"), strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := queries.CreateFile(ctx, gen.CreateFileParams{
+		ProjectID: project.ProjectID,
+		FileName:  "notes.txt",
+		Tags:      []string{},
+		Size:      pgtype.Int8{Int64: int64(len(content)), Valid: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jobId := uuid.NewString()
+	_, err = filestate.Apply(ctx, queries, filestate.Transition{
+		ProjectID: file.ProjectID,
+		FileName:  file.FileName,
+		From:      filestate.State(file.ProcessState),
+		To:        filestate.Queued,
+		Actor:     "user",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err = queries.StartFileAttempt(ctx, gen.StartFileAttemptParams{
+		JobID:     pgtype.Text{String: jobId, Valid: true},
+		ProjectID: file.ProjectID,
+		FileName:  file.FileName,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	message, err := json.Marshal(queue.FileJob{ID: jobId, ProjectID: projectId, FileName: file.FileName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := outbox.Write(ctx, queries, "process:"+projectId+"/"+file.FileName, message); err != nil {
+		t.Fatal(err)
+	}
+
+	return file
+}
+
+// runWorker runs the outbox relay and w until the test ends
+func runWorker(t *testing.T, pool *pgxpool.Pool, queries *gen.Queries, jobs queue.JobQueue, w *worker.Worker) {
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan struct{}, 2)
+
+	go func() {
+		outbox.NewRelay(pool, queries, jobs).Run(ctx)
+		done <- struct{}{}
+	}()
+	go func() {
+		w.Run(ctx)
+		done <- struct{}{}
+	}()
+
+	t.Cleanup(func() {
+		stop()
+		<-done
+		<-done
+	})
+}
+
+// waitForFile waits until file is done processing, one way or another
+func waitForFile(t *testing.T, queries *gen.Queries, file gen.File) gen.File {
+	t.Helper()
+
+	timeout := time.After(30 * time.Second)
+	for {
+		file, err := queries.GetFile(context.Background(), gen.GetFileParams{ProjectID: file.ProjectID, FileName: file.FileName})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state := filestate.State(file.ProcessState); state != filestate.Queued && state != filestate.Processing {
+			return file
+		}
+
+		select {
+		case <-timeout:
+			t.Fatalf("file is still %s", file.ProcessState)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// TestFileProcessing runs a file from the outbox through the queue and the
+// worker until it's searchable
+func TestFileProcessing(t *testing.T) {
+	pool, queries := testDB(t)
+
+	blobs, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := queueTestFile(t, queries, blobs, strings.Repeat("Files are parsed, chunked, embedded and indexed by the worker. ", 50))
+
+	jobs := queue.NewMemory(time.Minute)
+	embedders := embedding.NewRegistry(embedding.ProviderHash)
+	embedders.Register(embedding.ProviderHash, func(model string) (embedding.Embedder, error) {
+		return embedding.NewHash(64), nil
+	})
+	vectors := vectorstore.NewMemory()
+
+	runWorker(t, pool, queries, jobs, worker.New(pool, queries, jobs, blobs, worker.NewPipeline(pool, queries, embedders, vectors)))
+
+	file = waitForFile(t, queries, file)
+	if file.ProcessState != string(filestate.Succeeded) {
+		t.Fatalf("file is %s, want %s", file.ProcessState, filestate.Succeeded)
+	}
+
+	info, err := vectors.Info(context.Background(), vectorstore.ProjectCollection(uuid.UUID(file.ProjectID.Bytes).String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Points == 0 || info.Dimensions != 64 {
+		t.Errorf("collection has %d points of %d dimensions, want some of 64", info.Points, info.Dimensions)
+	}
+}
+
+// failingProcessor returns errs one call at a time, then succeeds
+type failingProcessor struct {
+	mu    sync.Mutex
+	errs  []error
+	calls int
+}
+
+func (p *failingProcessor) Process(ctx context.Context, file gen.File, body io.Reader) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.calls++
+	if p.calls <= len(p.errs) {
+		return p.errs[p.calls-1]
+	}
+	return nil
+}
+
+// TestProcessingErrors checks which errors are retried by redelivering the
+// job and which fail the file right away
+func TestProcessingErrors(t *testing.T) {
+	transient := errors.New("embedding provider unavailable")
+	permanent := worker.Permanent(errors.New("unsupported file type"))
+
+	tests := []struct {
+		name  string
+		errs  []error
+		state filestate.State
+		calls int
+	}{
+		{name: "transient", errs: []error{transient, transient}, state: filestate.Succeeded, calls: 3},
+		{name: "permanent", errs: []error{permanent}, state: filestate.Failed, calls: 1},
+		{name: "out of attempts", errs: []error{transient, transient, transient}, state: filestate.Failed, calls: 3},
+		{name: "permanent after transient", errs: []error{transient, permanent}, state: filestate.Failed, calls: 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pool, queries := testDB(t)
+
+			blobs, err := storage.NewLocal(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			file := queueTestFile(t, queries, blobs, "content")
+
+			// Unacked jobs come back quickly
+			jobs := queue.NewMemory(200 * time.Millisecond)
+			processor := &failingProcessor{errs: test.errs}
+			w := worker.New(pool, queries, jobs, blobs, processor)
+			w.Visibility = 200 * time.Millisecond
+			w.MaxAttempts = 3
+
+			runWorker(t, pool, queries, jobs, w)
+
+			file = waitForFile(t, queries, file)
+			if file.ProcessState != string(test.state) {
+				t.Errorf("file is %s, want %s", file.ProcessState, test.state)
+			}
+
+			processor.mu.Lock()
+			defer processor.mu.Unlock()
+			if processor.calls != test.calls {
+				t.Errorf("processed %d times, want %d", processor.calls, test.calls)
+			}
+		})
+	}
+}
+
+// TestStaleJob checks a job can't move a file that was queued again under a
+// newer job, even when the file is in the state the old job expects
+func TestStaleJob(t *testing.T) {
+	_, queries := testDB(t)
+	ctx := context.Background()
+
+	blobs, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale := queueTestFile(t, queries, blobs, "content")
+
+	// Cancelled and queued again before the first job got to it
+	file, err := queries.StartFileAttempt(ctx, gen.StartFileAttemptParams{
+		JobID:     pgtype.Text{String: uuid.NewString(), Valid: true},
+		ProjectID: stale.ProjectID,
+		FileName:  stale.FileName,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	processing := func(file gen.File) error {
+		_, err := filestate.Apply(ctx, queries, filestate.Transition{
+			ProjectID: file.ProjectID,
+			FileName:  file.FileName,
+			From:      filestate.Queued,
+			To:        filestate.Processing,
+			Actor:     filestate.ActorWorker,
+			JobID:     file.JobID,
+		})
+		return err
+	}
+
+	if err := processing(stale); !errors.Is(err, filestate.ErrConflict) {
+		t.Fatalf("stale job error = %v, want ErrConflict", err)
+	}
+	if err := processing(file); err != nil {
+		t.Fatal(err)
+	}
+}
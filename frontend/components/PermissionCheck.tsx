@@ -3,10 +3,10 @@ import { useRouter } from 'next/router';
 import { useEffect, useState } from 'react';
 import { useAuth } from '@clerk/nextjs';
 import { useProject } from '@/context/ProjectContext';
-import { getUserPermission } from '@/utils/getUserPermission';
+import { getUserPermission, Role } from '@/utils/getUserPermission';
 
 interface PermissionCheckProps {
-  allowedPermissions: number[];
+  allowedPermissions: Role[];
   children: React.ReactNode;
 }
 
@@ -14,7 +14,7 @@ const PermissionCheck: React.FC<PermissionCheckProps> = ({ allowedPermissions, c
   const { getToken } = useAuth();
   const { selectedProject } = useProject();
   const router = useRouter();
-  const [permission, setPermission] = useState<number | null>(null);
+  const [permission, setPermission] = useState<Role | null>(null);
   const [loading, setLoading] = useState(true);
 
   useEffect(() => {
@@ -56,7 +56,7 @@ const PermissionCheck: React.FC<PermissionCheckProps> = ({ allowedPermissions, c
 const PermissionCheckComponent: React.FC<PermissionCheckProps> = ({ allowedPermissions, children }) => {
   const { getToken } = useAuth();
   const { selectedProject } = useProject();
-  const [permission, setPermission] = useState<number | null>(null);
+  const [permission, setPermission] = useState<Role | null>(null);
   const [loading, setLoading] = useState(true);
 
   useEffect(() => {
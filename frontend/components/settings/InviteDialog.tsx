@@ -3,21 +3,22 @@ import { Dialog, DialogTrigger, DialogContent, DialogHeader, DialogTitle, Dialog
 import { Button } from "@/components/ui/button";
 import { Input } from "@/components/ui/input";
 import { useAuth } from '@clerk/nextjs';
+import { Role } from '@/utils/getUserPermission';
 
 interface InviteDialogProps {
   projectId: string;
-  currentUserPermission: number | null;
+  currentUserPermission: Role | null;
 }
 
 const InviteDialog: React.FC<InviteDialogProps> = ({ projectId, currentUserPermission }) => {
   const { getToken } = useAuth();
   const [email, setEmail] = useState("");
-  const [permission, setPermission] = useState<number>(2);
+  const [permission, setPermission] = useState<Role>('viewer');
   const [loading, setLoading] = useState(false);
   const [error, setError] = useState<string | null>(null);
   const [success, setSuccess] = useState<string | null>(null);
 
-  const canInvite = currentUserPermission === 0 || currentUserPermission === 1;
+  const canInvite = currentUserPermission === 'owner' || currentUserPermission === 'editor';
 
   const handleInvite = async () => {
     if (!canInvite) return;
@@ -94,14 +95,14 @@ const InviteDialog: React.FC<InviteDialogProps> = ({ projectId, currentUserPermi
           <select
             id="permission"
             value={permission}
-            onChange={(e) => setPermission(Number(e.target.value))}
+            onChange={(e) => setPermission(e.target.value as Role)}
             disabled={loading}
             className="block w-full p-2 border rounded"
           >
-            {currentUserPermission === 0 && (
-              <option value={1}>Can Edit</option>
+            {currentUserPermission === 'owner' && (
+              <option value="editor">Can Edit</option>
             )}
-            <option value={2}>Can View</option>
+            <option value="viewer">Can View</option>
           </select>
         </div>
         <DialogFooter>
@@ -5,6 +5,7 @@ import { MdDeleteOutline } from "react-icons/md";
 import { useAuth, useUser } from '@clerk/nextjs';
 import { PermissionCheckComponent } from "@/components/PermissionCheck";
 import InviteDialog from "@/components/settings/InviteDialog";
+import { Role } from "@/utils/getUserPermission";
 
 interface ProjectUsersDropdownProps {
   projectId: string;
@@ -14,7 +15,7 @@ const ProjectUsersDropdown: React.FC<ProjectUsersDropdownProps> = ({ projectId }
   const { getToken } = useAuth();
   const { user } = useUser();
   const [members, setMembers] = useState<any[]>([]);
-  const [currentUserPermission, setCurrentUserPermission] = useState<number | null>(null);
+  const [currentUserPermission, setCurrentUserPermission] = useState<Role | null>(null);
 
   useEffect(() => {
     const fetchProjectMembers = async () => {
@@ -50,8 +51,8 @@ const ProjectUsersDropdown: React.FC<ProjectUsersDropdownProps> = ({ projectId }
 
   const sortedMembers = React.useMemo(() => {
     const currentUser = members.find((member: any) => member.id === user?.id);
-    const owners = members.filter((member: any) => member.permission === 0 && member.id !== user?.id);
-    const others = members.filter((member: any) => member.permission !== 0 && member.id !== user?.id);
+    const owners = members.filter((member: any) => member.permission === 'owner' && member.id !== user?.id);
+    const others = members.filter((member: any) => member.permission !== 'owner' && member.id !== user?.id);
 
     return [
       ...(currentUser ? [currentUser] : []),
@@ -60,20 +61,20 @@ const ProjectUsersDropdown: React.FC<ProjectUsersDropdownProps> = ({ projectId }
     ];
   }, [members, user]);
 
-  const getPermissionLabel = (permission: number) => {
+  const getPermissionLabel = (permission: Role) => {
     switch (permission) {
-      case 0:
+      case 'owner':
         return "Owner";
-      case 1:
+      case 'editor':
         return "Can Edit";
-      case 2:
+      case 'viewer':
         return "Can View";
       default:
         return "Unknown";
     }
   };
 
-  const handlePermissionChange = async (memberId: string, newPermission: number) => {
+  const handlePermissionChange = async (memberId: string, newPermission: Role) => {
     try {
       const token = await getToken();
       const apiBaseUrl = process.env.NEXT_PUBLIC_API_BASE_URL;
@@ -122,20 +123,20 @@ const ProjectUsersDropdown: React.FC<ProjectUsersDropdownProps> = ({ projectId }
     }
   };
 
-  const canEditMember = (currentUserPermission: number | null, memberId: string, memberPermission: number) => {
+  const canEditMember = (currentUserPermission: Role | null, memberId: string, memberPermission: Role) => {
     if (memberId === user?.id) {
       return false;
     }
-    if (currentUserPermission === 0) {
+    if (currentUserPermission === 'owner') {
       return true;
-    } else if (currentUserPermission === 1 && memberPermission === 2) {
+    } else if (currentUserPermission === 'editor' && memberPermission === 'viewer') {
       return true;
     }
     return false;
   };
 
-  const canDeleteMember = (currentUserPermission: number | null, memberId: string) => {
-    return currentUserPermission === 0 && memberId !== user?.id;
+  const canDeleteMember = (currentUserPermission: Role | null, memberId: string) => {
+    return currentUserPermission === 'owner' && memberId !== user?.id;
   };
 
   if (!user) {
@@ -170,7 +171,7 @@ const ProjectUsersDropdown: React.FC<ProjectUsersDropdownProps> = ({ projectId }
 
                 <div className="flex items-center space-x-2">
                   {canEditMember(currentUserPermission, member.id, member.permission) ? (
-                    <PermissionCheckComponent allowedPermissions={[0, 1]}>
+                    <PermissionCheckComponent allowedPermissions={['owner', 'editor']}>
                       <DropdownMenu>
                         <DropdownMenuTrigger
                           className="flex items-center justify-between border px-2 py-1 rounded"
@@ -179,10 +180,10 @@ const ProjectUsersDropdown: React.FC<ProjectUsersDropdownProps> = ({ projectId }
                           <IoMdArrowDropdown className="ml-2" />
                         </DropdownMenuTrigger>
                         <DropdownMenuContent>
-                          <DropdownMenuItem onClick={() => handlePermissionChange(member.id, 1)}>
+                          <DropdownMenuItem onClick={() => handlePermissionChange(member.id, 'editor')}>
                             Can Edit
                           </DropdownMenuItem>
-                          <DropdownMenuItem onClick={() => handlePermissionChange(member.id, 2)}>
+                          <DropdownMenuItem onClick={() => handlePermissionChange(member.id, 'viewer')}>
                             Can View
                           </DropdownMenuItem>
                           <DropdownMenuSeparator />
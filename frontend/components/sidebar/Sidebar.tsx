@@ -8,6 +8,7 @@ import { LiaKeySolid } from 'react-icons/lia';
 import { useRouter } from 'next/router';
 import { useProject } from '@/context/ProjectContext';
 import { PermissionCheck } from '@/components/PermissionCheck';
+import { Role } from '@/utils/getUserPermission';
 import { useProjectDetails } from '@/components/ProjectDetailsFetcher';
 
 type TabType = 'dashboard' | 'settings' | 'chat' | 'files' | 'jobs' | 'apiKeys' | 'costAndUsage' | 'configure' | 'search';
@@ -70,7 +71,7 @@ const Sidebar: React.FC = () => {
     }
   };
 
-  const renderTab = (tab: TabType, label: string, icon: React.ReactNode, permissionCheck: number[] = []) => {
+  const renderTab = (tab: TabType, label: string, icon: React.ReactNode, permissionCheck: Role[] = []) => {
     if (permissionCheck.length > 0) {
       return (
         <PermissionCheck allowedPermissions={permissionCheck}>
@@ -103,7 +104,7 @@ const Sidebar: React.FC = () => {
             {renderTab('chat', 'Chat', <IoChatbubbleOutline size={20} className="mr-2" />)}
             {renderTab('files', 'Files', <LuFiles size={20} className="mr-2" />)}
             {renderTab('jobs', 'Jobs', <IoGitNetworkOutline size={20} className="mr-2" />)}
-            {renderTab('apiKeys', 'API Keys', <LiaKeySolid size={20} className="mr-2" />, [0, 1])}
+            {renderTab('apiKeys', 'API Keys', <LiaKeySolid size={20} className="mr-2" />, ['owner', 'editor'])}
           </>
         );
       case 'application-ai':
@@ -123,8 +124,8 @@ const Sidebar: React.FC = () => {
         <div className="flex flex-col space-y-2">
           {renderTab('dashboard', 'Dashboard', <LuLayoutDashboard size={20} className="mr-2" />)}
           {renderFunctionSpecificTabs(projectFunction)}
-          {renderTab('costAndUsage', 'Cost and Usage', <CiCreditCard1 size={20} className="mr-2" />, [0, 1])}
-          {renderTab('settings', 'Settings', <CiSettings size={20} className="mr-2" />, [0, 1])}
+          {renderTab('costAndUsage', 'Cost and Usage', <CiCreditCard1 size={20} className="mr-2" />, ['owner', 'editor'])}
+          {renderTab('settings', 'Settings', <CiSettings size={20} className="mr-2" />, ['owner', 'editor'])}
         </div>
       </div>
     </div>
@@ -104,7 +104,7 @@ const Settings = () => {
 
   return (
     <Layout>
-      <PermissionCheck allowedPermissions={[0, 1]}>
+      <PermissionCheck allowedPermissions={['owner', 'editor']}>
         <div className="flex items-start justify-center min-h-screen overflow-auto">
           {loading ? (
             <p>Loading project details...</p>
@@ -183,7 +183,7 @@ const Settings = () => {
               )}
 
               {/* Delete Project Button */}
-              <PermissionCheckComponent allowedPermissions={[0]}>
+              <PermissionCheckComponent allowedPermissions={['owner']}>
                 <div className="flex justify-end mt-8">
                   <Button
                     variant="destructive"
@@ -1,4 +1,7 @@
-export const getUserPermission = async (userId: string, projectId: string, token: string) => {
+// Project roles, as returned by the API
+export type Role = 'owner' | 'editor' | 'viewer';
+
+export const getUserPermission = async (userId: string, projectId: string, token: string): Promise<Role | null> => {
   try {
     const apiBaseUrl = process.env.NEXT_PUBLIC_API_BASE_URL;
 
@@ -1,15 +1,15 @@
 import { useEffect, useState } from 'react';
 import { useRouter } from 'next/router';
 import { useAuth } from '@clerk/nextjs';
-import { getUserPermission } from '@/utils/getUserPermission';
+import { getUserPermission, Role } from '@/utils/getUserPermission';
 import { useProject } from '@/context/ProjectContext';
 
-const withPermission = (WrappedComponent: any, restrictedPermissions: number[]) => {
+const withPermission = (WrappedComponent: any, restrictedPermissions: Role[]) => {
   function HOC(props: any) {
     const { getToken } = useAuth();
     const { selectedProject } = useProject();
     const [loading, setLoading] = useState(true);
-    const [permission, setPermission] = useState<number | null>(null);
+    const [permission, setPermission] = useState<Role | null>(null);
     const router = useRouter();
 
     useEffect(() => {
@@ -29,7 +29,7 @@ const withPermission = (WrappedComponent: any, restrictedPermissions: number[])
         try {
           const userPermission = await getUserPermission(userId, selectedProject.id, token);
 
-          if (restrictedPermissions.includes(userPermission)) {
+          if (userPermission === null || restrictedPermissions.includes(userPermission)) {
             router.push('/dashboard'); // Redirect if unauthorized
           } else {
             setPermission(userPermission);
@@ -0,0 +1,12 @@
+BEGIN;
+
+DROP INDEX IF EXISTS api_keys_key_idx;
+
+ALTER TABLE api_keys
+  DROP COLUMN IF EXISTS last_used_at,
+  DROP COLUMN IF EXISTS created_by,
+  DROP COLUMN IF EXISTS prefix,
+  DROP COLUMN IF EXISTS name,
+  ALTER COLUMN project_id DROP NOT NULL;
+
+COMMIT;
@@ -0,0 +1,14 @@
+BEGIN;
+
+-- Keys are only ever stored as a SHA-256 hash. The prefix is kept in plaintext
+-- so users can tell their keys apart in the dashboard
+ALTER TABLE api_keys
+  ALTER COLUMN project_id SET NOT NULL,
+  ADD COLUMN name TEXT NOT NULL DEFAULT '',
+  ADD COLUMN prefix TEXT NOT NULL DEFAULT '',
+  ADD COLUMN created_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+  ADD COLUMN last_used_at TIMESTAMP;
+
+CREATE UNIQUE INDEX api_keys_key_idx ON api_keys (key);
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+ALTER TABLE project_users
+  DROP CONSTRAINT IF EXISTS project_users_permission_check;
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+-- 0 = owner, 1 = editor, 2 = viewer (see api/roles)
+ALTER TABLE project_users
+  ADD CONSTRAINT project_users_permission_check CHECK (permission IN (0, 1, 2));
+
+COMMIT;
@@ -0,0 +1,18 @@
+BEGIN;
+
+-- Work queue for deployments that don't use SQS (JOB_QUEUE=postgres). Workers
+-- claim jobs with SELECT ... FOR UPDATE SKIP LOCKED and hide them until
+-- visible_at. lease_id changes on every delivery, so a worker whose lease ran
+-- out can't ack a job that was handed to someone else.
+CREATE TABLE jobs (
+  id BIGSERIAL PRIMARY KEY,
+  body JSONB NOT NULL,
+  attempts INT NOT NULL DEFAULT 0,
+  lease_id UUID,
+  visible_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX jobs_visible_at_idx ON jobs (visible_at);
+
+COMMIT;
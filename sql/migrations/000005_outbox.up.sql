@@ -0,0 +1,20 @@
+BEGIN;
+
+-- Transactional outbox. Messages are written in the same transaction as the
+-- state change that causes them, then published to the job queue by the relay
+-- in the API (see api/outbox). Delivery is at-least-once.
+CREATE TABLE outbox (
+  id BIGSERIAL PRIMARY KEY,
+  -- Only one unpublished message per key, so retried requests don't pile up
+  dedupe_key TEXT NOT NULL,
+  payload JSONB NOT NULL,
+  attempts INT NOT NULL DEFAULT 0,
+  last_error TEXT,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  published_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX outbox_pending_dedupe_key_idx ON outbox (dedupe_key) WHERE published_at IS NULL;
+CREATE INDEX outbox_pending_idx ON outbox (id) WHERE published_at IS NULL;
+
+COMMIT;
@@ -0,0 +1,8 @@
+BEGIN;
+
+DROP TABLE IF EXISTS file_events;
+
+ALTER TABLE files
+  DROP CONSTRAINT IF EXISTS files_process_state_check;
+
+COMMIT;
@@ -0,0 +1,26 @@
+BEGIN;
+
+-- Legal transitions are enforced by api/filestate, this only keeps out
+-- states that don't exist
+ALTER TABLE files
+  ADD CONSTRAINT files_process_state_check
+  CHECK (process_state IN ('UPLOADED', 'QUEUED', 'PROCESSING', 'FAILED', 'SUCCEEDED', 'CANCELLED'));
+
+-- Every process_state change, written in the same transaction as the change
+CREATE TABLE file_events (
+  id BIGSERIAL PRIMARY KEY,
+  project_id UUID NOT NULL,
+  file_name TEXT NOT NULL,
+  from_state TEXT, -- NULL when the file was created
+  to_state TEXT NOT NULL,
+  actor TEXT NOT NULL, -- user:{id}, api_key:{id} or worker
+  reason TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  FOREIGN KEY (project_id, file_name) REFERENCES files(project_id, file_name)
+    ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE INDEX file_events_file_idx ON file_events (project_id, file_name, id);
+
+COMMIT;
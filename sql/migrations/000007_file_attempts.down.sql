@@ -0,0 +1,7 @@
+BEGIN;
+
+ALTER TABLE files
+  DROP COLUMN IF EXISTS attempts,
+  DROP COLUMN IF EXISTS job_id;
+
+COMMIT;
@@ -0,0 +1,10 @@
+BEGIN;
+
+ALTER TABLE files
+  -- Number of times the file has been queued for processing
+  ADD COLUMN attempts INT NOT NULL DEFAULT 0,
+  -- FileJob.ID of the job that should process the file. Cleared when the
+  -- file is cancelled, so workers can drop jobs that were already sent.
+  ADD COLUMN job_id TEXT;
+
+COMMIT;
@@ -0,0 +1,11 @@
+BEGIN;
+
+DROP TABLE IF EXISTS chunks;
+
+ALTER TABLE projects
+  DROP CONSTRAINT IF EXISTS projects_chunk_size_check,
+  DROP COLUMN IF EXISTS chunking_strategy,
+  DROP COLUMN IF EXISTS chunk_size,
+  DROP COLUMN IF EXISTS chunk_overlap;
+
+COMMIT;
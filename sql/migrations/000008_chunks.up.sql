@@ -0,0 +1,32 @@
+BEGIN;
+
+-- How the worker splits this project's files into chunks (see api/chunker)
+ALTER TABLE projects
+  ADD COLUMN chunking_strategy TEXT NOT NULL DEFAULT 'recursive'
+    CHECK (chunking_strategy IN ('fixed_token', 'sentence', 'recursive', 'heading')),
+  ADD COLUMN chunk_size INT NOT NULL DEFAULT 512,
+  ADD COLUMN chunk_overlap INT NOT NULL DEFAULT 64,
+  ADD CONSTRAINT projects_chunk_size_check
+    CHECK (chunk_size > 0 AND chunk_overlap >= 0 AND chunk_overlap < chunk_size);
+
+-- One-To-Many: each file is split into several chunks when it's processed
+CREATE TABLE chunks (
+  id UUID PRIMARY KEY, -- Derived from the file and position, see api/chunker
+  project_id UUID NOT NULL,
+  file_name TEXT NOT NULL,
+  chunk_index INT NOT NULL,
+  content TEXT NOT NULL,
+  -- Byte offsets into the file's extracted text
+  start_offset INT NOT NULL,
+  end_offset INT NOT NULL,
+  page INT, -- NULL for files without pages
+  section TEXT, -- Heading the chunk falls under
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  FOREIGN KEY (project_id, file_name) REFERENCES files(project_id, file_name)
+    ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE INDEX chunks_file_idx ON chunks (project_id, file_name, chunk_index);
+
+COMMIT;
@@ -0,0 +1,8 @@
+BEGIN;
+
+ALTER TABLE chunks
+  DROP CONSTRAINT chunks_embedding_model_check,
+  DROP COLUMN embedding,
+  DROP COLUMN embedding_model;
+
+COMMIT;
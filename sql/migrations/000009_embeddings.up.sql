@@ -0,0 +1,12 @@
+BEGIN;
+
+-- Filled in by the worker after chunking. Vectors from different models can't be
+-- compared, so every vector records the model that made it (e.g.
+-- "openai/text-embedding-3-small", see api/embedding)
+ALTER TABLE chunks
+  ADD COLUMN embedding REAL[],
+  ADD COLUMN embedding_model TEXT,
+  ADD CONSTRAINT chunks_embedding_model_check
+    CHECK ((embedding IS NULL) = (embedding_model IS NULL));
+
+COMMIT;
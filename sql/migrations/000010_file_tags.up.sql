@@ -0,0 +1,6 @@
+BEGIN;
+
+-- Set when uploading, searches can filter on them
+ALTER TABLE files ADD COLUMN tags TEXT[] NOT NULL DEFAULT '{}';
+
+COMMIT;
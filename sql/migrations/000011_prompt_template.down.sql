@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TABLE projects DROP COLUMN prompt_template;
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+-- text/template the query endpoint builds its prompt with (see api/rag), NULL
+-- uses the default
+ALTER TABLE projects ADD COLUMN prompt_template TEXT;
+
+COMMIT;
@@ -0,0 +1,8 @@
+BEGIN;
+
+ALTER TABLE projects DROP COLUMN retrieval_mode;
+
+DROP INDEX chunks_search_idx;
+ALTER TABLE chunks DROP COLUMN search;
+
+COMMIT;
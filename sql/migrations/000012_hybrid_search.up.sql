@@ -0,0 +1,17 @@
+BEGIN;
+
+-- Full-text index for keyword and hybrid search (see api/retrieval). Headings
+-- are included so chunks match on the section they're in.
+ALTER TABLE chunks
+  ADD COLUMN search TSVECTOR GENERATED ALWAYS AS (
+    to_tsvector('english', COALESCE(section, '') || ' ' || content)
+  ) STORED;
+
+CREATE INDEX chunks_search_idx ON chunks USING GIN (search);
+
+-- Used when a search doesn't set its mode
+ALTER TABLE projects
+  ADD COLUMN retrieval_mode TEXT NOT NULL DEFAULT 'hybrid'
+    CHECK (retrieval_mode IN ('vector', 'keyword', 'hybrid'));
+
+COMMIT;
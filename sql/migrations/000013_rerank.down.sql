@@ -0,0 +1,7 @@
+BEGIN;
+
+ALTER TABLE projects
+  DROP COLUMN reranker,
+  DROP COLUMN rerank_depth;
+
+COMMIT;
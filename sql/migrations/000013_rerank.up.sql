@@ -0,0 +1,9 @@
+BEGIN;
+
+-- Optional second stage after search (see api/rerank). NULL doesn't rerank,
+-- otherwise the first rerank_depth results are reranked.
+ALTER TABLE projects
+  ADD COLUMN reranker TEXT CHECK (reranker IN ('cross_encoder', 'lexical', 'mmr')),
+  ADD COLUMN rerank_depth INT NOT NULL DEFAULT 50 CHECK (rerank_depth BETWEEN 1 AND 200);
+
+COMMIT;
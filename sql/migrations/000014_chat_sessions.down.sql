@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TABLE IF EXISTS chat_messages;
+DROP TABLE IF EXISTS chat_sessions;
+
+COMMIT;
@@ -0,0 +1,35 @@
+BEGIN;
+
+-- Multi-turn conversations over a project's files. Sessions belong to whoever
+-- created them (a user or an API key), nobody else can see them.
+CREATE TABLE chat_sessions (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  project_id UUID NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+  owner TEXT NOT NULL, -- user:{id} or api_key:{id}
+  title TEXT NOT NULL DEFAULT '', -- The first question unless renamed
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX chat_sessions_owner_idx ON chat_sessions (project_id, owner, updated_at DESC);
+
+CREATE TABLE chat_messages (
+  id BIGSERIAL PRIMARY KEY,
+  session_id UUID NOT NULL REFERENCES chat_sessions(id) ON DELETE CASCADE,
+  role TEXT NOT NULL CHECK (role IN ('user', 'assistant')),
+  content TEXT NOT NULL,
+  -- User messages: the question rewritten to make sense without the history,
+  -- which is what was searched
+  standalone_query TEXT,
+  -- Assistant messages: the chunks the answer was generated from (not a
+  -- foreign key, chunks are replaced when files are processed again)
+  chunk_ids UUID[] NOT NULL DEFAULT '{}',
+  citations JSONB,
+  model TEXT,
+  usage JSONB,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX chat_messages_session_idx ON chat_messages (session_id, id);
+
+COMMIT;
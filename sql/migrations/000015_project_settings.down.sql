@@ -0,0 +1,34 @@
+BEGIN;
+
+ALTER TABLE projects
+  ADD COLUMN chunking_strategy TEXT NOT NULL DEFAULT 'recursive'
+    CHECK (chunking_strategy IN ('fixed_token', 'sentence', 'recursive', 'heading')),
+  ADD COLUMN chunk_size INT NOT NULL DEFAULT 512,
+  ADD COLUMN chunk_overlap INT NOT NULL DEFAULT 64,
+  ADD CONSTRAINT projects_chunk_size_check
+    CHECK (chunk_size > 0 AND chunk_overlap >= 0 AND chunk_overlap < chunk_size),
+  ADD COLUMN prompt_template TEXT,
+  ADD COLUMN retrieval_mode TEXT NOT NULL DEFAULT 'hybrid'
+    CHECK (retrieval_mode IN ('vector', 'keyword', 'hybrid')),
+  ADD COLUMN reranker TEXT CHECK (reranker IN ('cross_encoder', 'lexical', 'mmr')),
+  ADD COLUMN rerank_depth INT NOT NULL DEFAULT 50 CHECK (rerank_depth BETWEEN 1 AND 200);
+
+-- Settings that don't have a column (models, temperature...) are lost
+UPDATE projects p
+SET chunking_strategy = s.settings->'chunking'->>'strategy',
+  chunk_size = (s.settings->'chunking'->>'size')::int,
+  chunk_overlap = (s.settings->'chunking'->>'overlap')::int,
+  prompt_template = NULLIF(s.settings->'generation'->>'prompt_template', ''),
+  retrieval_mode = s.settings->'retrieval'->>'mode',
+  reranker = NULLIF(s.settings->'retrieval'->>'reranker', ''),
+  rerank_depth = (s.settings->'retrieval'->>'rerank_depth')::int
+FROM (
+  SELECT DISTINCT ON (project_id) project_id, settings
+  FROM project_settings
+  ORDER BY project_id, version DESC
+) s
+WHERE p.id = s.project_id;
+
+DROP TABLE IF EXISTS project_settings;
+
+COMMIT;
@@ -0,0 +1,51 @@
+BEGIN;
+
+-- Every change to a project's settings document is a new version, the
+-- highest one is current (see api/settings). Projects without a row use the
+-- defaults.
+CREATE TABLE project_settings (
+  project_id UUID NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+  version INT NOT NULL CHECK (version > 0),
+  settings JSONB NOT NULL,
+  created_by TEXT NOT NULL, -- user:{id} or api_key:{id}
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (project_id, version)
+);
+
+-- Carry over the settings that used to be columns on projects
+INSERT INTO project_settings (project_id, version, settings, created_by)
+SELECT id, 1, jsonb_build_object(
+  'chunking', jsonb_build_object(
+    'strategy', chunking_strategy,
+    'size', chunk_size,
+    'overlap', chunk_overlap
+  ),
+  'embedding', jsonb_build_object('model', ''),
+  'retrieval', jsonb_build_object(
+    'mode', retrieval_mode,
+    'top_k', 10,
+    'reranker', COALESCE(reranker, ''),
+    'rerank_depth', rerank_depth
+  ),
+  'generation', jsonb_build_object(
+    'model', '',
+    'temperature', 0,
+    'system_prompt', '',
+    'prompt_template', COALESCE(prompt_template, ''),
+    'max_context_tokens', 6000
+  )
+), 'migration'
+FROM projects;
+
+ALTER TABLE projects
+  DROP CONSTRAINT projects_chunk_size_check,
+  DROP COLUMN chunking_strategy,
+  DROP COLUMN chunk_size,
+  DROP COLUMN chunk_overlap,
+  DROP COLUMN prompt_template,
+  DROP COLUMN retrieval_mode,
+  DROP COLUMN reranker,
+  DROP COLUMN rerank_depth;
+
+COMMIT;
@@ -0,0 +1,16 @@
+BEGIN;
+
+DELETE FROM files WHERE process_state = 'PENDING_UPLOAD';
+
+DROP INDEX IF EXISTS files_pending_upload_idx;
+
+ALTER TABLE files
+  DROP COLUMN upload_expires_at,
+  DROP COLUMN upload_id,
+  DROP COLUMN checksum,
+  DROP COLUMN size,
+  DROP CONSTRAINT files_process_state_check,
+  ADD CONSTRAINT files_process_state_check
+  CHECK (process_state IN ('UPLOADED', 'QUEUED', 'PROCESSING', 'FAILED', 'SUCCEEDED', 'CANCELLED'));
+
+COMMIT;
@@ -0,0 +1,20 @@
+BEGIN;
+
+-- Files uploaded straight to the bucket (POST .../files/upload-url) start out
+-- PENDING_UPLOAD until the client says it's done
+ALTER TABLE files
+  DROP CONSTRAINT files_process_state_check,
+  ADD CONSTRAINT files_process_state_check
+  CHECK (process_state IN ('PENDING_UPLOAD', 'UPLOADED', 'QUEUED', 'PROCESSING', 'FAILED', 'SUCCEEDED', 'CANCELLED')),
+  -- Set once the file is UPLOADED
+  ADD COLUMN size BIGINT,
+  ADD COLUMN checksum TEXT, -- hex SHA-256 of the content
+  -- S3 multipart upload ID while a multipart direct upload is pending
+  ADD COLUMN upload_id TEXT,
+  -- Pending uploads that aren't completed by then are removed
+  ADD COLUMN upload_expires_at TIMESTAMP;
+
+CREATE INDEX files_pending_upload_idx ON files (upload_expires_at)
+  WHERE process_state = 'PENDING_UPLOAD';
+
+COMMIT;
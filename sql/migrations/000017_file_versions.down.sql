@@ -0,0 +1,11 @@
+BEGIN;
+
+-- Archived objects are left in the bucket
+DROP TABLE IF EXISTS file_versions;
+
+DROP INDEX IF EXISTS files_checksum_idx;
+
+ALTER TABLE files
+  DROP COLUMN version;
+
+COMMIT;
@@ -0,0 +1,31 @@
+BEGIN;
+
+-- files is the current version of each file. Uploading new content under
+-- the same name archives the current version in file_versions and bumps
+-- version, restoring an old version makes a copy of it the current one.
+ALTER TABLE files
+  ADD COLUMN version INT NOT NULL DEFAULT 1;
+
+-- Uploads with the same content as an existing file are skipped. Files
+-- uploaded before checksums were recorded don't take part.
+CREATE INDEX files_checksum_idx ON files (project_id, checksum)
+  WHERE checksum IS NOT NULL;
+
+CREATE TABLE file_versions (
+  project_id UUID NOT NULL,
+  file_name TEXT NOT NULL,
+  version INT NOT NULL,
+  object_key TEXT NOT NULL, -- Archived copy, the file's own key holds the current version
+  checksum TEXT, -- NULL for files uploaded before checksums were recorded
+  size BIGINT,
+  process_state TEXT NOT NULL, -- When it was replaced
+  uploaded_at TIMESTAMP NOT NULL,
+  archived_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  archived_by TEXT NOT NULL, -- user:{id} or api_key:{id}
+
+  PRIMARY KEY (project_id, file_name, version),
+  FOREIGN KEY (project_id, file_name) REFERENCES files(project_id, file_name)
+    ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+COMMIT;
@@ -0,0 +1,18 @@
+BEGIN;
+
+-- Pending uploads to existing files are dropped, their staging objects are
+-- left in the bucket
+UPDATE files
+SET upload_id = NULL, upload_expires_at = NULL
+WHERE process_state <> 'PENDING_UPLOAD';
+
+DROP INDEX IF EXISTS files_pending_upload_idx;
+
+CREATE INDEX files_pending_upload_idx ON files (upload_expires_at)
+  WHERE process_state = 'PENDING_UPLOAD';
+
+ALTER TABLE files
+  DROP COLUMN upload_tags,
+  DROP COLUMN upload_key;
+
+COMMIT;
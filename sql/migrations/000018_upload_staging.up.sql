@@ -0,0 +1,17 @@
+BEGIN;
+
+-- Direct uploads go to a staging object (uploads/{project_id}/{id}) and are
+-- only copied to the file's key once completed, so the presigned URLs can't
+-- change a file's content after its checksum was recorded. A direct upload
+-- to an existing file becomes its next version, the upload_* columns are set
+-- on that file while the upload is pending.
+ALTER TABLE files
+  ADD COLUMN upload_key TEXT, -- NULL for uploads started before staging, those went to the file's key
+  ADD COLUMN upload_tags TEXT[]; -- Tags for the new version of an existing file
+
+DROP INDEX IF EXISTS files_pending_upload_idx;
+
+CREATE INDEX files_pending_upload_idx ON files (upload_expires_at)
+  WHERE upload_expires_at IS NOT NULL;
+
+COMMIT;
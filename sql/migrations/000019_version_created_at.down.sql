@@ -0,0 +1,6 @@
+BEGIN;
+
+ALTER TABLE files
+  DROP COLUMN version_created_at;
+
+COMMIT;
@@ -0,0 +1,16 @@
+BEGIN;
+
+-- When the current version was uploaded. created_at stays when the file was
+-- first created: file listings are sorted and paged by it, a new version
+-- mustn't move the file around in them.
+ALTER TABLE files
+  ADD COLUMN version_created_at TIMESTAMP;
+
+UPDATE files
+SET version_created_at = created_at;
+
+ALTER TABLE files
+  ALTER COLUMN version_created_at SET NOT NULL,
+  ALTER COLUMN version_created_at SET DEFAULT CURRENT_TIMESTAMP;
+
+COMMIT;
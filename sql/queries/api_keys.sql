@@ -0,0 +1,33 @@
+-- name: CreateApiKey :one
+INSERT INTO api_keys (
+  project_id, name, prefix, key, created_by, expires_at
+) VALUES (
+  $1, $2, $3, $4, $5, $6
+)
+RETURNING id, project_id, name, prefix, created_at, expires_at;
+
+-- name: GetAllApiKeys :many
+SELECT id, project_id, name, prefix, created_by, created_at, expires_at, last_used_at
+FROM api_keys
+WHERE project_id = $1
+ORDER BY created_at DESC;
+
+-- name: GetApiKeyByHash :one
+-- Expired keys are treated as if they don't exist. expires_at is stored in
+-- UTC, so now has to be UTC too: CURRENT_TIMESTAMP would be in the session's
+-- time zone.
+SELECT id, project_id
+FROM api_keys
+WHERE key = sqlc.arg(key)
+AND (expires_at IS NULL OR expires_at > sqlc.arg(now)::timestamp);
+
+-- name: TouchApiKey :exec
+-- UTC like expires_at
+UPDATE api_keys
+SET last_used_at = sqlc.arg(now)
+WHERE id = sqlc.arg(id);
+
+-- name: DeleteApiKey :execrows
+DELETE FROM api_keys
+WHERE id = $1
+AND project_id = $2;
@@ -0,0 +1,54 @@
+-- name: CreateChatSession :one
+INSERT INTO chat_sessions (
+  project_id, owner, title
+) VALUES (
+  $1, $2, $3
+)
+RETURNING *;
+
+-- name: GetChatSessions :many
+SELECT * FROM chat_sessions
+WHERE project_id = $1
+AND owner = $2
+ORDER BY updated_at DESC;
+
+-- name: GetChatSession :one
+SELECT * FROM chat_sessions
+WHERE id = $1
+AND project_id = $2
+AND owner = $3;
+
+-- name: RenameChatSession :one
+UPDATE chat_sessions
+SET title = sqlc.arg(title), updated_at = CURRENT_TIMESTAMP
+WHERE id = sqlc.arg(id)
+AND project_id = sqlc.arg(project_id)
+AND owner = sqlc.arg(owner)
+RETURNING *;
+
+-- name: TouchChatSession :one
+-- Called when a message is added, sessions without a title get one
+UPDATE chat_sessions
+SET updated_at = CURRENT_TIMESTAMP,
+  title = CASE WHEN title = '' THEN sqlc.arg(title) ELSE title END
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+-- name: DeleteChatSession :execrows
+DELETE FROM chat_sessions
+WHERE id = $1
+AND project_id = $2
+AND owner = $3;
+
+-- name: CreateChatMessage :one
+INSERT INTO chat_messages (
+  session_id, role, content, standalone_query, chunk_ids, citations, model, usage
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8
+)
+RETURNING *;
+
+-- name: GetChatMessages :many
+SELECT * FROM chat_messages
+WHERE session_id = $1
+ORDER BY id;
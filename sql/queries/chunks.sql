@@ -0,0 +1,42 @@
+-- name: CreateChunks :copyfrom
+INSERT INTO chunks (
+  id, project_id, file_name, chunk_index, content, start_offset, end_offset, page, section,
+  embedding, embedding_model
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11
+);
+
+-- name: DeleteFileChunks :exec
+DELETE FROM chunks
+WHERE project_id = $1
+AND file_name = $2;
+
+-- name: GetChunksByIDs :many
+-- Chunks found by a search, in no particular order. The stored embedding
+-- saves rerankers from embedding the chunk again.
+SELECT id, file_name, chunk_index, content, start_offset, end_offset, page, section,
+  embedding, embedding_model
+FROM chunks
+WHERE project_id = sqlc.arg(project_id)
+AND id = ANY(sqlc.arg(ids)::uuid[]);
+
+-- name: SearchChunksKeyword :many
+-- Full-text search, query is the words to match joined with " | " (see
+-- retrieval.anyWord). NULL filters are ignored.
+WITH q AS (
+  SELECT to_tsquery('english', sqlc.arg(query)) AS query
+)
+SELECT c.id, c.file_name, c.chunk_index, c.content, c.start_offset, c.end_offset, c.page, c.section,
+  c.embedding, c.embedding_model,
+  ts_rank_cd(c.search, q.query)::real AS score
+FROM chunks c
+JOIN files f ON f.project_id = c.project_id AND f.file_name = c.file_name
+CROSS JOIN q
+WHERE c.project_id = sqlc.arg(project_id)
+AND c.search @@ q.query
+AND (sqlc.narg(file_names)::text[] IS NULL OR c.file_name = ANY(sqlc.narg(file_names)::text[]))
+AND (sqlc.narg(tags)::text[] IS NULL OR f.tags && sqlc.narg(tags)::text[])
+AND (sqlc.narg(created_after)::timestamp IS NULL OR f.created_at >= sqlc.narg(created_after)::timestamp)
+AND (sqlc.narg(created_before)::timestamp IS NULL OR f.created_at <= sqlc.narg(created_before)::timestamp)
+ORDER BY score DESC, c.id
+LIMIT sqlc.arg(max_results);
@@ -0,0 +1,12 @@
+-- name: CreateFileEvent :exec
+INSERT INTO file_events (
+  project_id, file_name, from_state, to_state, actor, reason
+) VALUES (
+  $1, $2, $3, $4, $5, $6
+);
+
+-- name: GetFileEvents :many
+SELECT * FROM file_events
+WHERE project_id = $1
+AND file_name = $2
+ORDER BY id;
@@ -0,0 +1,20 @@
+-- name: CreateFileVersion :one
+INSERT INTO file_versions (
+  project_id, file_name, version, object_key, checksum, size, process_state, uploaded_at, archived_by
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8, $9
+)
+RETURNING *;
+
+-- name: GetFileVersions :many
+-- Archived versions, newest first. The current one is in files.
+SELECT * FROM file_versions
+WHERE project_id = $1
+AND file_name = $2
+ORDER BY version DESC;
+
+-- name: GetFileVersion :one
+SELECT * FROM file_versions
+WHERE project_id = $1
+AND file_name = $2
+AND version = $3;
@@ -1,7 +1,39 @@
 -- name: GetAllFiles :many
+-- A page of a project's files, sorted by sort_by (name, created_at or size)
+-- with ties broken by name. The after_* args are the sort key of the last
+-- file of the previous page, after_name NULL is the first page. Files
+-- without a size sort as 0.
 SELECT * FROM files
-WHERE project_id = $1
-LIMIT 10;
+WHERE project_id = sqlc.arg(project_id)
+AND (sqlc.narg(process_state)::text IS NULL OR process_state = sqlc.narg(process_state)::text)
+AND (sqlc.narg(name_prefix)::text IS NULL OR starts_with(file_name, sqlc.narg(name_prefix)::text))
+AND (sqlc.narg(after_name)::text IS NULL OR CASE
+  WHEN sqlc.arg(descending)::boolean THEN CASE sqlc.arg(sort_by)::text
+    WHEN 'created_at' THEN (created_at, file_name) < (sqlc.narg(after_created_at)::timestamp, sqlc.narg(after_name)::text)
+    WHEN 'size' THEN (COALESCE(size, 0), file_name) < (sqlc.narg(after_size)::bigint, sqlc.narg(after_name)::text)
+    ELSE file_name < sqlc.narg(after_name)::text
+  END
+  ELSE CASE sqlc.arg(sort_by)::text
+    WHEN 'created_at' THEN (created_at, file_name) > (sqlc.narg(after_created_at)::timestamp, sqlc.narg(after_name)::text)
+    WHEN 'size' THEN (COALESCE(size, 0), file_name) > (sqlc.narg(after_size)::bigint, sqlc.narg(after_name)::text)
+    ELSE file_name > sqlc.narg(after_name)::text
+  END
+END)
+ORDER BY
+  CASE WHEN sqlc.arg(sort_by)::text = 'created_at' AND NOT sqlc.arg(descending)::boolean THEN created_at END,
+  CASE WHEN sqlc.arg(sort_by)::text = 'created_at' AND sqlc.arg(descending)::boolean THEN created_at END DESC,
+  CASE WHEN sqlc.arg(sort_by)::text = 'size' AND NOT sqlc.arg(descending)::boolean THEN COALESCE(size, 0) END,
+  CASE WHEN sqlc.arg(sort_by)::text = 'size' AND sqlc.arg(descending)::boolean THEN COALESCE(size, 0) END DESC,
+  CASE WHEN NOT sqlc.arg(descending)::boolean THEN file_name END,
+  CASE WHEN sqlc.arg(descending)::boolean THEN file_name END DESC
+LIMIT sqlc.arg(page_size);
+
+-- name: CountFiles :one
+-- How many files GetAllFiles pages through with the same filters
+SELECT COUNT(*) FROM files
+WHERE project_id = sqlc.arg(project_id)
+AND (sqlc.narg(process_state)::text IS NULL OR process_state = sqlc.narg(process_state)::text)
+AND (sqlc.narg(name_prefix)::text IS NULL OR starts_with(file_name, sqlc.narg(name_prefix)::text));
 
 -- name: FileExists :one
 SELECT EXISTS (
@@ -13,43 +45,143 @@ SELECT EXISTS (
 
 -- name: CreateFile :one
 INSERT INTO files (
-  project_id, file_name, process_state
+  project_id, file_name, tags, process_state, size, checksum
+) VALUES (
+  $1, $2, $3, 'UPLOADED', $4, $5
+)
+RETURNING *;
+
+-- name: CreatePendingFile :one
+INSERT INTO files (
+  project_id, file_name, tags, process_state, upload_id, upload_key, upload_expires_at
 ) VALUES (
-  $1, $2, 'UPLOADED'
+  $1, $2, $3, 'PENDING_UPLOAD', $4, $5, $6
 )
 RETURNING *;
 
--- name: UpdateFileQueued :one
+-- name: StartFileUpload :one
+-- Starts a direct upload of a new version of an existing file. Only one can
+-- be pending at a time, and not while the file's content is in use.
+UPDATE files
+SET upload_id = sqlc.narg(upload_id),
+  upload_key = sqlc.arg(upload_key),
+  upload_tags = sqlc.narg(upload_tags),
+  upload_expires_at = sqlc.arg(upload_expires_at)
+WHERE project_id = sqlc.arg(project_id)
+AND file_name = sqlc.arg(file_name)
+AND process_state NOT IN ('PENDING_UPLOAD', 'QUEUED', 'PROCESSING')
+AND upload_expires_at IS NULL
+RETURNING *;
+
+-- name: ClearFileUpload :one
+-- Ends the direct upload to an existing file, if it's still the one with
+-- upload_key
 UPDATE files
-SET process_state = 'QUEUED'
+SET upload_id = NULL, upload_key = NULL, upload_tags = NULL, upload_expires_at = NULL
 WHERE project_id = $1
 AND file_name = $2
+AND upload_key = $3
 RETURNING *;
 
--- name: UpdateFileProcessing :one
+-- name: SetFileContent :one
+-- Called in the same transaction that moves the file out of PENDING_UPLOAD
 UPDATE files
-SET process_state = 'PROCESSING'
+SET size = $3, checksum = $4, upload_id = NULL, upload_key = NULL, upload_expires_at = NULL
 WHERE project_id = $1
 AND file_name = $2
 RETURNING *;
 
--- name: UpdateFileFailed :one
-UPDATE files
-SET process_state = 'FAILED'
+-- name: GetExpiredUploads :many
+-- New files that were never uploaded and new versions that were never
+-- completed
+SELECT * FROM files
+WHERE upload_expires_at < $1
+ORDER BY upload_expires_at
+LIMIT $2;
+
+-- name: DeletePendingFile :execrows
+-- Only deletes the file if it's still pending, so a completion that came in
+-- at the same time wins
+DELETE FROM files
 WHERE project_id = $1
 AND file_name = $2
+AND process_state = 'PENDING_UPLOAD';
+
+-- name: GetFile :one
+SELECT * FROM files
+WHERE project_id = $1
+AND file_name = $2;
+
+-- name: UpdateFileState :one
+-- Compare-and-set, returns no rows if the file isn't in from_state anymore,
+-- or if job_id is given and the file was queued under another job since.
+-- Use filestate.Apply instead of calling this directly.
+UPDATE files
+SET process_state = sqlc.arg(to_state)
+WHERE project_id = sqlc.arg(project_id)
+AND file_name = sqlc.arg(file_name)
+AND process_state = sqlc.arg(from_state)
+AND (sqlc.narg(job_id)::text IS NULL OR job_id = sqlc.narg(job_id)::text)
+RETURNING *;
+
+-- name: StartFileAttempt :one
+-- Called in the same transaction that queues the file. Reprocessing a file
+-- that succeeded starts counting attempts over.
+UPDATE files
+SET attempts = CASE WHEN sqlc.arg(reset_attempts)::boolean THEN 1 ELSE attempts + 1 END,
+  job_id = sqlc.arg(job_id)
+WHERE project_id = sqlc.arg(project_id)
+AND file_name = sqlc.arg(file_name)
 RETURNING *;
 
--- name: UpdateFileSucceeded :one
+-- name: ClearFileJob :one
 UPDATE files
-SET process_state = 'SUCCEEDED'
+SET job_id = NULL
 WHERE project_id = $1
 AND file_name = $2
 RETURNING *;
 
--- name: UpdateFileCancelled :one
+-- name: RenameFile :one
+-- Chunks and file_events follow through ON UPDATE CASCADE
 UPDATE files
-SET process_state = 'CANCELLED'
+SET file_name = sqlc.arg(new_file_name)
+WHERE project_id = sqlc.arg(project_id)
+AND file_name = sqlc.arg(file_name)
+RETURNING *;
+
+-- name: DeleteFile :execrows
+-- Chunks and file_events go with it (ON DELETE CASCADE)
+DELETE FROM files
+WHERE project_id = $1
+AND file_name = $2;
+
+-- name: GetFileByChecksum :one
+-- The oldest file whose current version has this content
+SELECT * FROM files
+WHERE project_id = $1
+AND checksum = $2
+ORDER BY created_at
+LIMIT 1;
+
+-- name: GetFileForUpdate :one
+SELECT * FROM files
 WHERE project_id = $1
 AND file_name = $2
+FOR UPDATE;
+
+-- name: SetFileVersion :one
+-- Makes new content the current version, which starts over as UPLOADED.
+-- Archive the old version (CreateFileVersion) in the same transaction.
+-- created_at stays, it's when the file was first uploaded.
+UPDATE files
+SET version = version + 1,
+  size = sqlc.arg(size),
+  checksum = sqlc.arg(checksum),
+  tags = COALESCE(sqlc.narg(tags), tags),
+  process_state = 'UPLOADED',
+  attempts = 0,
+  job_id = NULL,
+  version_created_at = CURRENT_TIMESTAMP
+WHERE project_id = sqlc.arg(project_id)
+AND file_name = sqlc.arg(file_name)
 RETURNING *;
@@ -0,0 +1,39 @@
+-- name: EnqueueJob :one
+INSERT INTO jobs (body)
+VALUES ($1)
+RETURNING id;
+
+-- name: DequeueJobs :many
+UPDATE jobs
+SET
+  attempts = attempts + 1,
+  lease_id = uuid_generate_v4(),
+  visible_at = CURRENT_TIMESTAMP + make_interval(secs => sqlc.arg(visibility_seconds)::float8)
+WHERE id IN (
+  SELECT id
+  FROM jobs
+  WHERE visible_at <= CURRENT_TIMESTAMP
+  ORDER BY id
+  LIMIT sqlc.arg(max_jobs)
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING id, body, attempts, lease_id;
+
+-- name: AckJob :execrows
+DELETE FROM jobs
+WHERE id = $1
+AND lease_id = $2;
+
+-- name: NackJob :execrows
+UPDATE jobs
+SET
+  lease_id = NULL,
+  visible_at = CURRENT_TIMESTAMP + make_interval(secs => sqlc.arg(delay_seconds)::float8)
+WHERE id = sqlc.arg(id)
+AND lease_id = sqlc.arg(lease_id);
+
+-- name: ExtendJobVisibility :execrows
+UPDATE jobs
+SET visible_at = CURRENT_TIMESTAMP + make_interval(secs => sqlc.arg(visibility_seconds)::float8)
+WHERE id = sqlc.arg(id)
+AND lease_id = sqlc.arg(lease_id);
@@ -0,0 +1,42 @@
+-- name: InsertOutboxMessage :execrows
+-- Returns 0 if an unpublished message with the same dedupe_key already exists
+INSERT INTO outbox (dedupe_key, payload)
+VALUES ($1, $2)
+ON CONFLICT (dedupe_key) WHERE published_at IS NULL
+DO NOTHING;
+
+-- name: ClaimOutboxMessages :many
+SELECT id, payload
+FROM outbox
+WHERE published_at IS NULL
+ORDER BY id
+LIMIT $1
+FOR UPDATE SKIP LOCKED;
+
+-- name: MarkOutboxPublished :exec
+UPDATE outbox
+SET published_at = CURRENT_TIMESTAMP
+WHERE id = $1;
+
+-- name: MarkOutboxFailed :exec
+UPDATE outbox
+SET attempts = attempts + 1, last_error = $2
+WHERE id = $1;
+
+-- name: DeletePublishedOutboxMessages :execrows
+DELETE FROM outbox
+WHERE published_at < $1;
+
+-- name: DeletePendingOutboxMessage :execrows
+-- Drops a message that hasn't been published yet, e.g. a job for a file that
+-- was cancelled right after being queued
+DELETE FROM outbox
+WHERE dedupe_key = $1
+AND published_at IS NULL;
+
+-- name: GetPendingOutboxMessage :one
+-- The payload of the unpublished message with dedupe_key, if there is one
+SELECT payload
+FROM outbox
+WHERE dedupe_key = $1
+AND published_at IS NULL;
@@ -39,11 +39,11 @@ WHERE p.id = $1;
 -- name: UpdateProjectDetails :exec
 UPDATE projects
 SET 
-  description = COALESCE($2, description),
-  industry = COALESCE($3, industry),
-  use_case = COALESCE($4, use_case),
-  model_type = COALESCE($5, model_type)
-WHERE id = $1;
+  description = COALESCE(sqlc.narg(description), description),
+  industry = COALESCE(sqlc.narg(industry), industry),
+  use_case = COALESCE(sqlc.narg(use_case), use_case),
+  model_type = COALESCE(sqlc.narg(model_type), model_type)
+WHERE id = sqlc.arg(id);
 
 -- name: InviteUserToProject :exec
 INSERT INTO project_users (user_id, project_id, permission, email)
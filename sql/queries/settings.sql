@@ -0,0 +1,27 @@
+-- name: GetProjectSettings :one
+-- The current (highest) version
+SELECT * FROM project_settings
+WHERE project_id = $1
+ORDER BY version DESC
+LIMIT 1;
+
+-- name: GetProjectSettingsVersion :one
+SELECT * FROM project_settings
+WHERE project_id = $1
+AND version = $2;
+
+-- name: GetProjectSettingsVersions :many
+SELECT version, created_by, created_at
+FROM project_settings
+WHERE project_id = $1
+ORDER BY version DESC;
+
+-- name: CreateProjectSettings :one
+-- Fails with a unique violation if version already exists, i.e. someone else
+-- saved in the meantime
+INSERT INTO project_settings (
+  project_id, version, settings, created_by
+) VALUES (
+  $1, $2, $3, $4
+)
+RETURNING *;